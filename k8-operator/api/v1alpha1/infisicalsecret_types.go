@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	batchv1 "k8s.io/api/batch/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -80,6 +81,59 @@ type MangedKubeSecretConfig struct {
 	// +kubebuilder:validation:Optional
 	// +kubebuilder:default:=Orphan
 	CreationPolicy string `json:"creationPolicy"`
+
+	// Names the managed secret had before it was renamed. Workloads still referencing one of them keep being detected and restarted
+	// during the transition, and a warning event lists them so their references can be updated
+	// +kubebuilder:validation:Optional
+	PreviousNames []string `json:"previousNames"`
+}
+
+type RestartSchedule struct {
+	// Standard five field cron expression (minute hour day-of-month month day-of-week) or one of @hourly, @daily, @weekly, @monthly and @yearly
+	// +kubebuilder:validation:Required
+	Cron string `json:"cron"`
+
+	// IANA time zone the cron expression is evaluated in, such as Europe/Berlin. Defaults to UTC
+	// +kubebuilder:validation:Optional
+	TimeZone string `json:"timeZone"`
+}
+
+// A period during which workloads are not restarted. Either recurring, opening on a cron schedule for durationMinutes, or a single period from start to end
+type TimeWindow struct {
+	// Standard five field cron expression of when the window opens, or one of @hourly, @daily, @weekly, @monthly and @yearly
+	// +kubebuilder:validation:Optional
+	Cron string `json:"cron"`
+
+	// How long the window stays open after each activation of the cron expression
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum:=0
+	DurationMinutes int `json:"durationMinutes"`
+
+	// Start of a single window, either in RFC 3339 format or as a local time such as 2024-12-20T18:00 in the time zone of the window
+	// +kubebuilder:validation:Optional
+	Start string `json:"start"`
+
+	// End of a single window, in the same format as start
+	// +kubebuilder:validation:Optional
+	End string `json:"end"`
+
+	// IANA time zone the window is evaluated in, such as Europe/Berlin. Defaults to UTC
+	// +kubebuilder:validation:Optional
+	TimeZone string `json:"timeZone"`
+}
+
+// A Job run around the restart of the workloads consuming the managed secret, such as a schema migration using a rotated credential
+type RestartJob struct {
+	// Template of the Job. It is created in the namespace of the InfisicalSecret once per version of the managed secret
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type:=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	JobTemplate batchv1.JobTemplateSpec `json:"jobTemplate"`
+
+	// Seconds the Job may run before it is considered failed. Defaults to 600
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum:=0
+	TimeoutSeconds int64 `json:"timeoutSeconds"`
 }
 
 // InfisicalSecretSpec defines the desired state of InfisicalSecret
@@ -99,11 +153,220 @@ type InfisicalSecretSpec struct {
 	// Infisical host to pull secrets from
 	// +kubebuilder:validation:Optional
 	HostAPI string `json:"hostAPI"`
+
+	// Allowlist of label and annotation keys on the managed Kubernetes secret which will be copied onto the pod template of auto redeployed workloads.
+	// System keys (such as kubectl.kubernetes.io/last-applied-configuration) and values containing secret data are never copied.
+	// +kubebuilder:validation:Optional
+	PropagateSecretMetadata []string `json:"propagateSecretMetadata"`
+
+	// When enabled, a workload is only restarted if at least one of its current pods was created before the managed secret was last modified
+	// +kubebuilder:validation:Optional
+	RestartOnlyOutdatedPods *bool `json:"restartOnlyOutdatedPods,omitempty"`
+
+	// When enabled, a rotation only restarts workloads when a key of the managed secret they consume changed. Workloads consuming the whole secret,
+	// or keys that cannot be resolved statically (e.g. templated key names), are restarted on any change
+	// +kubebuilder:validation:Optional
+	RestartOnlyForConsumedKeys bool `json:"restartOnlyForConsumedKeys"`
+
+	// Workloads created less than this many seconds ago are assumed to already use the current managed secret.
+	// They record its version without being restarted. 0 disables the check
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum:=0
+	MinWorkloadAgeSeconds int `json:"minWorkloadAgeSeconds"`
+
+	// What to do with workloads consuming the managed secret that never recorded a version of it, e.g. when the operator is first installed.
+	// adopt records the current version without a restart, restart treats the missing version as outdated. Defaults to the policy of the operator
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=adopt;restart
+	FirstObservationPolicy string `json:"firstObservationPolicy,omitempty"`
+
+	// Upper bound in seconds for reconciling the workloads that consume the managed secret. When reached, the remaining workloads are reconciled on an immediate requeue.
+	// Defaults to the operator wide reconcile timeout
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum:=0
+	ReconcileTimeoutSeconds int `json:"reconcileTimeoutSeconds"`
+
+	// When enabled, workload references to the managed secret are matched regardless of the casing of the secret name
+	// +kubebuilder:validation:Optional
+	CaseInsensitiveSecretMatching *bool `json:"caseInsensitiveSecretMatching,omitempty"`
+
+	// Names of the containers scanned for references to the managed secret, so sidecars injected into every pod can be skipped. All containers are scanned when empty
+	// +kubebuilder:validation:Optional
+	ScanContainers []string `json:"scanContainers"`
+
+	// Additional namespaces whose workloads are restarted when the managed secret rotates. As secret references resolve within the namespace of a workload,
+	// workloads in these namespaces are only restarted when their namespace holds a replica of the managed secret with the same name and data
+	// +kubebuilder:validation:Optional
+	ReloadNamespaces []string `json:"reloadNamespaces"`
+
+	// When set, rotations of the managed secret only mark consuming workloads as pending a restart. All pending workloads are then
+	// restarted together the next time the schedule fires. Workloads without a pending rotation are not restarted
+	// +kubebuilder:validation:Optional
+	RestartSchedule *RestartSchedule `json:"restartSchedule,omitempty"`
+
+	// When enabled, a summary of each rotation that restarted workloads is also recorded as an event on the managed secret.
+	// At most one such event is recorded per managed secret every few minutes
+	// +kubebuilder:validation:Optional
+	RecordEventsOnManagedSecret bool `json:"recordEventsOnManagedSecret"`
+
+	// When enabled, the restarts required by a rotation are written as a reload plan to a ConfigMap instead of being performed.
+	// The operator executes exactly the planned restarts once the ConfigMap is annotated with secrets.infisical.com/reload-plan-approved=true
+	// +kubebuilder:validation:Optional
+	RequireReloadApproval bool `json:"requireReloadApproval"`
+
+	// Windows during which no workloads are restarted. Restarts required by rotations during a window are performed once all overlapping windows have closed
+	// +kubebuilder:validation:Optional
+	BlackoutWindows []TimeWindow `json:"blackoutWindows"`
+
+	// When set, a rotation restarts at most this many workloads at a time. The next batch is only restarted once all workloads of the previous batch
+	// finished rolling out the new secret, limiting the impact of a broken secret. 0 restarts all workloads at once
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum:=0
+	ReloadBatchSize int `json:"reloadBatchSize"`
+
+	// Seconds a batch has to become healthy before the next batch is restarted regardless, or the rollout is aborted when abortOnUnhealthyBatch is set. Defaults to 600
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum:=0
+	ReloadBatchHealthTimeoutSeconds int `json:"reloadBatchHealthTimeoutSeconds"`
+
+	// When enabled, the remaining batches of a rotation are not restarted once a batch failed to become healthy within the health timeout.
+	// They are restarted with the next version of the managed secret
+	// +kubebuilder:validation:Optional
+	AbortOnUnhealthyBatch bool `json:"abortOnUnhealthyBatch"`
+
+	// When enabled, Deployments restarted by the operator temporarily roll out with maxSurge of at least 1 and maxUnavailable 0, so pods with the new secret
+	// are ready before old ones terminate. The original strategy is restored once the rollout completed or failed. Deployments using the Recreate strategy are left as they are
+	// +kubebuilder:validation:Optional
+	SurgeRestarts bool `json:"surgeRestarts"`
+
+	// Job run before workloads are restarted for a new version of the managed secret. The restarts wait for it to complete and are aborted when it fails
+	// +kubebuilder:validation:Optional
+	PreRestartJob *RestartJob `json:"preRestartJob,omitempty"`
+
+	// Job run once the workloads restarted for a new version of the managed secret finished rolling it out
+	// +kubebuilder:validation:Optional
+	PostRestartJob *RestartJob `json:"postRestartJob,omitempty"`
+
+	// When enabled, workloads are restarted only through the kubectl.kubernetes.io/restartedAt annotation of their pod template and the secret version
+	// each workload was last reloaded at is tracked in the status of the InfisicalSecret, so no secrets.infisical.com annotations are written to workloads
+	// +kubebuilder:validation:Optional
+	RestartedAtOnly bool `json:"restartedAtOnly"`
+
+	// When set, the version that triggers restarts is extracted from a JSON value of the managed secret instead of its version annotation,
+	// so consumers only restart when the extracted version changes
+	// +kubebuilder:validation:Optional
+	VersionJSONPath *VersionJSONPath `json:"versionJSONPath,omitempty"`
+}
+
+type VersionJSONPath struct {
+	// Key of the managed secret holding a JSON document, e.g. config.json
+	Key string `json:"key"`
+	// JSONPath of the version within the JSON document, e.g. .version or {.metadata.revision}
+	Path string `json:"path"`
 }
 
 // InfisicalSecretStatus defines the observed state of InfisicalSecret
 type InfisicalSecretStatus struct {
 	Conditions []metav1.Condition `json:"conditions"`
+
+	// Workloads consuming the managed secret which failed to reload, with the error of the most recent attempt
+	// +kubebuilder:validation:Optional
+	FailedWorkloads []WorkloadError `json:"failedWorkloads,omitempty"`
+
+	// Workloads whose restart was held back in the latest reconcile, keyed by workload. Each hold is audited once, not on every resync
+	// +kubebuilder:validation:Optional
+	HeldWorkloads map[string]WorkloadHold `json:"heldWorkloads,omitempty"`
+
+	// When a blackout window is open, the time at which restarts will be permitted again
+	// +kubebuilder:validation:Optional
+	RestartsPermittedAt *metav1.Time `json:"restartsPermittedAt,omitempty"`
+
+	// Progress of restarting the workloads in batches, when reloadBatchSize is set
+	// +kubebuilder:validation:Optional
+	ReloadBatches *ReloadBatchStatus `json:"reloadBatches,omitempty"`
+
+	// Hashes of the keys of the managed secret, used to determine which keys changed when restarts are limited to consumed keys
+	// +kubebuilder:validation:Optional
+	SecretKeyHashes *SecretKeyHashes `json:"secretKeyHashes,omitempty"`
+
+	// Job run before the workloads were restarted for the latest version of the managed secret
+	// +kubebuilder:validation:Optional
+	PreRestartJob *RestartJobStatus `json:"preRestartJob,omitempty"`
+
+	// Job run after the workloads were restarted for the latest version of the managed secret
+	// +kubebuilder:validation:Optional
+	PostRestartJob *RestartJobStatus `json:"postRestartJob,omitempty"`
+
+	// Checksum of the data of the managed secret as of the last reconcile, when it carries no version annotation set by the operator.
+	// Only an HMAC-SHA256 is stored, never the values of the secret
+	// +kubebuilder:validation:Optional
+	ContentChecksum string `json:"contentChecksum,omitempty"`
+
+	// Version of the managed secret each workload was last restarted or adopted at, keyed by workload, when restartedAtOnly is enabled
+	// +kubebuilder:validation:Optional
+	ReloadedWorkloads map[string]string `json:"reloadedWorkloads,omitempty"`
+
+	// Workloads the operator recorded a version seal on. A workload in this list without a seal had it removed outside of the operator
+	// +kubebuilder:validation:Optional
+	SealedWorkloads []string `json:"sealedWorkloads,omitempty"`
+}
+
+type RestartJobStatus struct {
+	// Version of the managed secret the Job runs for
+	SecretVersion string `json:"secretVersion"`
+	// Name of the Job, empty while it has not been created yet
+	// +kubebuilder:validation:Optional
+	JobName string `json:"jobName,omitempty"`
+	// Pending, Running, Succeeded or Failed
+	Phase string `json:"phase"`
+	// Reason the Job failed
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+}
+
+type SecretKeyHashes struct {
+	// Version of the managed secret the hashes were computed for
+	SecretVersion string `json:"secretVersion"`
+	// Version of the managed secret the changed keys were computed against
+	// +kubebuilder:validation:Optional
+	PreviousSecretVersion string `json:"previousSecretVersion,omitempty"`
+	// HMAC-SHA256 of every key together with its value. Secret values are never stored
+	Keys map[string]string `json:"keys"`
+	// Keys that were added, removed or changed in the current version
+	// +kubebuilder:validation:Optional
+	ChangedKeys []string `json:"changedKeys,omitempty"`
+}
+
+type ReloadBatchStatus struct {
+	// Version of the managed secret the batches restart workloads for
+	SecretVersion string `json:"secretVersion"`
+	// InProgress, Complete or Aborted
+	Phase string `json:"phase"`
+	// Number of the latest batch that was restarted, starting at 1
+	CurrentBatch int `json:"currentBatch"`
+	// Number of batches needed to restart all workloads, based on the workloads still waiting for a batch
+	TotalBatches int `json:"totalBatches"`
+	// Workloads restarted as part of the latest batch
+	// +kubebuilder:validation:Optional
+	Workloads []string `json:"workloads"`
+	// Time at which the latest batch was restarted
+	// +kubebuilder:validation:Optional
+	StartedAt *metav1.Time `json:"startedAt,omitempty"`
+}
+
+type WorkloadError struct {
+	// Kind, namespace and name of the workload, such as Deployment/default/api
+	Workload string `json:"workload"`
+	Message  string `json:"message"`
+	// Number of consecutive reconciles in which the workload failed to reload
+	FailureCount int `json:"failureCount"`
+}
+
+type WorkloadHold struct {
+	// Version of the managed secret the restart was held back for
+	SecretVersion string `json:"secretVersion"`
+	// What held back the restart, such as maintenance, blackout or batch
+	Reason string `json:"reason"`
 }
 
 //+kubebuilder:object:root=true
@@ -49,7 +49,7 @@ func (in *InfisicalSecret) DeepCopyInto(out *InfisicalSecret) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -108,7 +108,57 @@ func (in *InfisicalSecretSpec) DeepCopyInto(out *InfisicalSecretSpec) {
 	*out = *in
 	out.TokenSecretReference = in.TokenSecretReference
 	out.Authentication = in.Authentication
-	out.ManagedSecretReference = in.ManagedSecretReference
+	in.ManagedSecretReference.DeepCopyInto(&out.ManagedSecretReference)
+	if in.PropagateSecretMetadata != nil {
+		in, out := &in.PropagateSecretMetadata, &out.PropagateSecretMetadata
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RestartOnlyOutdatedPods != nil {
+		in, out := &in.RestartOnlyOutdatedPods, &out.RestartOnlyOutdatedPods
+		*out = new(bool)
+		**out = **in
+	}
+	if in.CaseInsensitiveSecretMatching != nil {
+		in, out := &in.CaseInsensitiveSecretMatching, &out.CaseInsensitiveSecretMatching
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ScanContainers != nil {
+		in, out := &in.ScanContainers, &out.ScanContainers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ReloadNamespaces != nil {
+		in, out := &in.ReloadNamespaces, &out.ReloadNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RestartSchedule != nil {
+		in, out := &in.RestartSchedule, &out.RestartSchedule
+		*out = new(RestartSchedule)
+		**out = **in
+	}
+	if in.BlackoutWindows != nil {
+		in, out := &in.BlackoutWindows, &out.BlackoutWindows
+		*out = make([]TimeWindow, len(*in))
+		copy(*out, *in)
+	}
+	if in.PreRestartJob != nil {
+		in, out := &in.PreRestartJob, &out.PreRestartJob
+		*out = new(RestartJob)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PostRestartJob != nil {
+		in, out := &in.PostRestartJob, &out.PostRestartJob
+		*out = new(RestartJob)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.VersionJSONPath != nil {
+		in, out := &in.VersionJSONPath, &out.VersionJSONPath
+		*out = new(VersionJSONPath)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfisicalSecretSpec.
@@ -131,6 +181,54 @@ func (in *InfisicalSecretStatus) DeepCopyInto(out *InfisicalSecretStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.FailedWorkloads != nil {
+		in, out := &in.FailedWorkloads, &out.FailedWorkloads
+		*out = make([]WorkloadError, len(*in))
+		copy(*out, *in)
+	}
+	if in.HeldWorkloads != nil {
+		in, out := &in.HeldWorkloads, &out.HeldWorkloads
+		*out = make(map[string]WorkloadHold, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.RestartsPermittedAt != nil {
+		in, out := &in.RestartsPermittedAt, &out.RestartsPermittedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.ReloadBatches != nil {
+		in, out := &in.ReloadBatches, &out.ReloadBatches
+		*out = new(ReloadBatchStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretKeyHashes != nil {
+		in, out := &in.SecretKeyHashes, &out.SecretKeyHashes
+		*out = new(SecretKeyHashes)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PreRestartJob != nil {
+		in, out := &in.PreRestartJob, &out.PreRestartJob
+		*out = new(RestartJobStatus)
+		**out = **in
+	}
+	if in.PostRestartJob != nil {
+		in, out := &in.PostRestartJob, &out.PostRestartJob
+		*out = new(RestartJobStatus)
+		**out = **in
+	}
+	if in.ReloadedWorkloads != nil {
+		in, out := &in.ReloadedWorkloads, &out.ReloadedWorkloads
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.SealedWorkloads != nil {
+		in, out := &in.SealedWorkloads, &out.SealedWorkloads
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfisicalSecretStatus.
@@ -176,6 +274,11 @@ func (in *MachineIdentityScopeInWorkspace) DeepCopy() *MachineIdentityScopeInWor
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MangedKubeSecretConfig) DeepCopyInto(out *MangedKubeSecretConfig) {
 	*out = *in
+	if in.PreviousNames != nil {
+		in, out := &in.PreviousNames, &out.PreviousNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MangedKubeSecretConfig.
@@ -188,6 +291,103 @@ func (in *MangedKubeSecretConfig) DeepCopy() *MangedKubeSecretConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReloadBatchStatus) DeepCopyInto(out *ReloadBatchStatus) {
+	*out = *in
+	if in.Workloads != nil {
+		in, out := &in.Workloads, &out.Workloads
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.StartedAt != nil {
+		in, out := &in.StartedAt, &out.StartedAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReloadBatchStatus.
+func (in *ReloadBatchStatus) DeepCopy() *ReloadBatchStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ReloadBatchStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestartJob) DeepCopyInto(out *RestartJob) {
+	*out = *in
+	in.JobTemplate.DeepCopyInto(&out.JobTemplate)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestartJob.
+func (in *RestartJob) DeepCopy() *RestartJob {
+	if in == nil {
+		return nil
+	}
+	out := new(RestartJob)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestartJobStatus) DeepCopyInto(out *RestartJobStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestartJobStatus.
+func (in *RestartJobStatus) DeepCopy() *RestartJobStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RestartJobStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestartSchedule) DeepCopyInto(out *RestartSchedule) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestartSchedule.
+func (in *RestartSchedule) DeepCopy() *RestartSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(RestartSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretKeyHashes) DeepCopyInto(out *SecretKeyHashes) {
+	*out = *in
+	if in.Keys != nil {
+		in, out := &in.Keys, &out.Keys
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ChangedKeys != nil {
+		in, out := &in.ChangedKeys, &out.ChangedKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretKeyHashes.
+func (in *SecretKeyHashes) DeepCopy() *SecretKeyHashes {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretKeyHashes)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecretScopeInWorkspace) DeepCopyInto(out *SecretScopeInWorkspace) {
 	*out = *in
@@ -236,6 +436,21 @@ func (in *ServiceTokenDetails) DeepCopy() *ServiceTokenDetails {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TimeWindow) DeepCopyInto(out *TimeWindow) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TimeWindow.
+func (in *TimeWindow) DeepCopy() *TimeWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(TimeWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *UniversalAuthDetails) DeepCopyInto(out *UniversalAuthDetails) {
 	*out = *in
@@ -252,3 +467,48 @@ func (in *UniversalAuthDetails) DeepCopy() *UniversalAuthDetails {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VersionJSONPath) DeepCopyInto(out *VersionJSONPath) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VersionJSONPath.
+func (in *VersionJSONPath) DeepCopy() *VersionJSONPath {
+	if in == nil {
+		return nil
+	}
+	out := new(VersionJSONPath)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkloadError) DeepCopyInto(out *WorkloadError) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkloadError.
+func (in *WorkloadError) DeepCopy() *WorkloadError {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkloadError)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkloadHold) DeepCopyInto(out *WorkloadHold) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkloadHold.
+func (in *WorkloadHold) DeepCopy() *WorkloadHold {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkloadHold)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Prefixes that earlier operator versions used for the secret version annotation. Each is followed by the name of the managed secret, like the current prefix.
+// Add the previous prefix here whenever DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX changes, so upgrading the operator does not restart every consuming workload.
+// The prefix has not changed since the operator started recording versions, so there are none yet
+var LEGACY_DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIXES = []string{}
+
+// Returns the legacy version annotation key found in the annotations together with its value, preferring the most recent format
+func getLegacySecretVersionAnnotation(annotations map[string]string, secretName string) (key string, value string, found bool) {
+	for _, prefix := range LEGACY_DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIXES {
+		legacyKey := fmt.Sprintf("%s.%s", prefix, secretName)
+		if legacyValue, exists := annotations[legacyKey]; exists {
+			return legacyKey, legacyValue, true
+		}
+	}
+	return "", "", false
+}
+
+// Moves a secret version recorded under a legacy annotation key on the workload to the current key, so the version comparison keeps working after an upgrade.
+// When annotations are consolidated, versions recorded per secret are moved into the state annotation, and back when the consolidation is turned off.
+// Only the workload's own annotations are migrated. The pod template is left as is (changing it would restart the pods) and is cleaned up on the next restart
+func (r *InfisicalSecretReconciler) MigrateLegacyWorkloadAnnotations(ctx context.Context, workload Workload, secret corev1.Secret) error {
+	annotationKey := fmt.Sprintf("%s.%s", DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX, secret.Name)
+
+	legacyKey, legacyValue, found := getLegacySecretVersionAnnotation(workload.Metadata.Annotations, secret.Name)
+	if found {
+		if _, hasCurrentKey := workload.Metadata.Annotations[annotationKey]; !hasCurrentKey {
+			workload.Metadata.Annotations[annotationKey] = legacyValue
+		}
+		delete(workload.Metadata.Annotations, legacyKey)
+	}
+
+	misplaced := r.isSecretVersionMisplaced(workload, secret.Name)
+	if misplaced {
+		recordedVersion, _ := r.GetRecordedSecretVersion(workload, secret.Name)
+		r.recordSecretVersion(workload, secret.Name, recordedVersion)
+	}
+
+	if !found && !misplaced {
+		return nil
+	}
+
+	if err := r.Client.Update(ctx, workload.Object); err != nil {
+		return fmt.Errorf("unable to migrate the secret version annotations of [workload=%v] [err=%w]", workload.Ref(), err)
+	}
+
+	if found {
+		fmt.Printf("Migrated legacy annotation [key=%v] of [workload=%v] to [key=%v]\n", legacyKey, workload.Ref(), annotationKey)
+	}
+	if misplaced {
+		fmt.Printf("Moved the version of [secret=%v] on [workload=%v] to the annotation in use [consolidated=%v]\n", secret.Name, workload.Ref(), r.ConsolidateWorkloadAnnotations)
+	}
+	return nil
+}
+
+// Removes the legacy version annotations from the pod template of a workload which is being restarted anyway
+func removeLegacyPodTemplateAnnotations(workload Workload, secretName string) {
+	for _, prefix := range LEGACY_DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIXES {
+		delete(workload.PodTemplate.Annotations, fmt.Sprintf("%s.%s", prefix, secretName))
+	}
+}
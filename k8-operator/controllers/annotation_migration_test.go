@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestUpgradeFromLegacyAnnotationKeyDoesNotRestart(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	// no prefix was ever retired, so the mechanism is tested with one as it would be added after renaming the annotation
+	previousPrefixes := LEGACY_DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIXES
+	LEGACY_DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIXES = []string{"secrets.infisical.com/previous-managed-secret"}
+	t.Cleanup(func() { LEGACY_DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIXES = previousPrefixes })
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+	legacyVersionKey := LEGACY_DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIXES[0] + ".managed-secret"
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	// deployments as they were left behind by an operator version using the legacy annotation key
+	legacyDeployment := func(name string, version string) *v1.Deployment {
+		deployment := &v1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", legacyVersionKey: version},
+			},
+		}
+		deployment.Spec.Template.Annotations = map[string]string{legacyVersionKey: version}
+		deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+			Name: "app",
+			EnvFrom: []corev1.EnvFromSource{{
+				SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+			}},
+		}}
+		return deployment
+	}
+
+	r := newTestReconciler(managedSecret, legacyDeployment("current", "v2"), legacyDeployment("outdated", "v1"))
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 2, Restarted: 1}))
+
+	current := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "current"}, current)).To(Succeed())
+	g.Expect(current.Annotations).To(HaveKeyWithValue(versionKey, "v2"))
+	g.Expect(current.Annotations).NotTo(HaveKey(legacyVersionKey))
+	// the pod template is untouched, so the pods are not restarted
+	g.Expect(current.Spec.Template.Annotations).To(Equal(map[string]string{legacyVersionKey: "v2"}))
+
+	outdated := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "outdated"}, outdated)).To(Succeed())
+	g.Expect(outdated.Spec.Template.Annotations).To(HaveKeyWithValue(versionKey, "v2"))
+	g.Expect(outdated.Spec.Template.Annotations).To(HaveKeyWithValue(DEPLOYMENT_RELOAD_REASON_ANNOTATION, RELOAD_REASON_DATA_CHANGED))
+	g.Expect(outdated.Spec.Template.Annotations).NotTo(HaveKey(legacyVersionKey))
+}
+
+func TestConsolidatedWorkloadAnnotations(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v1"},
+		},
+	}
+
+	// reconciled with one annotation per secret, and already consuming another secret recorded in the state
+	deployment := &v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "api",
+			Namespace: "default",
+			Annotations: map[string]string{
+				AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true",
+				versionKey:                        "v1",
+				WORKLOAD_STATE_ANNOTATION:         `{"other-secret":"v7"}`,
+			},
+		},
+	}
+	deployment.Spec.Template.Annotations = map[string]string{versionKey: "v1"}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "api",
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+		}},
+	}}
+
+	r := newTestReconciler(managedSecret, deployment)
+	r.ConsolidateWorkloadAnnotations = true
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	reconciledDeployment := func() *v1.Deployment {
+		reconciled := &v1.Deployment{}
+		g.Expect(r.Client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "api"}, reconciled)).To(Succeed())
+		return reconciled
+	}
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1}))
+	g.Expect(reconciledDeployment().Annotations).NotTo(HaveKey(versionKey))
+	g.Expect(reconciledDeployment().Annotations[WORKLOAD_STATE_ANNOTATION]).To(Equal(`{"managed-secret":"v1","other-secret":"v7"}`))
+
+	managedSecret.Annotations[SECRET_VERSION_ANNOTATION] = "v2"
+	g.Expect(r.Client.Update(ctx, managedSecret)).To(Succeed())
+
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Restarted: 1}))
+	g.Expect(reconciledDeployment().Annotations[WORKLOAD_STATE_ANNOTATION]).To(Equal(`{"managed-secret":"v2","other-secret":"v7"}`))
+	g.Expect(reconciledDeployment().Spec.Template.Annotations[versionKey]).To(Equal("v2"))
+
+	// turning the consolidation off moves the version back without restarting
+	r.ConsolidateWorkloadAnnotations = false
+
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1}))
+	g.Expect(reconciledDeployment().Annotations[versionKey]).To(Equal("v2"))
+	g.Expect(reconciledDeployment().Annotations[WORKLOAD_STATE_ANNOTATION]).To(Equal(`{"other-secret":"v7"}`))
+}
+
+func TestWorkloadConsumingTwoManagedSecretsRestartsOnce(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	newManagedSecret := func(name string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v1"},
+			},
+		}
+	}
+	firstSecret, secondSecret := newManagedSecret("first-secret"), newManagedSecret("second-secret")
+
+	deployment := &v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "api",
+			Namespace: "default",
+			Annotations: map[string]string{
+				AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true",
+				WORKLOAD_STATE_ANNOTATION:         `{"first-secret":"v1","second-secret":"v1"}`,
+			},
+		},
+	}
+	deployment.Spec.Template.Annotations = map[string]string{
+		DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".first-secret":  "v1",
+		DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".second-secret": "v1",
+	}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "api",
+		EnvFrom: []corev1.EnvFromSource{
+			{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "first-secret"}}},
+			{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "second-secret"}}},
+		},
+	}}
+
+	r := newTestReconciler(firstSecret, secondSecret, deployment)
+	r.ConsolidateWorkloadAnnotations = true
+
+	newInfisicalSecret := func(managedSecretName string) secretsv1alpha1.InfisicalSecret {
+		infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+		infisicalSecret.Spec.ManagedSecretReference.SecretName = managedSecretName
+		infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+		return infisicalSecret
+	}
+
+	reconcileBoth := func() WorkloadCounts {
+		total := WorkloadCounts{}
+		for _, infisicalSecret := range []secretsv1alpha1.InfisicalSecret{newInfisicalSecret("first-secret"), newInfisicalSecret("second-secret")} {
+			outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+			g.Expect(err).NotTo(HaveOccurred())
+			total.Matched += outcome.Total.Matched
+			total.Restarted += outcome.Total.Restarted
+		}
+		return total
+	}
+
+	firstSecret.Annotations[SECRET_VERSION_ANNOTATION] = "v2"
+	g.Expect(r.Client.Update(ctx, firstSecret)).To(Succeed())
+
+	// the versions of both secrets are recorded in the state of the workload, so only the rotated one restarts it
+	g.Expect(reconcileBoth()).To(Equal(WorkloadCounts{Matched: 2, Restarted: 1}))
+
+	reconciled := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "api"}, reconciled)).To(Succeed())
+	g.Expect(reconciled.Annotations[WORKLOAD_STATE_ANNOTATION]).To(Equal(`{"first-secret":"v2","second-secret":"v1"}`))
+
+	g.Expect(reconcileBoth()).To(Equal(WorkloadCounts{Matched: 2}))
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	"github.com/Infisical/infisical/k8-operator/packages/audit"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// What held back the restart of an outdated workload in a reconcile
+const HOLD_REASON_APPROVAL = "approval"
+const HOLD_REASON_NOT_APPROVED = "notApproved"
+const HOLD_REASON_MAINTENANCE = "maintenance"
+const HOLD_REASON_BLACKOUT = "blackout"
+const HOLD_REASON_SCHEDULE = "schedule"
+const HOLD_REASON_DEPENDENCY = "dependency"
+const HOLD_REASON_PRE_RESTART_JOB = "preRestartJob"
+const HOLD_REASON_PRE_RESTART_FAILED = "preRestartJobFailed"
+const HOLD_REASON_BATCH = "batch"
+const HOLD_REASON_PERMISSION = "permission"
+
+// Writes a restart decision for an outdated workload to the audit sink, if one is configured.
+// Workloads that are already up to date are not audited as no decision is made for them
+func (r *InfisicalSecretReconciler) AuditRestartDecision(infisicalSecret v1alpha1.InfisicalSecret, workload Workload, previousVersion string, newVersion string, decision string, errorToAudit error) {
+	r.auditRestartDecision(infisicalSecret, workload, previousVersion, newVersion, decision, "", errorToAudit)
+}
+
+// Records that the restart of the workload was deferred or skipped for the given reason, and audits it. Holds are re-evaluated on every resync,
+// so a hold is only audited when the workload was not already held back for the same version and reason in the previous reconcile
+func (r *InfisicalSecretReconciler) AuditRestartHold(infisicalSecret v1alpha1.InfisicalSecret, outcome *ReconcileOutcome, workload Workload, secret corev1.Secret, decision string, reason string) {
+	hold := v1alpha1.WorkloadHold{SecretVersion: secret.Annotations[SECRET_VERSION_ANNOTATION], Reason: reason}
+	if outcome.HeldWorkloads != nil {
+		outcome.HeldWorkloads[workload.Ref()] = hold
+	}
+
+	if previousHold, isHeld := infisicalSecret.Status.HeldWorkloads[workload.Ref()]; isHeld && previousHold == hold {
+		return
+	}
+
+	previousVersion, _ := r.GetRecordedSecretVersion(workload, secret.Name)
+	if infisicalSecret.Spec.RestartedAtOnly {
+		previousVersion = infisicalSecret.Status.ReloadedWorkloads[workload.Ref()]
+	}
+	r.auditRestartDecision(infisicalSecret, workload, previousVersion, hold.SecretVersion, decision, reason, nil)
+}
+
+func (r *InfisicalSecretReconciler) auditRestartDecision(infisicalSecret v1alpha1.InfisicalSecret, workload Workload, previousVersion string, newVersion string, decision string, reason string, errorToAudit error) {
+	if r.AuditSink == nil {
+		return
+	}
+
+	record := audit.Record{
+		InfisicalSecret: fmt.Sprintf("%s/%s", infisicalSecret.Namespace, infisicalSecret.Name),
+		Workload:        workload.Ref(),
+		PreviousVersion: previousVersion,
+		NewVersion:      newVersion,
+		Decision:        decision,
+		Outcome:         audit.OUTCOME_SUCCESS,
+		Reason:          reason,
+	}
+
+	if errorToAudit != nil {
+		record.Outcome = audit.OUTCOME_FAILURE
+		record.Message = errorToAudit.Error()
+	}
+
+	if err := r.AuditSink.Write(record); err != nil {
+		fmt.Printf("unable to write audit record for [workload=%v] [err=%v]\n", workload.Ref(), err)
+	}
+}
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	"github.com/Infisical/infisical/k8-operator/packages/audit"
+)
+
+type recordingSink struct {
+	mutex   sync.Mutex
+	records []audit.Record
+}
+
+func (s *recordingSink) Write(record audit.Record) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+func TestRestartHoldsAreAuditedOncePerVersionAndReason(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	deployment := &v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "api",
+			Namespace:   "default",
+			Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1"},
+		},
+	}
+	deployment.Spec.Template.Annotations = map[string]string{versionKey: "v1"}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "api",
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+		}},
+	}}
+
+	r := newTestReconciler(managedSecret, deployment)
+	sink := &recordingSink{}
+	r.AuditSink = sink
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+	infisicalSecret.Spec.BlackoutWindows = []secretsv1alpha1.TimeWindow{{
+		Start: time.Now().Add(-time.Hour).UTC().Format(time.RFC3339),
+		End:   time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	}}
+
+	reconcile := func() {
+		outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Deferred: 1}))
+		infisicalSecret.Status.HeldWorkloads = outcome.HeldWorkloads
+	}
+
+	// every resync holds the workload back again, but only the first hold is audited
+	reconcile()
+	reconcile()
+	g.Expect(sink.records).To(HaveLen(1))
+	g.Expect(sink.records[0].Decision).To(Equal(audit.DECISION_DEFERRED))
+	g.Expect(sink.records[0].Reason).To(Equal(HOLD_REASON_BLACKOUT))
+	g.Expect(sink.records[0].PreviousVersion).To(Equal("v1"))
+	g.Expect(sink.records[0].NewVersion).To(Equal("v2"))
+	g.Expect(infisicalSecret.Status.HeldWorkloads).To(Equal(map[string]secretsv1alpha1.WorkloadHold{
+		"Deployment/default/api": {SecretVersion: "v2", Reason: HOLD_REASON_BLACKOUT},
+	}))
+
+	// a different reason of the hold is audited
+	infisicalSecret.Spec.BlackoutWindows = nil
+	infisicalSecret.Spec.RequireReloadApproval = true
+	reconcile()
+	reconcile()
+	g.Expect(sink.records).To(HaveLen(2))
+	g.Expect(sink.records[1].Reason).To(Equal(HOLD_REASON_APPROVAL))
+
+	// so is a hold for the next version
+	managedSecret.Annotations[SECRET_VERSION_ANNOTATION] = "v3"
+	g.Expect(r.Client.Update(ctx, managedSecret)).To(Succeed())
+	reconcile()
+	g.Expect(sink.records).To(HaveLen(3))
+	g.Expect(sink.records[2].NewVersion).To(Equal("v3"))
+
+	// the restart is audited once it goes ahead, and the workload is no longer held
+	infisicalSecret.Spec.RequireReloadApproval = false
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Restarted: 1}))
+	g.Expect(outcome.HeldWorkloads).To(BeEmpty())
+	g.Expect(sink.records).To(HaveLen(4))
+	g.Expect(sink.records[3].Decision).To(Equal(audit.DECISION_RESTARTED))
+
+	restartedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(deployment), restartedDeployment)).To(Succeed())
+	g.Expect(restartedDeployment.Spec.Template.Annotations[versionKey]).To(Equal("v3"))
+}
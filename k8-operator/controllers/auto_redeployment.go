@@ -2,24 +2,49 @@ package controllers
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
-	v1 "k8s.io/api/apps/v1"
+	"github.com/Infisical/infisical/k8-operator/packages/audit"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX = "secrets.infisical.com/managed-secret"
-const AUTO_RELOAD_DEPLOYMENT_ANNOTATION = "secrets.infisical.com/auto-reload" // needs to be set to true for a deployment to start auto redeploying
+const AUTO_RELOAD_DEPLOYMENT_ANNOTATION = "secrets.infisical.com/auto-reload"                        // needs to be set to true for a deployment to start auto redeploying
+const DEPLOYMENT_SECRET_IDENTITY_ANNOTATION_PREFIX = "secrets.infisical.com/managed-secret-identity" // type and UID of the managed secret the workload was last restarted for
+const DEPLOYMENT_RELOAD_REASON_ANNOTATION = "secrets.infisical.com/reload-reason"
+const FORCE_RELOAD_DEPLOYMENT_ANNOTATION = "secrets.infisical.com/force-reload" // can be set to true to restart a deployment once, regardless of the secret version
+const RESTARTED_AT_ANNOTATION = "kubectl.kubernetes.io/restartedAt"
+const MIN_SECRET_VALUE_LENGTH_FOR_LEAK_CHECK = 4 // shorter secret values are too common to reliably detect in propagated metadata
 
-func (r *InfisicalSecretReconciler) ReconcileDeploymentsWithManagedSecrets(ctx context.Context, infisicalSecret v1alpha1.InfisicalSecret) (int, error) {
-	listOfDeployments := &v1.DeploymentList{}
-	err := r.Client.List(ctx, listOfDeployments, &client.ListOptions{Namespace: infisicalSecret.Spec.ManagedSecretReference.SecretNamespace})
-	if err != nil {
-		return 0, fmt.Errorf("unable to get deployments in the [namespace=%v] [err=%v]", infisicalSecret.Spec.ManagedSecretReference.SecretNamespace, err)
+// Version of the managed secret whose restart was skipped because the pods of the workload were created after it
+const DEPLOYMENT_SKIPPED_RESTART_ANNOTATION_PREFIX = "secrets.infisical.com/skipped-restart"
+
+// What happens to workloads that never recorded a version of the managed secret
+const FIRST_OBSERVATION_POLICY_ADOPT = "adopt"
+const FIRST_OBSERVATION_POLICY_RESTART = "restart"
+
+// Restarts the Deployments, StatefulSets and DaemonSets with auto reload enabled that consume an outdated version of the managed secret
+func (r *InfisicalSecretReconciler) ReconcileWorkloadsWithManagedSecrets(ctx context.Context, infisicalSecret v1alpha1.InfisicalSecret) (ReconcileOutcome, error) {
+	outcome := ReconcileOutcome{}
+
+	reconcileTimeout := r.DefaultReconcileTimeout
+	if infisicalSecret.Spec.ReconcileTimeoutSeconds > 0 {
+		reconcileTimeout = time.Duration(infisicalSecret.Spec.ReconcileTimeoutSeconds) * time.Second
+	}
+
+	if reconcileTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, reconcileTimeout)
+		defer cancel()
 	}
 
 	managedKubeSecretNameAndNamespace := types.NamespacedName{
@@ -28,79 +53,938 @@ func (r *InfisicalSecretReconciler) ReconcileDeploymentsWithManagedSecrets(ctx c
 	}
 
 	managedKubeSecret := &corev1.Secret{}
-	err = r.Client.Get(ctx, managedKubeSecretNameAndNamespace, managedKubeSecret)
+	err := r.Client.Get(ctx, managedKubeSecretNameAndNamespace, managedKubeSecret)
+	if err != nil {
+		return outcome, fmt.Errorf("unable to fetch Kubernetes secret to update workloads: %w", err)
+	}
+
+	if err := r.useJSONPathAsVersion(managedKubeSecret, infisicalSecret); err != nil {
+		r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeWarning, "VersionExtractionFailed", "Unable to extract the version of managed secret %v, no workloads are restarted until it can be extracted: %v", managedKubeSecret.Name, err)
+		return outcome, err
+	}
+
+	if r.useContentChecksumAsVersion(managedKubeSecret) {
+		outcome.ContentChecksum = managedKubeSecret.Annotations[SECRET_VERSION_ANNOTATION]
+
+		if previousChecksum := infisicalSecret.Status.ContentChecksum; previousChecksum != "" && previousChecksum != outcome.ContentChecksum {
+			fmt.Printf("data of managed secret [name=%v] without a version annotation changed. Reconciling its consumers\n", managedKubeSecret.Name)
+			r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeNormal, "ContentChecksumChanged", "Data of managed secret %v changed. It carries no version annotation, so its consumers are restarted based on its content checksum", managedKubeSecret.Name)
+		}
+	}
+
+	if infisicalSecret.Spec.RestartOnlyForConsumedKeys {
+		outcome.SecretKeyHashes = r.GetSecretKeyHashes(infisicalSecret.Status.SecretKeyHashes, *managedKubeSecret)
+		// workloads reconciled below read the keys changed in the current version from the status
+		infisicalSecret.Status.SecretKeyHashes = outcome.SecretKeyHashes
+	}
+
+	reloadNamespaces, err := r.GetReplicatedReloadNamespaces(ctx, infisicalSecret, *managedKubeSecret)
+	if err != nil {
+		return outcome, err
+	}
+
+	workloads, err := r.ListReloadableWorkloads(ctx, reloadNamespaces)
+	if err != nil {
+		return outcome, err
+	}
+
+	clusterUnderMaintenance := false
+	maintenanceReason := ""
+	if r.DeferRestartsDuringDrain {
+		clusterUnderMaintenance, maintenanceReason, err = r.IsClusterUnderMaintenance(ctx)
+		if err != nil {
+			return outcome, err
+		}
+	}
+
+	if err := r.ValidateRestartJobs(infisicalSecret); err != nil {
+		r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeWarning, "RestartJobsDisabled", "%v", err)
+		return outcome, err
+	}
+
+	restartSchedule, err := GetRestartSchedule(infisicalSecret)
+	if err != nil {
+		return outcome, err
+	}
+	now := time.Now()
+
+	blackoutWindows, err := GetBlackoutWindows(infisicalSecret)
+	if err != nil {
+		return outcome, err
+	}
+	outcome.RestartsPermittedAt = GetRestartsPermittedAt(blackoutWindows, now)
+
+	var approvedPlan *ReloadPlan
+	pendingPlan := ReloadPlan{
+		InfisicalSecret: fmt.Sprintf("%s/%s", infisicalSecret.Namespace, infisicalSecret.Name),
+		SecretVersion:   managedKubeSecret.Annotations[SECRET_VERSION_ANNOTATION],
+	}
+	if infisicalSecret.Spec.RequireReloadApproval {
+		plan, approved, err := r.GetReloadPlan(ctx, infisicalSecret, *managedKubeSecret)
+		if err != nil {
+			return outcome, err
+		}
+
+		if approved {
+			approvedPlan = plan
+		}
+	}
+
+	var matchedWorkloads []Workload
+	var unmatchedReloadWorkloads []Workload
+	var deprecatedReferences []string
+	for _, workload := range workloads {
+		if workload.Metadata.Annotations[AUTO_RELOAD_DEPLOYMENT_ANNOTATION] != "true" {
+			continue
+		}
+
+		if !r.IsWorkloadUsingManagedSecret(workload, infisicalSecret) {
+			unmatchedReloadWorkloads = append(unmatchedReloadWorkloads, workload)
+			continue
+		}
+
+		matchedWorkloads = append(matchedWorkloads, workload)
+		outcome.record(workload.Kind, WorkloadCounts{Matched: 1})
+
+		if deprecatedNames := r.GetDeprecatedSecretReferences(*workload.PodTemplate, infisicalSecret); len(deprecatedNames) > 0 {
+			deprecatedReferences = append(deprecatedReferences, fmt.Sprintf("%s (%s)", workload.Ref(), strings.Join(deprecatedNames, ", ")))
+		}
+	}
+
+	// workloads consuming the secret of another InfisicalSecret are not misconfigured, so only the ones no InfisicalSecret reloads are reported
+	checkedNamespaces := r.claimReloadAnnotationChecks(reloadNamespaces, time.Now())
+	misconfiguredWorkloads, err := r.GetMisconfiguredReloadWorkloads(ctx, filterWorkloadsByNamespace(unmatchedReloadWorkloads, checkedNamespaces))
 	if err != nil {
-		return 0, fmt.Errorf("unable to fetch Kubernetes secret to update deployment: %v", err)
+		fmt.Println(err)
+	} else {
+		recordMisconfiguredReloadAnnotations(checkedNamespaces, misconfiguredWorkloads)
+
+		if len(misconfiguredWorkloads) > 0 {
+			var misconfiguredRefs []string
+			for _, workload := range misconfiguredWorkloads {
+				misconfiguredRefs = append(misconfiguredRefs, workload.Ref())
+			}
+			fmt.Printf("workloads enable auto reload but consume no managed secret [workloads=%v]\n", misconfiguredRefs)
+			r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeWarning, "MisconfiguredReloadAnnotation", "%v workload(s) carry the %v annotation but consume the secret of no InfisicalSecret, so they are never restarted: %v", len(misconfiguredRefs), AUTO_RELOAD_DEPLOYMENT_ANNOTATION, strings.Join(misconfiguredRefs, ", "))
+		}
 	}
 
+	if len(deprecatedReferences) > 0 {
+		fmt.Printf("workloads reference previous names of the managed secret [secret=%v] [workloads=%v]\n", managedKubeSecret.Name, deprecatedReferences)
+		r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeWarning, "DeprecatedSecretName", "%v workload(s) still reference a previous name of managed secret %v and should be updated: %v", len(deprecatedReferences), managedKubeSecret.Name, strings.Join(deprecatedReferences, ", "))
+	}
+
+	// dependency waves and reload batches keep this order, so within them the most recently changed workloads are reconciled first
+	SortWorkloadsByLastModified(matchedWorkloads)
+
+	fingerprints := newPodSpecFingerprints(matchedWorkloads)
+	for i := range matchedWorkloads {
+		matchedWorkloads[i].fingerprints = fingerprints
+	}
+
+	for _, sharedPodSpec := range fingerprints.GetSharedPodSpecs(matchedWorkloads) {
+		fmt.Printf("[workloads=%v] share an identical pod spec. The fingerprint of the managed secret is computed once for all of them\n", sharedPodSpec)
+	}
+
+	if infisicalSecret.Spec.RestartedAtOnly {
+		outcome.ReloadedWorkloads = GetReloadedWorkloads(infisicalSecret.Status.ReloadedWorkloads, matchedWorkloads)
+	} else {
+		outcome.SealedWorkloads = GetSealedWorkloads(infisicalSecret.Status.SealedWorkloads, matchedWorkloads, managedKubeSecret.Name)
+	}
+
+	waves, err := OrderWorkloadsByDependencies(matchedWorkloads)
+	if err != nil {
+		r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeWarning, "DependencyCycle", "Unable to restart workloads in dependency order: %v", err)
+		return outcome, err
+	}
+
+	dependedOnWorkloads := map[string]bool{}
+	for _, workload := range matchedWorkloads {
+		for _, dependency := range getWorkloadDependencies(workload, matchedWorkloads) {
+			dependedOnWorkloads[dependency.Ref()] = true
+		}
+	}
+
+	annotationKey := fmt.Sprintf("%s.%s", DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX, managedKubeSecret.Name)
+	permissions := newWorkloadPermissionCache()
+
+	batchSlots := 0
+	var batchWorkloads []string
+	batchWaitingWorkloads := 0
+	if infisicalSecret.Spec.ReloadBatchSize > 0 {
+		outcome.ReloadBatches, batchSlots = r.GetReloadBatchSlots(ctx, infisicalSecret, matchedWorkloads, annotationKey, managedKubeSecret.Annotations[SECRET_VERSION_ANNOTATION], now)
+	}
+	// workloads that are on the current version of the managed secret and finished rolling it out, so their dependents can be restarted
+	settledWorkloads := map[string]bool{}
+	outcome.HeldWorkloads = map[string]v1alpha1.WorkloadHold{}
+
 	var wg sync.WaitGroup
-	// Iterate over the deployments and check if they use the managed secret
-	for _, deployment := range listOfDeployments.Items {
-		deployment := deployment
-		if deployment.Annotations[AUTO_RELOAD_DEPLOYMENT_ANNOTATION] == "true" && r.IsDeploymentUsingManagedSecret(deployment, infisicalSecret) {
-			// Start a goroutine to reconcile the deployment
+	var deferredWorkloads []string
+	var scheduledWorkloads []string
+	var blackoutWorkloads []string
+	var completedWorkloads int
+	// Reconcile the workloads wave by wave so a workload is only restarted after the workloads it depends on
+	for _, wave := range waves {
+		waveResults := make(chan workloadResult, len(wave))
+		for _, workload := range wave {
+			if ctx.Err() != nil {
+				// workloads that were not reached are picked up on the next requeue. Completed ones carry the new version annotation and are skipped then
+				break
+			}
+
+			if err := r.MigrateLegacyWorkloadAnnotations(ctx, workload, *managedKubeSecret); err != nil {
+				fmt.Println(err)
+				outcome.recordFailure(workload, err)
+				continue
+			}
+
+			if err := r.RestoreSurgeStrategy(ctx, workload, annotationKey, infisicalSecret); err != nil {
+				fmt.Println(err)
+				outcome.recordFailure(workload, err)
+				continue
+			}
+
+			reloadReason := r.GetReloadReason(workload, *managedKubeSecret, infisicalSecret)
+			// workloads that are up to date are not updated, so only the ones about to be restarted or adopted need the permission
+			if reloadReason != "" && r.PreflightWorkloadPermissions && !r.CanUpdateWorkload(ctx, permissions, workload) {
+				outcome.record(workload.Kind, WorkloadCounts{Skipped: 1})
+				r.AuditRestartHold(infisicalSecret, &outcome, workload, *managedKubeSecret, audit.DECISION_SKIPPED, HOLD_REASON_PERMISSION)
+				continue
+			}
+
+			if reloadReason == "" || r.shouldAdoptWorkload(reloadReason, infisicalSecret) {
+				if dependedOnWorkloads[workload.Ref()] {
+					settled, err := r.isWorkloadSettled(ctx, workload, infisicalSecret, annotationKey, managedKubeSecret.Annotations[SECRET_VERSION_ANNOTATION])
+					if err != nil {
+						fmt.Printf("unable to check if [workload=%v] settled on the managed secret. Holding back its dependents [err=%v]\n", workload.Ref(), err)
+					}
+					settledWorkloads[workload.Ref()] = settled
+				}
+			} else if unsettledDependencies := getUnsettledDependencies(getWorkloadDependencies(workload, matchedWorkloads), settledWorkloads); len(unsettledDependencies) > 0 {
+				// the workload is picked up again once its dependencies finished rolling out the new version
+				fmt.Printf("[workload=%v] depends on [workloads=%v] which did not finish rolling out the managed secret yet. Deferring restart\n", workload.Ref(), unsettledDependencies)
+				outcome.record(workload.Kind, WorkloadCounts{Deferred: 1})
+				r.AuditRestartHold(infisicalSecret, &outcome, workload, *managedKubeSecret, audit.DECISION_DEFERRED, HOLD_REASON_DEPENDENCY)
+				continue
+			}
+
+			if infisicalSecret.Spec.RequireReloadApproval && reloadReason != "" && !r.shouldAdoptWorkload(reloadReason, infisicalSecret) {
+				if approvedPlan == nil {
+					pendingPlan.Workloads = append(pendingPlan.Workloads, PlannedReload{Workload: workload.Ref(), Reason: reloadReason})
+					outcome.record(workload.Kind, WorkloadCounts{Deferred: 1})
+					r.AuditRestartHold(infisicalSecret, &outcome, workload, *managedKubeSecret, audit.DECISION_DEFERRED, HOLD_REASON_APPROVAL)
+					continue
+				}
+
+				if !approvedPlan.Contains(workload.Ref()) {
+					fmt.Printf("[workload=%v] is not part of the approved reload plan for secret version [version=%v]. Skipping restart\n", workload.Ref(), approvedPlan.SecretVersion)
+					outcome.record(workload.Kind, WorkloadCounts{Skipped: 1})
+					r.AuditRestartHold(infisicalSecret, &outcome, workload, *managedKubeSecret, audit.DECISION_SKIPPED, HOLD_REASON_NOT_APPROVED)
+					continue
+				}
+			}
+
+			if clusterUnderMaintenance && reloadReason != "" && !r.shouldAdoptWorkload(reloadReason, infisicalSecret) {
+				deferredWorkloads = append(deferredWorkloads, workload.Ref())
+				outcome.record(workload.Kind, WorkloadCounts{Deferred: 1})
+				r.AuditRestartHold(infisicalSecret, &outcome, workload, *managedKubeSecret, audit.DECISION_DEFERRED, HOLD_REASON_MAINTENANCE)
+				continue
+			}
+
+			// no-deploy windows hold back every restart, including forced ones. The workload is still outdated once the window closes and is restarted then
+			if !outcome.RestartsPermittedAt.IsZero() && reloadReason != "" && !r.shouldAdoptWorkload(reloadReason, infisicalSecret) {
+				blackoutWorkloads = append(blackoutWorkloads, workload.Ref())
+				outcome.record(workload.Kind, WorkloadCounts{Deferred: 1})
+				r.AuditRestartHold(infisicalSecret, &outcome, workload, *managedKubeSecret, audit.DECISION_DEFERRED, HOLD_REASON_BLACKOUT)
+				continue
+			}
+
+			// forced restarts are explicitly requested, so they are not held back by the restart schedule or the restart window of the workload
+			isScheduledRestart := false
+			if reloadReason != "" && reloadReason != RELOAD_REASON_FORCED && !r.shouldAdoptWorkload(reloadReason, infisicalSecret) {
+				workloadSchedule, err := getEffectiveRestartSchedule(workload, restartSchedule)
+				if err != nil {
+					fmt.Println(err)
+					outcome.recordFailure(workload, err)
+					continue
+				}
+
+				if workloadSchedule != nil {
+					restartDue, err := r.IsScheduledRestartDue(ctx, workload, *managedKubeSecret, infisicalSecret, workloadSchedule, now)
+					if err != nil {
+						fmt.Println(err)
+						outcome.recordFailure(workload, err)
+						continue
+					}
+
+					if !restartDue {
+						if workloadSchedule != restartSchedule {
+							outcome.recordRestartWindow(workloadSchedule.Next(now))
+						}
+						outcome.record(workload.Kind, WorkloadCounts{Deferred: 1})
+						r.AuditRestartHold(infisicalSecret, &outcome, workload, *managedKubeSecret, audit.DECISION_DEFERRED, HOLD_REASON_SCHEDULE)
+						continue
+					}
+					isScheduledRestart = true
+				}
+			}
+
+			// the pre restart Job is only created once a workload is about to be restarted, and every restart waits for it to succeed
+			if infisicalSecret.Spec.PreRestartJob != nil && reloadReason != "" && !r.shouldAdoptWorkload(reloadReason, infisicalSecret) {
+				if outcome.PreRestartJob == nil {
+					preRestartJob, err := r.RunRestartJob(ctx, infisicalSecret, *infisicalSecret.Spec.PreRestartJob, infisicalSecret.Status.PreRestartJob, RESTART_JOB_STAGE_PRE, managedKubeSecret.Annotations[SECRET_VERSION_ANNOTATION])
+					if err != nil {
+						fmt.Println(err)
+						outcome.recordFailure(workload, err)
+						continue
+					}
+					outcome.PreRestartJob = preRestartJob
+				}
+
+				if outcome.PreRestartJob.Phase == RESTART_JOB_PHASE_RUNNING {
+					outcome.record(workload.Kind, WorkloadCounts{Deferred: 1})
+					r.AuditRestartHold(infisicalSecret, &outcome, workload, *managedKubeSecret, audit.DECISION_DEFERRED, HOLD_REASON_PRE_RESTART_JOB)
+					continue
+				}
+
+				if outcome.PreRestartJob.Phase == RESTART_JOB_PHASE_FAILED {
+					fmt.Printf("pre restart [job=%v] failed. Skipping restart of [workload=%v] for secret [version=%v]\n", outcome.PreRestartJob.JobName, workload.Ref(), outcome.PreRestartJob.SecretVersion)
+					outcome.record(workload.Kind, WorkloadCounts{Skipped: 1})
+					r.AuditRestartHold(infisicalSecret, &outcome, workload, *managedKubeSecret, audit.DECISION_SKIPPED, HOLD_REASON_PRE_RESTART_FAILED)
+					continue
+				}
+			}
+
+			if outcome.ReloadBatches != nil && reloadReason != "" && !r.shouldAdoptWorkload(reloadReason, infisicalSecret) && !isReloadBatchMember(outcome.ReloadBatches, workload) {
+				if batchSlots == 0 {
+					batchWaitingWorkloads++
+					outcome.record(workload.Kind, WorkloadCounts{Deferred: 1})
+					r.AuditRestartHold(infisicalSecret, &outcome, workload, *managedKubeSecret, audit.DECISION_DEFERRED, HOLD_REASON_BATCH)
+					continue
+				}
+				batchSlots--
+				batchWorkloads = append(batchWorkloads, workload.Ref())
+			}
+
+			if isScheduledRestart {
+				scheduledWorkloads = append(scheduledWorkloads, workload.Ref())
+			}
+
+			// Start a goroutine to reconcile the workload. Its result is recorded once the wave finished, as the loop keeps recording into the outcome meanwhile
 			wg.Add(1)
-			go func(d v1.Deployment, s corev1.Secret) {
+			go func(w Workload, s corev1.Secret) {
 				defer wg.Done()
-				if err := r.ReconcileDeployment(ctx, d, s); err != nil {
-					fmt.Printf("unable to reconcile deployment with [name=%v]. Will try next requeue", deployment.ObjectMeta.Name)
+				decision, err := r.ReconcileWorkload(ctx, w, s, infisicalSecret)
+				waveResults <- workloadResult{workload: w, secret: s, decision: decision, err: err}
+			}(workload, *managedKubeSecret)
+		}
+
+		wg.Wait()
+		close(waveResults)
+
+		for result := range waveResults {
+			outcome.recordWorkloadResult(result)
+			if result.err == nil {
+				completedWorkloads++
+			}
+
+			// workloads that failed to restart stay in the batch and hold it, the slots of workloads that were not restarted go to the next waves
+			if outcome.ReloadBatches != nil && result.err == nil && result.decision != audit.DECISION_RESTARTED {
+				var wasBatchWorkload bool
+				if batchWorkloads, wasBatchWorkload = removeReloadBatchWorkload(batchWorkloads, result.workload.Ref()); wasBatchWorkload {
+					batchSlots++
 				}
-			}(deployment, *managedKubeSecret)
+				outcome.ReloadBatches.Workloads, _ = removeReloadBatchWorkload(outcome.ReloadBatches.Workloads, result.workload.Ref())
+			}
+		}
+	}
+
+	r.RecordForbiddenNamespaces(&infisicalSecret, permissions)
+
+	if outcome.ReloadBatches != nil {
+		grantedSlots := batchSlots + len(batchWorkloads)
+		recordReloadBatch(outcome.ReloadBatches, batchWorkloads, batchWaitingWorkloads, infisicalSecret.Spec.ReloadBatchSize, grantedSlots, now)
+
+		if len(batchWorkloads) > 0 {
+			r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeNormal, "ReloadBatchStarted", "Restarting batch %v of %v for secret version %v: %v", outcome.ReloadBatches.CurrentBatch, outcome.ReloadBatches.TotalBatches, outcome.ReloadBatches.SecretVersion, batchWorkloads)
+		}
+	}
+
+	if infisicalSecret.Spec.PostRestartJob != nil && ctx.Err() == nil {
+		outcome.PostRestartJob, err = r.ReconcilePostRestartJob(ctx, infisicalSecret, matchedWorkloads, annotationKey, managedKubeSecret.Annotations[SECRET_VERSION_ANNOTATION], outcome)
+		if err != nil {
+			return outcome, err
+		}
+	}
+
+	if r.EnablePodDeletion && ctx.Err() == nil {
+		if clusterUnderMaintenance {
+			fmt.Printf("cluster is under maintenance because %v. Deferring deletion of pods consuming the managed secret\n", maintenanceReason)
+		} else if !outcome.RestartsPermittedAt.IsZero() {
+			fmt.Printf("blackout window is open until [time=%v]. Deferring deletion of pods consuming the managed secret\n", outcome.RestartsPermittedAt.Format(time.RFC3339))
+		} else if err := r.ReconcileStandalonePods(ctx, reloadNamespaces, *managedKubeSecret, infisicalSecret, &outcome); err != nil {
+			return outcome, err
+		}
+	}
+
+	if len(pendingPlan.Workloads) > 0 {
+		if err := r.WriteReloadPlan(ctx, infisicalSecret, pendingPlan); err != nil {
+			return outcome, err
 		}
+		r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeNormal, "ReloadPlanPending", "Restart of %v workload(s) awaits approval of reload plan %v", len(pendingPlan.Workloads), GetReloadPlanName(infisicalSecret, pendingPlan.SecretVersion))
 	}
 
-	wg.Wait()
+	if len(deferredWorkloads) > 0 {
+		fmt.Printf("cluster is under maintenance because %v. Deferring restart of [workloads=%v] until the cluster stabilizes\n", maintenanceReason, deferredWorkloads)
+		r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeNormal, "RestartsDeferred", "Deferred restart of %v workload(s) because the cluster is under maintenance: %v", len(deferredWorkloads), maintenanceReason)
+	}
 
-	return 0, nil
+	if len(blackoutWorkloads) > 0 {
+		fmt.Printf("blackout window is open. Deferring restart of [workloads=%v] until [time=%v]\n", blackoutWorkloads, outcome.RestartsPermittedAt.Format(time.RFC3339))
+		r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeNormal, "RestartsDeferred", "Deferred restart of %v workload(s) until the blackout window closes at %v", len(blackoutWorkloads), outcome.RestartsPermittedAt.Format(time.RFC3339))
+	}
+
+	if len(scheduledWorkloads) > 0 {
+		fmt.Printf("restart schedule fired. Restarting [workloads=%v] with pending rotations\n", scheduledWorkloads)
+		r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeNormal, "ScheduledRestart", "Restarting %v workload(s) with pending secret rotations on schedule", len(scheduledWorkloads))
+	}
+
+	if outcome.Total.Restarted > 0 {
+		r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeNormal, "WorkloadsReloaded", "Restarted %v workload(s) for secret version %v: %v", outcome.Total.Restarted, managedKubeSecret.Annotations[SECRET_VERSION_ANNOTATION], outcome.Breakdown(func(c WorkloadCounts) int { return c.Restarted }))
+
+		if infisicalSecret.Spec.RecordEventsOnManagedSecret {
+			r.RecordManagedSecretRotationEvent(*managedKubeSecret, outcome)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return outcome, fmt.Errorf("reconciled %v of %v matched workloads before reaching the [timeout=%v]: %w", completedWorkloads, outcome.Total.Matched, reconcileTimeout, ctx.Err())
+	}
+
+	return outcome, nil
+}
+
+// Check if the workload uses managed secrets
+func (r *InfisicalSecretReconciler) IsWorkloadUsingManagedSecret(workload Workload, infisicalSecret v1alpha1.InfisicalSecret) bool {
+	return len(r.DetectManagedSecretReferences(*workload.PodTemplate, infisicalSecret)) > 0
 }
 
-// Check if the deployment uses managed secrets
-func (r *InfisicalSecretReconciler) IsDeploymentUsingManagedSecret(deployment v1.Deployment, infisicalSecret v1alpha1.InfisicalSecret) bool {
-	managedSecretName := infisicalSecret.Spec.ManagedSecretReference.SecretName
-	for _, container := range deployment.Spec.Template.Spec.Containers {
-		for _, envFrom := range container.EnvFrom {
-			if envFrom.SecretRef != nil && envFrom.SecretRef.LocalObjectReference.Name == managedSecretName {
-				return true
+// Runs all enabled reference detectors against the pod template. Only the builtin detector is used when no registry is configured
+func (r *InfisicalSecretReconciler) DetectManagedSecretReferences(podTemplate corev1.PodTemplateSpec, infisicalSecret v1alpha1.InfisicalSecret) []SecretReferenceMatch {
+	managedSecretName := getManagedSecretName(infisicalSecret)
+	podTemplate = getScannedPodTemplate(podTemplate, infisicalSecret.Spec.ScanContainers)
+
+	if r.ReferenceDetectors == nil {
+		return BuiltinReferenceDetector{}.DetectReferences(podTemplate, managedSecretName)
+	}
+
+	return r.ReferenceDetectors.DetectReferences(podTemplate, managedSecretName)
+}
+
+// Restricts the pod template to the containers, init containers and ephemeral containers that are scanned for references. Volumes only mounted by
+// skipped containers are left out as well, while volumes mounted by no container are kept, so they are still detected at the pod level. The pod
+// template is returned as is when all containers are scanned
+func getScannedPodTemplate(podTemplate corev1.PodTemplateSpec, scanContainers []string) corev1.PodTemplateSpec {
+	if len(scanContainers) == 0 {
+		return podTemplate
+	}
+
+	scanned := map[string]bool{}
+	for _, containerName := range scanContainers {
+		scanned[containerName] = true
+	}
+
+	mountedByScanned := map[string]bool{}
+	mountedBySkipped := map[string]bool{}
+	recordVolumeMounts := func(containerName string, volumeMounts []corev1.VolumeMount) {
+		for _, volumeMount := range volumeMounts {
+			if scanned[containerName] {
+				mountedByScanned[volumeMount.Name] = true
+			} else {
+				mountedBySkipped[volumeMount.Name] = true
 			}
 		}
-		for _, env := range container.Env {
-			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil && env.ValueFrom.SecretKeyRef.LocalObjectReference.Name == managedSecretName {
-				return true
-			}
+	}
+
+	var containers []corev1.Container
+	for _, container := range podTemplate.Spec.Containers {
+		recordVolumeMounts(container.Name, container.VolumeMounts)
+		if scanned[container.Name] {
+			containers = append(containers, container)
 		}
 	}
-	for _, volume := range deployment.Spec.Template.Spec.Volumes {
-		if volume.Secret != nil && volume.Secret.SecretName == managedSecretName {
-			return true
+
+	var initContainers []corev1.Container
+	for _, initContainer := range podTemplate.Spec.InitContainers {
+		recordVolumeMounts(initContainer.Name, initContainer.VolumeMounts)
+		if scanned[initContainer.Name] {
+			initContainers = append(initContainers, initContainer)
 		}
 	}
 
-	return false
+	var ephemeralContainers []corev1.EphemeralContainer
+	for _, ephemeralContainer := range podTemplate.Spec.EphemeralContainers {
+		recordVolumeMounts(ephemeralContainer.Name, ephemeralContainer.VolumeMounts)
+		if scanned[ephemeralContainer.Name] {
+			ephemeralContainers = append(ephemeralContainers, ephemeralContainer)
+		}
+	}
+
+	var volumes []corev1.Volume
+	for _, volume := range podTemplate.Spec.Volumes {
+		if mountedByScanned[volume.Name] || !mountedBySkipped[volume.Name] {
+			volumes = append(volumes, volume)
+		}
+	}
+
+	// the pod template belongs to the workload, so only the copy handed to the detectors is restricted
+	scannedPodTemplate := podTemplate
+	scannedPodTemplate.Spec.Containers = containers
+	scannedPodTemplate.Spec.InitContainers = initContainers
+	scannedPodTemplate.Spec.EphemeralContainers = ephemeralContainers
+	scannedPodTemplate.Spec.Volumes = volumes
+	return scannedPodTemplate
+}
+
+func getManagedSecretName(infisicalSecret v1alpha1.InfisicalSecret) ManagedSecretName {
+	return ManagedSecretName{
+		Name:            infisicalSecret.Spec.ManagedSecretReference.SecretName,
+		CaseInsensitive: pointer.BoolDeref(infisicalSecret.Spec.CaseInsensitiveSecretMatching, false),
+		PreviousNames:   infisicalSecret.Spec.ManagedSecretReference.PreviousNames,
+	}
 }
 
-// This function ensures that a deployment is in sync with a Kubernetes secret by comparing their versions.
-// If the version of the secret is different from the version annotation on the deployment, the annotation is updated to trigger a restart of the deployment.
-func (r *InfisicalSecretReconciler) ReconcileDeployment(ctx context.Context, deployment v1.Deployment, secret corev1.Secret) error {
+// Returns the previous names of the managed secret that the pod template still references
+func (r *InfisicalSecretReconciler) GetDeprecatedSecretReferences(podTemplate corev1.PodTemplateSpec, infisicalSecret v1alpha1.InfisicalSecret) []string {
+	var deprecatedNames []string
+	for _, previousName := range infisicalSecret.Spec.ManagedSecretReference.PreviousNames {
+		previousSecretName := ManagedSecretName{Name: previousName, CaseInsensitive: pointer.BoolDeref(infisicalSecret.Spec.CaseInsensitiveSecretMatching, false)}
+
+		scannedPodTemplate := getScannedPodTemplate(podTemplate, infisicalSecret.Spec.ScanContainers)
+
+		var matches []SecretReferenceMatch
+		if r.ReferenceDetectors == nil {
+			matches = BuiltinReferenceDetector{}.DetectReferences(scannedPodTemplate, previousSecretName)
+		} else {
+			matches = r.ReferenceDetectors.DetectReferences(scannedPodTemplate, previousSecretName)
+		}
+
+		if len(matches) > 0 {
+			deprecatedNames = append(deprecatedNames, previousName)
+		}
+	}
+	return deprecatedNames
+}
+
+func isSameSecretName(referencedName string, managedSecretName string, caseInsensitive bool) bool {
+	if caseInsensitive {
+		return strings.EqualFold(referencedName, managedSecretName)
+	}
+	return referencedName == managedSecretName
+}
+
+// This function ensures that a workload is in sync with a Kubernetes secret by comparing their versions.
+// If the version of the secret is different from the version annotation on the workload, the annotation is updated to trigger a restart of the workload.
+// Returns the decision made for the workload, which is empty when the workload is already up to date
+func (r *InfisicalSecretReconciler) ReconcileWorkload(ctx context.Context, workload Workload, secret corev1.Secret, infisicalSecret v1alpha1.InfisicalSecret) (string, error) {
 	annotationKey := fmt.Sprintf("%s.%s", DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX, secret.Name)
 	annotationValue := secret.Annotations[SECRET_VERSION_ANNOTATION]
 
-	if deployment.Annotations[annotationKey] == annotationValue &&
-		deployment.Spec.Template.Annotations[annotationKey] == annotationValue {
-		fmt.Printf("The [deploymentName=%v] is already using the most up to date managed secrets. No action required.\n", deployment.ObjectMeta.Name)
-		return nil
+	identityAnnotationKey := fmt.Sprintf("%s.%s", DEPLOYMENT_SECRET_IDENTITY_ANNOTATION_PREFIX, secret.Name)
+	identityAnnotationValue := getSecretIdentity(secret)
+
+	propagatedLabels, propagatedAnnotations := GetPropagatedSecretMetadata(secret, infisicalSecret.Spec.PropagateSecretMetadata, workload.Selector)
+
+	reloadReason := r.GetReloadReason(workload, secret, infisicalSecret)
+	if reloadReason == "" {
+		fmt.Printf("The [workload=%v] is already using the most up to date managed secrets. No action required.\n", workload.Ref())
+		return "", nil
+	}
+
+	if infisicalSecret.Spec.RestartedAtOnly {
+		return r.ReconcileWorkloadWithRestartedAtOnly(ctx, workload, secret, infisicalSecret, reloadReason)
+	}
+
+	previousVersion, _ := r.GetRecordedSecretVersion(workload, secret.Name)
+
+	if r.shouldAdoptWorkload(reloadReason, infisicalSecret) {
+		return audit.DECISION_ADOPTED, r.AdoptWorkload(ctx, workload, secret, infisicalSecret)
+	}
+
+	if reloadReason != RELOAD_REASON_FORCED && reloadReason != RELOAD_REASON_OPTIONAL_SECRET_CREATED && isWorkloadYoungerThan(workload, infisicalSecret.Spec.MinWorkloadAgeSeconds, time.Now()) {
+		fmt.Printf("[workload=%v] was created less than [seconds=%v] ago and is assumed to use the current managed secret\n", workload.Ref(), infisicalSecret.Spec.MinWorkloadAgeSeconds)
+		return audit.DECISION_ADOPTED, r.AdoptWorkload(ctx, workload, secret, infisicalSecret)
+	}
+
+	if pointer.BoolDeref(infisicalSecret.Spec.RestartOnlyOutdatedPods, false) {
+		outdatedPods, pods, err := r.CountPodsOlderThanSecret(ctx, workload, secret)
+		if err != nil {
+			r.AuditRestartDecision(infisicalSecret, workload, previousVersion, annotationValue, audit.DECISION_SKIPPED, err)
+			return audit.DECISION_SKIPPED, err
+		}
+
+		if pods == 0 {
+			fmt.Printf("[workload=%v] has no running pods, so there is nothing to restart. Pods created later read the current managed secret\n", workload.Ref())
+			return audit.DECISION_SKIPPED, r.SkipWorkloadRestart(ctx, workload, secret, infisicalSecret, previousVersion)
+		}
+
+		if outdatedPods == 0 {
+			fmt.Printf("All pods of [workload=%v] were created after the managed secret was last modified. Skipping re-deployment\n", workload.Ref())
+			return audit.DECISION_SKIPPED, r.SkipWorkloadRestart(ctx, workload, secret, infisicalSecret, previousVersion)
+		}
+	}
+
+	fmt.Printf("workload is using outdated managed secret. Starting re-deployment [workload=%v] [reason=%v]\n", workload.Ref(), reloadReason)
+
+	if workload.PodTemplate.Annotations == nil {
+		workload.PodTemplate.Annotations = make(map[string]string)
+	}
+
+	if workload.PodTemplate.Labels == nil {
+		workload.PodTemplate.Labels = make(map[string]string)
+	}
+
+	if workload.Metadata.Annotations == nil {
+		workload.Metadata.Annotations = make(map[string]string)
+	}
+
+	previousType, _ := parseSecretIdentity(workload.Metadata.Annotations[identityAnnotationKey])
+
+	r.recordSecretVersion(workload, secret.Name, annotationValue)
+	r.recordVersionSeal(workload, secret)
+	workload.PodTemplate.Annotations[annotationKey] = annotationValue
+	workload.Metadata.Annotations[identityAnnotationKey] = identityAnnotationValue
+	workload.PodTemplate.Annotations[identityAnnotationKey] = identityAnnotationValue
+	workload.PodTemplate.Annotations[DEPLOYMENT_RELOAD_REASON_ANNOTATION] = reloadReason
+	delete(workload.Metadata.Annotations, fmt.Sprintf("%s.%s", DEPLOYMENT_PENDING_RESTART_ANNOTATION_PREFIX, secret.Name))
+	delete(workload.Metadata.Annotations, fmt.Sprintf("%s.%s", DEPLOYMENT_SKIPPED_RESTART_ANNOTATION_PREFIX, secret.Name))
+	removeLegacyPodTemplateAnnotations(workload, secret.Name)
+	recordOptionalKeysPresence(workload, secret, getManagedSecretName(infisicalSecret))
+	r.recordConsumedKeysHash(workload, secret, infisicalSecret)
+
+	if reloadReason == RELOAD_REASON_FORCED {
+		// the secret may not have changed, so the pod template is changed the same way `kubectl rollout restart` does it
+		delete(workload.Metadata.Annotations, FORCE_RELOAD_DEPLOYMENT_ANNOTATION)
+		workload.PodTemplate.Annotations[RESTARTED_AT_ANNOTATION] = time.Now().Format(time.RFC3339)
+	}
+
+	for key, value := range propagatedLabels {
+		workload.PodTemplate.Labels[key] = value
+	}
+
+	for key, value := range propagatedAnnotations {
+		workload.PodTemplate.Annotations[key] = value
+	}
+
+	surgeApplied := r.applySurgeStrategy(workload, infisicalSecret)
+
+	if warning := GetBroadDaemonSetRestartWarning(workload); warning != "" {
+		fmt.Printf("restarting [workload=%v] with broad pacing. %v\n", workload.Ref(), warning)
+		r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeWarning, "BroadDaemonSetRestart", "%s", warning)
+	}
+
+	if err := r.Client.Update(ctx, workload.Object); err != nil {
+		err = fmt.Errorf("failed to update %s annotation: %w", workload.Kind, err)
+		r.AuditRestartDecision(infisicalSecret, workload, previousVersion, annotationValue, audit.DECISION_RESTARTED, err)
+		return audit.DECISION_RESTARTED, err
+	}
+
+	if reloadReason == RELOAD_REASON_TYPE_CHANGED {
+		if warning := GetSecretTypeTransitionWarning(secret.Name, corev1.SecretType(previousType), secret.Type); warning != "" {
+			fmt.Printf("restarted [workload=%v] after a secret type transition. %v\n", workload.Ref(), warning)
+			r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeWarning, "SecretTypeTransition", "Restarted %v. %s", workload.Ref(), warning)
+		}
+	}
+
+	if reloadReason == RELOAD_REASON_RECORDED_VERSION_MISMATCH {
+		fmt.Printf("recorded secret version of [workload=%v] does not match the managed secret [secret=%v]. Restarted it to self heal\n", workload.Ref(), secret.Name)
+		r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeWarning, "RecordedVersionMismatch", "%v claimed to use version %v of managed secret %v, but its seal is missing or does not match. The annotations of the workload were modified outside of the operator or the secret changed without a new version, so it was restarted", workload.Ref(), previousVersion, secret.Name)
+	}
+
+	if surgeApplied {
+		r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeNormal, "SurgeStrategyApplied", "Temporarily switched %v to a rolling update with maxUnavailable 0 for the restart. The original strategy is restored once the rollout finished", workload.Ref())
+	}
+
+	r.AuditRestartDecision(infisicalSecret, workload, previousVersion, annotationValue, audit.DECISION_RESTARTED, nil)
+	workloadReloadsTotal.WithLabelValues(workload.Kind, reloadReason).Inc()
+	return audit.DECISION_RESTARTED, nil
+}
+
+// The first observation policy of the InfisicalSecret takes precedence over the one of the operator
+func (r *InfisicalSecretReconciler) shouldAdoptWorkload(reloadReason string, infisicalSecret v1alpha1.InfisicalSecret) bool {
+	if reloadReason != RELOAD_REASON_SECRET_CREATED {
+		return false
+	}
+
+	switch infisicalSecret.Spec.FirstObservationPolicy {
+	case FIRST_OBSERVATION_POLICY_ADOPT:
+		return true
+	case FIRST_OBSERVATION_POLICY_RESTART:
+		return false
+	}
+	return r.AdoptWorkloadsOnFirstObservation
+}
+
+// Records the current version of the managed secret on a workload that has never been reconciled before, without restarting it.
+// Only the workload's own annotations are written so that its pod template, and therefore its pods, stay untouched
+func (r *InfisicalSecretReconciler) AdoptWorkload(ctx context.Context, workload Workload, secret corev1.Secret, infisicalSecret v1alpha1.InfisicalSecret) error {
+	annotationValue := secret.Annotations[SECRET_VERSION_ANNOTATION]
+
+	fmt.Printf("Observed [workload=%v] for the first time. Adopting the current managed secret version without a restart\n", workload.Ref())
+
+	if err := r.recordCurrentSecretVersion(ctx, workload, secret, infisicalSecret); err != nil {
+		err = fmt.Errorf("failed to adopt %s: %w", workload.Kind, err)
+		r.AuditRestartDecision(infisicalSecret, workload, "", annotationValue, audit.DECISION_ADOPTED, err)
+		return err
 	}
 
-	fmt.Printf("deployment is using outdated managed secret. Starting re-deployment [deploymentName=%v]\n", deployment.ObjectMeta.Name)
+	r.AuditRestartDecision(infisicalSecret, workload, "", annotationValue, audit.DECISION_ADOPTED, nil)
+	return nil
+}
+
+// Records the current version of the managed secret on a workload whose restart was skipped because none of its pods predate the secret.
+// Without it the workload stays outdated and every resync lists its pods and audits the skip again
+func (r *InfisicalSecretReconciler) SkipWorkloadRestart(ctx context.Context, workload Workload, secret corev1.Secret, infisicalSecret v1alpha1.InfisicalSecret, previousVersion string) error {
+	annotationValue := secret.Annotations[SECRET_VERSION_ANNOTATION]
 
-	if deployment.Spec.Template.Annotations == nil {
-		deployment.Spec.Template.Annotations = make(map[string]string)
+	if workload.Metadata.Annotations == nil {
+		workload.Metadata.Annotations = make(map[string]string)
 	}
 
-	deployment.Annotations[annotationKey] = annotationValue
-	deployment.Spec.Template.Annotations[annotationKey] = annotationValue
+	// the rotation a scheduled restart was pending for no longer needs a restart
+	delete(workload.Metadata.Annotations, fmt.Sprintf("%s.%s", DEPLOYMENT_PENDING_RESTART_ANNOTATION_PREFIX, secret.Name))
+	// the pod template keeps the version of the last restart, as changing it would restart the workload after all
+	workload.Metadata.Annotations[fmt.Sprintf("%s.%s", DEPLOYMENT_SKIPPED_RESTART_ANNOTATION_PREFIX, secret.Name)] = annotationValue
 
-	if err := r.Client.Update(ctx, &deployment); err != nil {
-		return fmt.Errorf("failed to update deployment annotation: %v", err)
+	if err := r.recordCurrentSecretVersion(ctx, workload, secret, infisicalSecret); err != nil {
+		err = fmt.Errorf("failed to record the managed secret version on %s: %w", workload.Kind, err)
+		r.AuditRestartDecision(infisicalSecret, workload, previousVersion, annotationValue, audit.DECISION_SKIPPED, err)
+		return err
 	}
+
+	r.AuditRestartDecision(infisicalSecret, workload, previousVersion, annotationValue, audit.DECISION_SKIPPED, nil)
 	return nil
 }
+
+// Records the current managed secret on the workload's own annotations, leaving its pod template, and therefore its pods, untouched
+func (r *InfisicalSecretReconciler) recordCurrentSecretVersion(ctx context.Context, workload Workload, secret corev1.Secret, infisicalSecret v1alpha1.InfisicalSecret) error {
+	identityAnnotationKey := fmt.Sprintf("%s.%s", DEPLOYMENT_SECRET_IDENTITY_ANNOTATION_PREFIX, secret.Name)
+
+	if workload.Metadata.Annotations == nil {
+		workload.Metadata.Annotations = make(map[string]string)
+	}
+
+	r.recordSecretVersion(workload, secret.Name, secret.Annotations[SECRET_VERSION_ANNOTATION])
+	r.recordVersionSeal(workload, secret)
+	workload.Metadata.Annotations[identityAnnotationKey] = getSecretIdentity(secret)
+	recordOptionalKeysPresence(workload, secret, getManagedSecretName(infisicalSecret))
+	r.recordConsumedKeysHash(workload, secret, infisicalSecret)
+
+	return r.Client.Update(ctx, workload.Object)
+}
+
+func isWorkloadYoungerThan(workload Workload, minAgeSeconds int, now time.Time) bool {
+	if minAgeSeconds <= 0 {
+		return false
+	}
+	return now.Sub(workload.Metadata.CreationTimestamp.Time) < time.Duration(minAgeSeconds)*time.Second
+}
+
+// Determines why the workload needs to be restarted. An empty reason means the workload already uses the current managed secret and carries its propagated metadata
+func (r *InfisicalSecretReconciler) GetReloadReason(workload Workload, secret corev1.Secret, infisicalSecret v1alpha1.InfisicalSecret) string {
+	annotationKey := fmt.Sprintf("%s.%s", DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX, secret.Name)
+	annotationValue := secret.Annotations[SECRET_VERSION_ANNOTATION]
+	identityAnnotationKey := fmt.Sprintf("%s.%s", DEPLOYMENT_SECRET_IDENTITY_ANNOTATION_PREFIX, secret.Name)
+
+	if infisicalSecret.Spec.RestartedAtOnly {
+		return getStatusTrackedReloadReason(workload, secret, infisicalSecret)
+	}
+
+	if workload.Metadata.Annotations[FORCE_RELOAD_DEPLOYMENT_ANNOTATION] == "true" {
+		return RELOAD_REASON_FORCED
+	}
+
+	previousVersion, hasPreviousVersion := r.GetRecordedSecretVersion(workload, secret.Name)
+	if !hasPreviousVersion {
+		// unlike other first observations, such workloads cannot be assumed to already use the secret, so they are neither adopted nor skipped for their age
+		if wasStartedWithoutOptionalSecret(workload, secret, getManagedSecretName(infisicalSecret)) {
+			return RELOAD_REASON_OPTIONAL_SECRET_CREATED
+		}
+		return RELOAD_REASON_SECRET_CREATED
+	}
+
+	// workloads restarted by older operator versions have no identity annotation yet, which is not a reason to restart them
+	previousIdentity := workload.Metadata.Annotations[identityAnnotationKey]
+	if previousIdentity != "" && previousIdentity != getSecretIdentity(secret) {
+		previousType, _ := parseSecretIdentity(previousIdentity)
+		if previousType != string(secret.Type) {
+			return RELOAD_REASON_TYPE_CHANGED
+		}
+		return RELOAD_REASON_UID_CHANGED
+	}
+
+	if hasOptionalKeysPresenceChanged(workload, secret, getManagedSecretName(infisicalSecret)) {
+		return RELOAD_REASON_OPTIONAL_KEY_CHANGED
+	}
+
+	propagatedLabels, propagatedAnnotations := GetPropagatedSecretMetadata(secret, infisicalSecret.Spec.PropagateSecretMetadata, workload.Selector)
+
+	// adopted workloads only carry the version on the workload itself, as annotating the pod template would restart them. Workloads whose restart
+	// was skipped keep the version of their last restart on the pod template for the same reason
+	templateVersion, templateHasVersion := workload.PodTemplate.Annotations[annotationKey]
+	templateOutdated := templateHasVersion && templateVersion != annotationValue && workload.Metadata.Annotations[fmt.Sprintf("%s.%s", DEPLOYMENT_SKIPPED_RESTART_ANNOTATION_PREFIX, secret.Name)] != annotationValue
+
+	versionChanged := previousVersion != annotationValue || templateOutdated
+	metadataChanged := !isMetadataSubset(propagatedLabels, workload.PodTemplate.Labels) || !isMetadataSubset(propagatedAnnotations, workload.PodTemplate.Annotations)
+
+	// a new version of the secret does not affect the workload when none of the keys it consumes changed
+	if versionChanged && !metadataChanged && infisicalSecret.Spec.RestartOnlyForConsumedKeys && !r.HaveConsumedKeysChanged(workload, secret, infisicalSecret) {
+		return ""
+	}
+
+	if versionChanged || metadataChanged {
+		return RELOAD_REASON_DATA_CHANGED
+	}
+
+	if r.isRecordedVersionTampered(workload, secret, infisicalSecret) {
+		return RELOAD_REASON_RECORDED_VERSION_MISMATCH
+	}
+
+	return ""
+}
+
+// The identity of a secret changes when it is deleted and recreated, which can happen without its version changing (e.g. when its type is changed)
+func getSecretIdentity(secret corev1.Secret) string {
+	return fmt.Sprintf("%s/%s", secret.Type, secret.UID)
+}
+
+func parseSecretIdentity(identity string) (secretType string, uid string) {
+	separatorIndex := strings.LastIndex(identity, "/")
+	if separatorIndex == -1 {
+		return "", identity
+	}
+	return identity[:separatorIndex], identity[separatorIndex+1:]
+}
+
+// Counts the running pods of the workload and the ones among them created before the managed secret was last modified. Pods created after it
+// already carry the latest secret
+func (r *InfisicalSecretReconciler) CountPodsOlderThanSecret(ctx context.Context, workload Workload, secret corev1.Secret) (outdatedPods int, pods int, err error) {
+	selector, err := metav1.LabelSelectorAsSelector(workload.Selector)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to parse selector of [workload=%v] [err=%w]", workload.Ref(), err)
+	}
+
+	listOfPods := &corev1.PodList{}
+	err = r.Client.List(ctx, listOfPods, &client.ListOptions{Namespace: workload.Metadata.Namespace, LabelSelector: selector})
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to get pods of [workload=%v] [err=%w]", workload.Ref(), err)
+	}
+
+	secretLastModified := GetSecretLastModifiedTime(secret)
+	for _, pod := range listOfPods.Items {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		pods++
+		if !pod.CreationTimestamp.After(secretLastModified.Time) {
+			outdatedPods++
+		}
+	}
+
+	return outdatedPods, pods, nil
+}
+
+// Kubernetes does not keep a last modified timestamp on objects, so the most recent managed field write is used instead, falling back to the creation time
+func GetSecretLastModifiedTime(secret corev1.Secret) metav1.Time {
+	lastModified := secret.CreationTimestamp
+	for _, managedField := range secret.ManagedFields {
+		if managedField.Time != nil && managedField.Time.After(lastModified.Time) {
+			lastModified = *managedField.Time
+		}
+	}
+
+	return lastModified
+}
+
+// Returns the labels and annotations of the managed secret that are allowed to be copied onto a workload's pod template.
+// Keys must be explicitly allowlisted, must not be system keys, must not collide with the workload's selector and their values must not contain any of the secret's data
+func GetPropagatedSecretMetadata(secret corev1.Secret, allowedKeys []string, selector *metav1.LabelSelector) (labels map[string]string, annotations map[string]string) {
+	labels = map[string]string{}
+	annotations = map[string]string{}
+
+	selectorKeys, selectorErr := getSelectorKeys(selector)
+
+	for _, key := range allowedKeys {
+		if isSystemMetadataKey(key) {
+			fmt.Printf("refusing to propagate system metadata key [key=%v] from managed secret [name=%v]\n", key, secret.Name)
+			continue
+		}
+
+		if value, exists := secret.Labels[key]; exists {
+			if selectorErr != nil {
+				// pods of a workload whose selector cannot be evaluated could stop matching it
+				fmt.Printf("refusing to propagate label [key=%v] from managed secret [name=%v] because the workload selector is invalid [err=%v]\n", key, secret.Name, selectorErr)
+			} else if selectorKeys[key] {
+				fmt.Printf("refusing to propagate label [key=%v] from managed secret [name=%v] because it is part of the workload selector\n", key, secret.Name)
+			} else if containsSecretData(value, secret) {
+				fmt.Printf("refusing to propagate label [key=%v] from managed secret [name=%v] because its value contains secret data\n", key, secret.Name)
+			} else {
+				labels[key] = value
+			}
+		}
+
+		if value, exists := secret.Annotations[key]; exists {
+			if containsSecretData(value, secret) {
+				fmt.Printf("refusing to propagate annotation [key=%v] from managed secret [name=%v] because its value contains secret data\n", key, secret.Name)
+			} else {
+				annotations[key] = value
+			}
+		}
+	}
+
+	return labels, annotations
+}
+
+// Returns the label keys the selector evaluates, from its matchLabels as well as its matchExpressions
+func getSelectorKeys(selector *metav1.LabelSelector) (map[string]bool, error) {
+	selectorKeys := map[string]bool{}
+	if selector == nil {
+		return selectorKeys, nil
+	}
+
+	parsedSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	requirements, _ := parsedSelector.Requirements()
+	for _, requirement := range requirements {
+		selectorKeys[requirement.Key()] = true
+	}
+	return selectorKeys, nil
+}
+
+// Checks if the given metadata value contains any of the secret's values in plain or base64 encoded form
+func containsSecretData(value string, secret corev1.Secret) bool {
+	for _, secretValue := range secret.Data {
+		if len(secretValue) < MIN_SECRET_VALUE_LENGTH_FOR_LEAK_CHECK {
+			continue
+		}
+
+		if strings.Contains(value, string(secretValue)) || strings.Contains(value, base64.StdEncoding.EncodeToString(secretValue)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isMetadataSubset(subset map[string]string, metadata map[string]string) bool {
+	for key, value := range subset {
+		if metadata[key] != value {
+			return false
+		}
+	}
+	return true
+}
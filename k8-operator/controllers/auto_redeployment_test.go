@@ -0,0 +1,556 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func newTestReconciler(objects ...client.Object) *InfisicalSecretReconciler {
+	testScheme := scheme.Scheme
+	_ = secretsv1alpha1.AddToScheme(testScheme)
+
+	return &InfisicalSecretReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(testScheme).WithObjects(objects...).Build(),
+		Scheme:   testScheme,
+		Recorder: record.NewFakeRecorder(100),
+		// every reconciler of the tests shares the key, like the replicas of an operator do
+		FingerprintKey: []byte("test-fingerprint-key-of-32-bytes"),
+	}
+}
+
+func TestGetPropagatedSecretMetadata(t *testing.T) {
+	g := NewWithT(t)
+
+	secret := corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "managed-secret",
+			Labels: map[string]string{
+				"example.com/secret-version": "42",
+				"app":                        "api",
+				"example.com/not-allowed":    "value",
+				"tier":                       "backend",
+			},
+			Annotations: map[string]string{
+				"example.com/rotated-by":                           "infisical",
+				"example.com/leaky":                                "password=super-secret-password",
+				"example.com/leaky-encoded":                        base64.StdEncoding.EncodeToString([]byte("super-secret-password")),
+				"kubectl.kubernetes.io/last-applied-configuration": `{"data":{}}`,
+			},
+		},
+		Data: map[string][]byte{
+			"DB_PASSWORD": []byte("super-secret-password"),
+		},
+	}
+
+	allowedKeys := []string{
+		"example.com/secret-version",
+		"example.com/rotated-by",
+		"example.com/leaky",
+		"example.com/leaky-encoded",
+		"kubectl.kubernetes.io/last-applied-configuration",
+		"app",
+		"tier",
+	}
+
+	selector := &metav1.LabelSelector{
+		MatchLabels:      map[string]string{"app": "api"},
+		MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: metav1.LabelSelectorOpIn, Values: []string{"backend"}}},
+	}
+
+	labels, annotations := GetPropagatedSecretMetadata(secret, allowedKeys, selector)
+
+	g.Expect(labels).To(Equal(map[string]string{"example.com/secret-version": "42"}))
+	g.Expect(annotations).To(Equal(map[string]string{"example.com/rotated-by": "infisical"}))
+
+	// a selector that cannot be evaluated could stop matching the pods, so no labels are propagated for it
+	invalidSelector := &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: "Near"}}}
+	labels, annotations = GetPropagatedSecretMetadata(secret, allowedKeys, invalidSelector)
+	g.Expect(labels).To(BeEmpty())
+	g.Expect(annotations).To(Equal(map[string]string{"example.com/rotated-by": "infisical"}))
+}
+
+func TestGetReloadReason(t *testing.T) {
+	g := NewWithT(t)
+
+	secret := corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			UID:         "uid-2",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+		Type: corev1.SecretTypeOpaque,
+	}
+
+	deploymentWithAnnotations := func(annotations map[string]string) Workload {
+		deployment := &v1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "api", Annotations: annotations}}
+		deployment.Spec.Template.Annotations = annotations
+		return NewDeploymentWorkload(deployment)
+	}
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+	identityKey := DEPLOYMENT_SECRET_IDENTITY_ANNOTATION_PREFIX + ".managed-secret"
+
+	testCases := map[string]struct {
+		annotations map[string]string
+		reason      string
+	}{
+		"up to date":          {map[string]string{versionKey: "v2", identityKey: "Opaque/uid-2"}, ""},
+		"up to date legacy":   {map[string]string{versionKey: "v2"}, ""},
+		"never reloaded":      {map[string]string{}, RELOAD_REASON_SECRET_CREATED},
+		"forced":              {map[string]string{versionKey: "v2", FORCE_RELOAD_DEPLOYMENT_ANNOTATION: "true"}, RELOAD_REASON_FORCED},
+		"data changed":        {map[string]string{versionKey: "v1", identityKey: "Opaque/uid-2"}, RELOAD_REASON_DATA_CHANGED},
+		"secret recreated":    {map[string]string{versionKey: "v2", identityKey: "Opaque/uid-1"}, RELOAD_REASON_UID_CHANGED},
+		"secret type changed": {map[string]string{versionKey: "v2", identityKey: "kubernetes.io/tls/uid-1"}, RELOAD_REASON_TYPE_CHANGED},
+	}
+
+	for name, testCase := range testCases {
+		reason := newTestReconciler().GetReloadReason(deploymentWithAnnotations(testCase.annotations), secret, secretsv1alpha1.InfisicalSecret{})
+		g.Expect(reason).To(Equal(testCase.reason), name)
+	}
+}
+
+func TestIsWorkloadUsingManagedSecretCaseInsensitive(t *testing.T) {
+	g := NewWithT(t)
+
+	deployment := v1.Deployment{}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "api",
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "Managed-Secret"}},
+		}},
+	}}
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+
+	r := newTestReconciler()
+	g.Expect(r.IsWorkloadUsingManagedSecret(NewDeploymentWorkload(&deployment), infisicalSecret)).To(BeFalse())
+
+	infisicalSecret.Spec.CaseInsensitiveSecretMatching = pointer.Bool(true)
+	g.Expect(r.IsWorkloadUsingManagedSecret(NewDeploymentWorkload(&deployment), infisicalSecret)).To(BeTrue())
+}
+
+func TestScanContainersRestrictsDetection(t *testing.T) {
+	g := NewWithT(t)
+
+	secretVolume := func(name string) corev1.Volume {
+		return corev1.Volume{Name: name, VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "managed-secret"}}}
+	}
+
+	podTemplate := corev1.PodTemplateSpec{}
+	podTemplate.Spec.Containers = []corev1.Container{
+		{
+			Name: "api",
+			Env: []corev1.EnvVar{{Name: "DB_PASS", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"},
+				Key:                  "DB_PASS",
+			}}}},
+		},
+		{
+			Name: "mesh-proxy",
+			EnvFrom: []corev1.EnvFromSource{{
+				SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+			}},
+			VolumeMounts: []corev1.VolumeMount{{Name: "proxy-certs", MountPath: "/certs"}},
+		},
+	}
+	podTemplate.Spec.Volumes = []corev1.Volume{secretVolume("proxy-certs"), secretVolume("unmounted")}
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+
+	r := newTestReconciler()
+	g.Expect(r.DetectManagedSecretReferences(podTemplate, infisicalSecret)).To(HaveLen(4))
+
+	// references of the skipped sidecar, including the volume only it mounts, are not detected
+	infisicalSecret.Spec.ScanContainers = []string{"api"}
+	g.Expect(r.DetectManagedSecretReferences(podTemplate, infisicalSecret)).To(Equal([]SecretReferenceMatch{
+		{Source: REFERENCE_SOURCE_ENV, Container: "api", Key: "DB_PASS", Variable: "DB_PASS"},
+		{Source: REFERENCE_SOURCE_VOLUME},
+	}))
+	g.Expect(podTemplate.Spec.Containers).To(HaveLen(2))
+
+	// a workload is not matched when only skipped containers consume the managed secret
+	podTemplate.Spec.Containers[0].Env = nil
+	podTemplate.Spec.Volumes = []corev1.Volume{secretVolume("proxy-certs")}
+	deployment := v1.Deployment{}
+	deployment.Spec.Template = podTemplate
+	g.Expect(r.IsWorkloadUsingManagedSecret(NewDeploymentWorkload(&deployment), infisicalSecret)).To(BeFalse())
+
+	infisicalSecret.Spec.ScanContainers = nil
+	g.Expect(r.IsWorkloadUsingManagedSecret(NewDeploymentWorkload(&deployment), infisicalSecret)).To(BeTrue())
+}
+
+func TestScanContainersRestrictsInitContainers(t *testing.T) {
+	g := NewWithT(t)
+
+	podTemplate := corev1.PodTemplateSpec{}
+	podTemplate.Spec.InitContainers = []corev1.Container{{
+		Name:         "migrate",
+		VolumeMounts: []corev1.VolumeMount{{Name: "migration-credentials", MountPath: "/credentials"}},
+	}}
+	podTemplate.Spec.Containers = []corev1.Container{{Name: "api"}}
+	podTemplate.Spec.Volumes = []corev1.Volume{{
+		Name:         "migration-credentials",
+		VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "managed-secret"}},
+	}}
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	r := newTestReconciler()
+
+	// the volume is only mounted by an init container which is not scanned
+	infisicalSecret.Spec.ScanContainers = []string{"api"}
+	g.Expect(r.DetectManagedSecretReferences(podTemplate, infisicalSecret)).To(BeEmpty())
+	g.Expect(getScannedPodTemplate(podTemplate, infisicalSecret.Spec.ScanContainers).Spec.InitContainers).To(BeEmpty())
+
+	infisicalSecret.Spec.ScanContainers = []string{"api", "migrate"}
+	g.Expect(r.DetectManagedSecretReferences(podTemplate, infisicalSecret)).To(Equal([]SecretReferenceMatch{{Source: REFERENCE_SOURCE_VOLUME, Container: "migrate"}}))
+	g.Expect(podTemplate.Spec.InitContainers).To(HaveLen(1))
+}
+
+// Detection is based on references only. Variables composed from a secret backed variable through $(VAR) must not
+// produce extra references, and the secretKeyRef they are built from is enough for the workload to be restarted
+func TestTransitiveEnvReferenceRestartsDeployment(t *testing.T) {
+	g := NewWithT(t)
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+	deployment := &v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "api",
+			Namespace:   "default",
+			Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1"},
+		},
+	}
+	deployment.Spec.Template.Annotations = map[string]string{versionKey: "v1"}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "api",
+		Env: []corev1.EnvVar{
+			{Name: "DB_PASS", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"},
+				Key:                  "DB_PASS",
+			}}},
+			{Name: "DB_URL", Value: "postgres://app:$(DB_PASS)@db:5432/app"},
+		},
+	}}
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	r := newTestReconciler(managedSecret, deployment)
+	r.ReferenceDetectors = NewReferenceDetectorRegistry()
+
+	g.Expect(r.DetectManagedSecretReferences(deployment.Spec.Template, infisicalSecret)).To(Equal([]SecretReferenceMatch{
+		{Detector: BUILTIN_REFERENCE_DETECTOR, Source: REFERENCE_SOURCE_ENV, Container: "api", Key: "DB_PASS", Variable: "DB_PASS"},
+	}))
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(context.Background(), infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total.Restarted).To(Equal(1))
+
+	restartedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(context.Background(), client.ObjectKeyFromObject(deployment), restartedDeployment)).To(Succeed())
+	g.Expect(restartedDeployment.Spec.Template.Annotations[versionKey]).To(Equal("v2"))
+	g.Expect(restartedDeployment.Spec.Template.Annotations[DEPLOYMENT_RELOAD_REASON_ANNOTATION]).To(Equal(RELOAD_REASON_DATA_CHANGED))
+}
+
+func TestMinWorkloadAgeSkipsFreshlyDeployedWorkloads(t *testing.T) {
+	g := NewWithT(t)
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	deploymentCreatedAt := func(name string, created time.Time) *v1.Deployment {
+		deployment := &v1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(created),
+				Annotations:       map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1"},
+			},
+		}
+		deployment.Spec.Template.Annotations = map[string]string{versionKey: "v1"}
+		deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+			Name: "api",
+			EnvFrom: []corev1.EnvFromSource{{
+				SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+			}},
+		}}
+		return deployment
+	}
+
+	fresh := deploymentCreatedAt("fresh", time.Now().Add(-time.Minute))
+	established := deploymentCreatedAt("established", time.Now().Add(-time.Hour))
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+	infisicalSecret.Spec.MinWorkloadAgeSeconds = 600
+
+	r := newTestReconciler(managedSecret, fresh, established)
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(context.Background(), infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 2, Restarted: 1, Adopted: 1}))
+
+	freshDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(context.Background(), client.ObjectKeyFromObject(fresh), freshDeployment)).To(Succeed())
+	g.Expect(freshDeployment.Annotations[versionKey]).To(Equal("v2"))
+	g.Expect(freshDeployment.Spec.Template.Annotations[versionKey]).To(Equal("v1"))
+
+	establishedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(context.Background(), client.ObjectKeyFromObject(established), establishedDeployment)).To(Succeed())
+	g.Expect(establishedDeployment.Spec.Template.Annotations[versionKey]).To(Equal("v2"))
+}
+
+func TestRestartOnlyOutdatedPodsRecordsTheVersionWhenSkipping(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+	secretModified := time.Now().Add(-time.Hour)
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "managed-secret",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(secretModified),
+			Annotations:       map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	deploymentWithPods := func(name string, podsCreated ...time.Time) []client.Object {
+		labels := map[string]string{"app": name}
+		deployment := &v1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1"},
+			},
+			Spec: v1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+		}
+		deployment.Spec.Template.Annotations = map[string]string{versionKey: "v1"}
+		deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+			Name: "api",
+			EnvFrom: []corev1.EnvFromSource{{
+				SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+			}},
+		}}
+
+		objects := []client.Object{deployment}
+		for i, created := range podsCreated {
+			objects = append(objects, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				Name:              fmt.Sprintf("%s-%d", name, i),
+				Namespace:         "default",
+				Labels:            labels,
+				CreationTimestamp: metav1.NewTime(created),
+			}})
+		}
+		return objects
+	}
+
+	objects := []client.Object{managedSecret}
+	objects = append(objects, deploymentWithPods("fresh", secretModified.Add(time.Minute))...)
+	objects = append(objects, deploymentWithPods("outdated", secretModified.Add(-time.Minute), secretModified.Add(time.Minute))...)
+	objects = append(objects, deploymentWithPods("scaled-down")...)
+	r := newTestReconciler(objects...)
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+	infisicalSecret.Spec.RestartOnlyOutdatedPods = pointer.Bool(true)
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 3, Restarted: 1, Skipped: 2}))
+
+	// workloads with only fresh pods, or no pods at all, have nothing to restart. They record the version without touching their pod template
+	for _, name := range []string{"fresh", "scaled-down"} {
+		deployment := &v1.Deployment{}
+		g.Expect(r.Client.Get(ctx, client.ObjectKey{Name: name, Namespace: "default"}, deployment)).To(Succeed())
+		recordedVersion, _ := r.GetRecordedSecretVersion(NewDeploymentWorkload(deployment), "managed-secret")
+		g.Expect(recordedVersion).To(Equal("v2"))
+		g.Expect(deployment.Annotations[DEPLOYMENT_SKIPPED_RESTART_ANNOTATION_PREFIX+".managed-secret"]).To(Equal("v2"))
+		g.Expect(deployment.Spec.Template.Annotations[versionKey]).To(Equal("v1"))
+	}
+
+	outdatedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKey{Name: "outdated", Namespace: "default"}, outdatedDeployment)).To(Succeed())
+	g.Expect(outdatedDeployment.Spec.Template.Annotations[versionKey]).To(Equal("v2"))
+
+	// the skipped workloads are up to date on the next resync
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 3}))
+}
+
+// Deployment consuming the managed secret which never recorded a version of it
+func newUnobservedDeployment(name string) *v1.Deployment {
+	deployment := &v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "default",
+			Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true"},
+		},
+	}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "api",
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+		}},
+	}}
+	return deployment
+}
+
+func TestFirstObservationPolicyAdoptRecordsVersionWithoutRestart(t *testing.T) {
+	g := NewWithT(t)
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v1"},
+		},
+	}
+	deployment := newUnobservedDeployment("api")
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+	infisicalSecret.Spec.FirstObservationPolicy = FIRST_OBSERVATION_POLICY_ADOPT
+
+	// the operator itself would restart such workloads
+	r := newTestReconciler(managedSecret, deployment)
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(context.Background(), infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Adopted: 1}))
+
+	adoptedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(context.Background(), client.ObjectKeyFromObject(deployment), adoptedDeployment)).To(Succeed())
+	g.Expect(adoptedDeployment.Annotations[versionKey]).To(Equal("v1"))
+	g.Expect(adoptedDeployment.Spec.Template.Annotations).NotTo(HaveKey(versionKey))
+
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(context.Background(), infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1}))
+}
+
+func TestFirstObservationPolicyRestartTreatsMissingVersionAsOutdated(t *testing.T) {
+	g := NewWithT(t)
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v1"},
+		},
+	}
+	deployment := newUnobservedDeployment("api")
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+	infisicalSecret.Spec.FirstObservationPolicy = FIRST_OBSERVATION_POLICY_RESTART
+
+	// the policy of the InfisicalSecret takes precedence over the operator adopting such workloads
+	r := newTestReconciler(managedSecret, deployment)
+	r.AdoptWorkloadsOnFirstObservation = true
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(context.Background(), infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Restarted: 1}))
+
+	restartedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(context.Background(), client.ObjectKeyFromObject(deployment), restartedDeployment)).To(Succeed())
+	g.Expect(restartedDeployment.Spec.Template.Annotations[versionKey]).To(Equal("v1"))
+	g.Expect(restartedDeployment.Spec.Template.Annotations[DEPLOYMENT_RELOAD_REASON_ANNOTATION]).To(Equal(RELOAD_REASON_SECRET_CREATED))
+}
+
+func TestWorkloadReferencingPreviousNameIsRestarted(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	deployment := &v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "api",
+			Namespace:   "default",
+			Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1"},
+		},
+	}
+	deployment.Spec.Template.Annotations = map[string]string{versionKey: "v1"}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "api",
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "legacy-secret"}},
+		}},
+	}}
+
+	r := newTestReconciler(managedSecret, deployment)
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{}))
+
+	infisicalSecret.Spec.ManagedSecretReference.PreviousNames = []string{"legacy-secret"}
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Restarted: 1}))
+
+	restartedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(deployment), restartedDeployment)).To(Succeed())
+	g.Expect(restartedDeployment.Spec.Template.Annotations[versionKey]).To(Equal("v2"))
+
+	// the first reconcile reported the workload as consuming no managed secret before its previous name was known
+	var events []string
+	for len(r.Recorder.(*record.FakeRecorder).Events) > 0 {
+		events = append(events, <-r.Recorder.(*record.FakeRecorder).Events)
+	}
+	g.Expect(events).To(ContainElement(ContainSubstring("DeprecatedSecretName")))
+}
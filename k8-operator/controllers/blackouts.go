@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	"github.com/Infisical/infisical/k8-operator/packages/schedule"
+)
+
+// upper bound of windows that are chained together when they overlap or follow each other without a gap
+const MAX_CHAINED_BLACKOUT_WINDOWS = 1000
+
+// local time formats accepted for the start and end of a single window, besides RFC 3339
+var blackoutWindowLocalTimeFormats = []string{"2006-01-02T15:04:05", "2006-01-02T15:04"}
+
+// A parsed blackout window. Recurring windows have a schedule, single windows a start and end
+type BlackoutWindow struct {
+	schedule *schedule.Schedule
+	duration time.Duration
+
+	start time.Time
+	end   time.Time
+}
+
+// Returns the end of the window when it is open at the given time
+func (w BlackoutWindow) openUntil(t time.Time) (time.Time, bool) {
+	if w.schedule == nil {
+		return w.end, !t.Before(w.start) && t.Before(w.end)
+	}
+
+	// the latest activation that could still be open is the first one after the window length before t
+	opened := w.schedule.Next(t.Add(-w.duration))
+	if opened.IsZero() || opened.After(t) {
+		return time.Time{}, false
+	}
+	return opened.Add(w.duration), true
+}
+
+// Parses the blackout windows of the InfisicalSecret
+func GetBlackoutWindows(infisicalSecret v1alpha1.InfisicalSecret) ([]BlackoutWindow, error) {
+	var windows []BlackoutWindow
+	for i, timeWindow := range infisicalSecret.Spec.BlackoutWindows {
+		window, err := parseBlackoutWindow(timeWindow)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blackout window [index=%v] [err=%w]", i, err)
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+func parseBlackoutWindow(timeWindow v1alpha1.TimeWindow) (BlackoutWindow, error) {
+	if timeWindow.Cron != "" {
+		if timeWindow.Start != "" || timeWindow.End != "" {
+			return BlackoutWindow{}, fmt.Errorf("a window has either a cron expression or a start and end, not both")
+		}
+
+		if timeWindow.DurationMinutes <= 0 {
+			return BlackoutWindow{}, fmt.Errorf("a recurring window needs a positive durationMinutes")
+		}
+
+		windowSchedule, err := schedule.Parse(timeWindow.Cron, timeWindow.TimeZone)
+		if err != nil {
+			return BlackoutWindow{}, err
+		}
+
+		return BlackoutWindow{schedule: windowSchedule, duration: time.Duration(timeWindow.DurationMinutes) * time.Minute}, nil
+	}
+
+	location := time.UTC
+	if timeWindow.TimeZone != "" {
+		var err error
+		location, err = time.LoadLocation(timeWindow.TimeZone)
+		if err != nil {
+			return BlackoutWindow{}, fmt.Errorf("unknown time zone [timeZone=%s] [err=%s]", timeWindow.TimeZone, err)
+		}
+	}
+
+	start, err := parseBlackoutWindowTime(timeWindow.Start, location)
+	if err != nil {
+		return BlackoutWindow{}, fmt.Errorf("invalid start [err=%w]", err)
+	}
+
+	end, err := parseBlackoutWindowTime(timeWindow.End, location)
+	if err != nil {
+		return BlackoutWindow{}, fmt.Errorf("invalid end [err=%w]", err)
+	}
+
+	if !end.After(start) {
+		return BlackoutWindow{}, fmt.Errorf("end [end=%s] must be after start [start=%s]", timeWindow.End, timeWindow.Start)
+	}
+
+	return BlackoutWindow{start: start, end: end}, nil
+}
+
+func parseBlackoutWindowTime(value string, location *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("a window needs either a cron expression or a start and end")
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	for _, format := range blackoutWindowLocalTimeFormats {
+		if t, err := time.ParseInLocation(format, value, location); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("[time=%s] is neither in RFC 3339 format nor a local time such as 2024-12-20T18:00", value)
+}
+
+// Returns the time at which restarts are permitted again, or the zero time when no window is open.
+// Windows that overlap or follow each other without a gap are treated as one, so restarts only resume once all of them have closed
+func GetRestartsPermittedAt(windows []BlackoutWindow, now time.Time) time.Time {
+	permittedAt := now
+	for i := 0; i < MAX_CHAINED_BLACKOUT_WINDOWS; i++ {
+		latestEnd, isOpen := permittedAt, false
+		for _, window := range windows {
+			if end, open := window.openUntil(permittedAt); open && end.After(latestEnd) {
+				latestEnd, isOpen = end, true
+			}
+		}
+
+		if !isOpen {
+			break
+		}
+		permittedAt = latestEnd
+	}
+
+	if permittedAt.Equal(now) {
+		return time.Time{}
+	}
+	return permittedAt
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestGetRestartsPermittedAt(t *testing.T) {
+	g := NewWithT(t)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.BlackoutWindows = []secretsv1alpha1.TimeWindow{
+		// business hours on weekdays
+		{Cron: "0 9 * * 1-5", DurationMinutes: 8 * 60, TimeZone: "Europe/Berlin"},
+		// a code freeze starting during business hours
+		{Start: "2024-03-11T16:00", End: "2024-03-11T19:30", TimeZone: "Europe/Berlin"},
+		// followed by a maintenance window without a gap
+		{Start: "2024-03-11T18:30:00Z", End: "2024-03-11T20:00:00Z"},
+	}
+
+	windows, err := GetBlackoutWindows(infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	testCases := map[string]struct {
+		now         time.Time
+		permittedAt time.Time
+	}{
+		"before business hours":            {time.Date(2024, 3, 11, 8, 59, 0, 0, berlin), time.Time{}},
+		"overlapping and chained windows":  {time.Date(2024, 3, 11, 10, 0, 0, 0, berlin), time.Date(2024, 3, 11, 20, 0, 0, 0, time.UTC)},
+		"inside the code freeze":           {time.Date(2024, 3, 11, 18, 0, 0, 0, berlin), time.Date(2024, 3, 11, 20, 0, 0, 0, time.UTC)},
+		"after all windows closed":         {time.Date(2024, 3, 11, 20, 0, 0, 0, time.UTC), time.Time{}},
+		"business hours of the next day":   {time.Date(2024, 3, 12, 16, 59, 0, 0, berlin), time.Date(2024, 3, 12, 17, 0, 0, 0, berlin)},
+		"business hours closed on weekend": {time.Date(2024, 3, 16, 10, 0, 0, 0, berlin), time.Time{}},
+	}
+
+	for name, testCase := range testCases {
+		permittedAt := GetRestartsPermittedAt(windows, testCase.now)
+		g.Expect(permittedAt.Equal(testCase.permittedAt)).To(BeTrue(), "%s: got %v", name, permittedAt)
+	}
+
+	for _, invalidWindow := range []secretsv1alpha1.TimeWindow{
+		{Cron: "0 9 * * *"},
+		{Cron: "0 9 * * *", DurationMinutes: 60, Start: "2024-03-11T16:00", End: "2024-03-11T19:30"},
+		{Start: "2024-03-11T16:00"},
+		{Start: "2024-03-11T16:00", End: "2024-03-11T15:00"},
+		{Start: "next monday", End: "2024-03-11T15:00"},
+	} {
+		infisicalSecret.Spec.BlackoutWindows = []secretsv1alpha1.TimeWindow{invalidWindow}
+		_, err := GetBlackoutWindows(infisicalSecret)
+		g.Expect(err).To(HaveOccurred(), "%+v", invalidWindow)
+	}
+}
+
+func TestBlackoutWindowDefersRestarts(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	deployment := &v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "api",
+			Namespace:   "default",
+			Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1"},
+		},
+	}
+	deployment.Spec.Template.Annotations = map[string]string{versionKey: "v1"}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "api",
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+		}},
+	}}
+
+	r := newTestReconciler(managedSecret, deployment)
+
+	windowEnd := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+	infisicalSecret.Spec.BlackoutWindows = []secretsv1alpha1.TimeWindow{{
+		Start: time.Now().Add(-time.Hour).UTC().Format(time.RFC3339),
+		End:   windowEnd.Format(time.RFC3339),
+	}}
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Deferred: 1}))
+	g.Expect(outcome.RestartsPermittedAt.Equal(windowEnd)).To(BeTrue())
+
+	// the pending restart is performed once the window has closed
+	infisicalSecret.Spec.BlackoutWindows = nil
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Restarted: 1}))
+	g.Expect(outcome.RestartsPermittedAt.IsZero()).To(BeTrue())
+
+	restartedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(deployment), restartedDeployment)).To(Succeed())
+	g.Expect(restartedDeployment.Spec.Template.Annotations[versionKey]).To(Equal("v2"))
+}
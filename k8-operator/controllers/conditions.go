@@ -3,13 +3,44 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// Writes the status only when it differs from the status before it was computed. Every write changes the resourceVersion of the InfisicalSecret
+// and sends a watch event, so unchanged statuses would cause API load and further reconciles for nothing
+func (r *InfisicalSecretReconciler) updateStatusIfChanged(ctx context.Context, infisicalSecret *v1alpha1.InfisicalSecret, previousStatus v1alpha1.InfisicalSecretStatus) error {
+	if equality.Semantic.DeepEqual(previousStatus, infisicalSecret.Status) {
+		return nil
+	}
+
+	// the status computed by this reconcile is written onto the latest InfisicalSecret when another writer updated it in the meantime
+	status := *infisicalSecret.Status.DeepCopy()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := r.Client.Status().Update(ctx, infisicalSecret)
+		if !errors.IsConflict(err) {
+			return err
+		}
+
+		if err := r.Client.Get(ctx, client.ObjectKeyFromObject(infisicalSecret), infisicalSecret); err != nil {
+			return err
+		}
+		infisicalSecret.Status = *status.DeepCopy()
+		return err
+	})
+}
+
 func (r *InfisicalSecretReconciler) SetReadyToSyncSecretsConditions(ctx context.Context, infisicalSecret *v1alpha1.InfisicalSecret, errorToConditionOn error) error {
+	previousStatus := *infisicalSecret.Status.DeepCopy()
+
 	if infisicalSecret.Status.Conditions == nil {
 		infisicalSecret.Status.Conditions = []metav1.Condition{}
 	}
@@ -37,10 +68,12 @@ func (r *InfisicalSecretReconciler) SetReadyToSyncSecretsConditions(ctx context.
 		})
 	}
 
-	return r.Client.Status().Update(ctx, infisicalSecret)
+	return r.updateStatusIfChanged(ctx, infisicalSecret, previousStatus)
 }
 
 func (r *InfisicalSecretReconciler) SetInfisicalTokenLoadCondition(ctx context.Context, infisicalSecret *v1alpha1.InfisicalSecret, errorToConditionOn error) {
+	previousStatus := *infisicalSecret.Status.DeepCopy()
+
 	if infisicalSecret.Status.Conditions == nil {
 		infisicalSecret.Status.Conditions = []metav1.Condition{}
 	}
@@ -61,35 +94,252 @@ func (r *InfisicalSecretReconciler) SetInfisicalTokenLoadCondition(ctx context.C
 		})
 	}
 
-	err := r.Client.Status().Update(ctx, infisicalSecret)
+	err := r.updateStatusIfChanged(ctx, infisicalSecret, previousStatus)
 	if err != nil {
 		fmt.Println("Could not set condition for LoadedInfisicalToken")
 	}
 }
 
-func (r *InfisicalSecretReconciler) SetInfisicalAutoRedeploymentReady(ctx context.Context, infisicalSecret *v1alpha1.InfisicalSecret, numDeployments int, errorToConditionOn error) {
+func (r *InfisicalSecretReconciler) SetInvalidReferenceCondition(ctx context.Context, infisicalSecret *v1alpha1.InfisicalSecret, errorToConditionOn error) {
+	previousStatus := *infisicalSecret.Status.DeepCopy()
+
+	if infisicalSecret.Status.Conditions == nil {
+		infisicalSecret.Status.Conditions = []metav1.Condition{}
+	}
+
+	if errorToConditionOn != nil {
+		meta.SetStatusCondition(&infisicalSecret.Status.Conditions, metav1.Condition{
+			Type:    "secrets.infisical.com/InvalidReference",
+			Status:  metav1.ConditionTrue,
+			Reason:  "CrossNamespaceReference",
+			Message: fmt.Sprintf("%v", errorToConditionOn),
+		})
+	} else {
+		meta.SetStatusCondition(&infisicalSecret.Status.Conditions, metav1.Condition{
+			Type:    "secrets.infisical.com/InvalidReference",
+			Status:  metav1.ConditionFalse,
+			Reason:  "OK",
+			Message: "All references of the InfisicalSecret are within its allowed scope",
+		})
+	}
+
+	err := r.updateStatusIfChanged(ctx, infisicalSecret, previousStatus)
+	if err != nil {
+		fmt.Println("Could not set condition for InvalidReference")
+	}
+}
+
+// Sets the AutoRedeployReady condition and the workloads tracked in the status. Without the status, restarted workloads cannot be told apart
+// from outdated ones, so an error is returned when it cannot be written
+func (r *InfisicalSecretReconciler) SetInfisicalAutoRedeploymentReady(ctx context.Context, infisicalSecret *v1alpha1.InfisicalSecret, outcome ReconcileOutcome, errorToConditionOn error) error {
+	previousStatus := *infisicalSecret.Status.DeepCopy()
+
 	if infisicalSecret.Status.Conditions == nil {
 		infisicalSecret.Status.Conditions = []metav1.Condition{}
 	}
 
 	if errorToConditionOn == nil {
+		message := fmt.Sprintf("Infisical has found %v workloads which are ready to be auto redeployed when secrets change", outcome.Total.Matched)
+		if outcome.Total.Matched > 0 {
+			message = fmt.Sprintf("%s (%s)", message, outcome.Breakdown(func(c WorkloadCounts) int { return c.Matched }))
+		}
+
 		meta.SetStatusCondition(&infisicalSecret.Status.Conditions, metav1.Condition{
 			Type:    "secrets.infisical.com/AutoRedeployReady",
 			Status:  metav1.ConditionTrue,
 			Reason:  "OK",
-			Message: fmt.Sprintf("Infisical has found %v deployments which are ready to be auto redeployed when secrets change", numDeployments),
+			Message: message,
 		})
 	} else {
 		meta.SetStatusCondition(&infisicalSecret.Status.Conditions, metav1.Condition{
 			Type:    "secrets.infisical.com/AutoRedeployReady",
 			Status:  metav1.ConditionFalse,
 			Reason:  "Error",
-			Message: fmt.Sprintf("Failed reconcile deployments because: %v", errorToConditionOn),
+			Message: fmt.Sprintf("Failed reconcile workloads because: %v", errorToConditionOn),
+		})
+	}
+
+	// the outcome of the last reconcile that restarted workloads or failed to, so that the impact of a rotation stays visible until the next one
+	if outcome.Total.Failed > 0 {
+		meta.SetStatusCondition(&infisicalSecret.Status.Conditions, metav1.Condition{
+			Type:    "secrets.infisical.com/WorkloadsReloaded",
+			Status:  metav1.ConditionFalse,
+			Reason:  "ReloadFailed",
+			Message: fmt.Sprintf("Failed to reload %v of %v workloads (%s). Restarted %v workloads", outcome.Total.Failed, outcome.Total.Matched, outcome.Breakdown(func(c WorkloadCounts) int { return c.Failed }), outcome.Total.Restarted),
+		})
+	} else if outcome.Total.Restarted > 0 {
+		meta.SetStatusCondition(&infisicalSecret.Status.Conditions, metav1.Condition{
+			Type:    "secrets.infisical.com/WorkloadsReloaded",
+			Status:  metav1.ConditionTrue,
+			Reason:  "Reloaded",
+			Message: fmt.Sprintf("Restarted %v workloads (%s) to pick up the latest secrets", outcome.Total.Restarted, outcome.Breakdown(func(c WorkloadCounts) int { return c.Restarted })),
+		})
+	}
+
+	infisicalSecret.Status.FailedWorkloads = GetFailedWorkloads(infisicalSecret.Status.FailedWorkloads, outcome, errorToConditionOn == nil)
+
+	infisicalSecret.Status.RestartsPermittedAt = nil
+	if !outcome.RestartsPermittedAt.IsZero() {
+		infisicalSecret.Status.RestartsPermittedAt = &metav1.Time{Time: outcome.RestartsPermittedAt}
+	}
+
+	if infisicalSecret.Spec.ReloadBatchSize == 0 {
+		infisicalSecret.Status.ReloadBatches = nil
+	} else if outcome.ReloadBatches != nil {
+		infisicalSecret.Status.ReloadBatches = outcome.ReloadBatches
+	}
+
+	if !infisicalSecret.Spec.RestartOnlyForConsumedKeys {
+		infisicalSecret.Status.SecretKeyHashes = nil
+	} else if outcome.SecretKeyHashes != nil {
+		infisicalSecret.Status.SecretKeyHashes = outcome.SecretKeyHashes
+	}
+
+	if outcome.ContentChecksum != "" {
+		infisicalSecret.Status.ContentChecksum = outcome.ContentChecksum
+	}
+
+	if !infisicalSecret.Spec.RestartedAtOnly {
+		infisicalSecret.Status.ReloadedWorkloads = nil
+	} else if outcome.ReloadedWorkloads != nil {
+		infisicalSecret.Status.ReloadedWorkloads = outcome.ReloadedWorkloads
+	}
+
+	if outcome.HeldWorkloads != nil {
+		infisicalSecret.Status.HeldWorkloads = nil
+		if len(outcome.HeldWorkloads) > 0 {
+			infisicalSecret.Status.HeldWorkloads = outcome.HeldWorkloads
+		}
+	}
+
+	if infisicalSecret.Spec.RestartedAtOnly {
+		infisicalSecret.Status.SealedWorkloads = nil
+	} else if outcome.SealedWorkloads != nil {
+		infisicalSecret.Status.SealedWorkloads = nil
+		for workload := range outcome.SealedWorkloads {
+			infisicalSecret.Status.SealedWorkloads = append(infisicalSecret.Status.SealedWorkloads, workload)
+		}
+		sort.Strings(infisicalSecret.Status.SealedWorkloads)
+	}
+
+	if infisicalSecret.Spec.PreRestartJob == nil {
+		infisicalSecret.Status.PreRestartJob = nil
+	} else if outcome.PreRestartJob != nil {
+		infisicalSecret.Status.PreRestartJob = outcome.PreRestartJob
+	}
+
+	if infisicalSecret.Spec.PostRestartJob == nil {
+		infisicalSecret.Status.PostRestartJob = nil
+	} else if outcome.PostRestartJob != nil {
+		infisicalSecret.Status.PostRestartJob = outcome.PostRestartJob
+	}
+
+	if err := r.updateStatusIfChanged(ctx, infisicalSecret, previousStatus); err != nil {
+		return fmt.Errorf("could not set condition for AutoRedeployReady [err=%w]", err)
+	}
+	return nil
+}
+
+// Builds the failed workloads of the status from the failures of the latest reconcile, counting how many reconciles in a row each workload failed in.
+// Workloads that did not fail again are dropped, unless the reconcile stopped early and may not have reached them
+func GetFailedWorkloads(previous []v1alpha1.WorkloadError, outcome ReconcileOutcome, reconcileCompleted bool) []v1alpha1.WorkloadError {
+	previousFailureCounts := map[string]int{}
+	for _, failedWorkload := range previous {
+		previousFailureCounts[failedWorkload.Workload] = failedWorkload.FailureCount
+	}
+
+	var failedWorkloads []v1alpha1.WorkloadError
+	for workloadRef, message := range outcome.Failures {
+		failedWorkloads = append(failedWorkloads, v1alpha1.WorkloadError{
+			Workload:     workloadRef,
+			Message:      message,
+			FailureCount: previousFailureCounts[workloadRef] + 1,
+		})
+	}
+
+	if !reconcileCompleted {
+		for _, failedWorkload := range previous {
+			if _, failedAgain := outcome.Failures[failedWorkload.Workload]; !failedAgain {
+				failedWorkloads = append(failedWorkloads, failedWorkload)
+			}
+		}
+	}
+
+	sort.Slice(failedWorkloads, func(i, j int) bool {
+		return failedWorkloads[i].Workload < failedWorkloads[j].Workload
+	})
+
+	return failedWorkloads
+}
+
+func (r *InfisicalSecretReconciler) SetWorkloadRolloutsCompleteCondition(ctx context.Context, infisicalSecret *v1alpha1.InfisicalSecret, pendingRollouts []string, errorToConditionOn error) {
+	previousStatus := *infisicalSecret.Status.DeepCopy()
+
+	if infisicalSecret.Status.Conditions == nil {
+		infisicalSecret.Status.Conditions = []metav1.Condition{}
+	}
+
+	if errorToConditionOn != nil {
+		meta.SetStatusCondition(&infisicalSecret.Status.Conditions, metav1.Condition{
+			Type:    "secrets.infisical.com/WorkloadRolloutsComplete",
+			Status:  metav1.ConditionUnknown,
+			Reason:  "Error",
+			Message: fmt.Sprintf("Failed to check the rollout of redeployed workloads because: %v", errorToConditionOn),
+		})
+	} else if len(pendingRollouts) > 0 {
+		meta.SetStatusCondition(&infisicalSecret.Status.Conditions, metav1.Condition{
+			Type:    "secrets.infisical.com/WorkloadRolloutsComplete",
+			Status:  metav1.ConditionFalse,
+			Reason:  "RolloutInProgress",
+			Message: fmt.Sprintf("The pods carrying the latest secrets are not yet available for these workloads: %v", pendingRollouts),
+		})
+	} else {
+		meta.SetStatusCondition(&infisicalSecret.Status.Conditions, metav1.Condition{
+			Type:    "secrets.infisical.com/WorkloadRolloutsComplete",
+			Status:  metav1.ConditionTrue,
+			Reason:  "OK",
+			Message: "All redeployed workloads are running pods with the latest secrets",
+		})
+	}
+
+	err := r.updateStatusIfChanged(ctx, infisicalSecret, previousStatus)
+	if err != nil {
+		fmt.Println("Could not set condition for WorkloadRolloutsComplete")
+	}
+}
+
+func (r *InfisicalSecretReconciler) SetScheduledRestartsCondition(ctx context.Context, infisicalSecret *v1alpha1.InfisicalSecret, pendingRestarts []string, nextRestart time.Time, errorToConditionOn error) {
+	previousStatus := *infisicalSecret.Status.DeepCopy()
+
+	if infisicalSecret.Status.Conditions == nil {
+		infisicalSecret.Status.Conditions = []metav1.Condition{}
+	}
+
+	if errorToConditionOn != nil {
+		meta.SetStatusCondition(&infisicalSecret.Status.Conditions, metav1.Condition{
+			Type:    "secrets.infisical.com/ScheduledRestartsPending",
+			Status:  metav1.ConditionUnknown,
+			Reason:  "Error",
+			Message: fmt.Sprintf("Failed to check the scheduled restarts because: %v", errorToConditionOn),
+		})
+	} else if len(pendingRestarts) > 0 {
+		meta.SetStatusCondition(&infisicalSecret.Status.Conditions, metav1.Condition{
+			Type:    "secrets.infisical.com/ScheduledRestartsPending",
+			Status:  metav1.ConditionTrue,
+			Reason:  "RotationPending",
+			Message: fmt.Sprintf("These workloads will be restarted at %v to pick up rotated secrets: %v", nextRestart.Format(time.RFC3339), pendingRestarts),
+		})
+	} else {
+		meta.SetStatusCondition(&infisicalSecret.Status.Conditions, metav1.Condition{
+			Type:    "secrets.infisical.com/ScheduledRestartsPending",
+			Status:  metav1.ConditionFalse,
+			Reason:  "NothingPending",
+			Message: "No secret rotations are waiting for the restart schedule",
 		})
 	}
 
-	err := r.Client.Status().Update(ctx, infisicalSecret)
+	err := r.updateStatusIfChanged(ctx, infisicalSecret, previousStatus)
 	if err != nil {
-		fmt.Println("Could not set condition for AutoRedeployReady")
+		fmt.Println("Could not set condition for ScheduledRestartsPending")
 	}
 }
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestGetFailedWorkloads(t *testing.T) {
+	g := NewWithT(t)
+
+	previous := []secretsv1alpha1.WorkloadError{
+		{Workload: "Deployment/default/api", Message: "conflict", FailureCount: 2},
+		{Workload: "StatefulSet/default/db", Message: "forbidden", FailureCount: 1},
+	}
+
+	outcome := ReconcileOutcome{Failures: map[string]string{
+		"Deployment/default/api":  "timeout",
+		"DaemonSet/default/agent": "forbidden",
+	}}
+
+	g.Expect(GetFailedWorkloads(previous, outcome, true)).To(Equal([]secretsv1alpha1.WorkloadError{
+		{Workload: "DaemonSet/default/agent", Message: "forbidden", FailureCount: 1},
+		{Workload: "Deployment/default/api", Message: "timeout", FailureCount: 3},
+	}))
+
+	// workloads which were possibly not reached keep their previous failure
+	g.Expect(GetFailedWorkloads(previous, outcome, false)).To(Equal([]secretsv1alpha1.WorkloadError{
+		{Workload: "DaemonSet/default/agent", Message: "forbidden", FailureCount: 1},
+		{Workload: "Deployment/default/api", Message: "timeout", FailureCount: 3},
+		{Workload: "StatefulSet/default/db", Message: "forbidden", FailureCount: 1},
+	}))
+
+	g.Expect(GetFailedWorkloads(previous, ReconcileOutcome{}, true)).To(BeEmpty())
+}
+
+func TestUnchangedStatusIsNotWritten(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	infisicalSecret := &secretsv1alpha1.InfisicalSecret{ObjectMeta: metav1.ObjectMeta{Name: "app-secrets", Namespace: "default"}}
+	r := newTestReconciler(infisicalSecret)
+
+	outcome := ReconcileOutcome{}
+	outcome.record(WORKLOAD_KIND_DEPLOYMENT, WorkloadCounts{Matched: 1, Restarted: 1})
+
+	reconcileStatus := func(outcome ReconcileOutcome) string {
+		current := &secretsv1alpha1.InfisicalSecret{}
+		g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(infisicalSecret), current)).To(Succeed())
+		r.SetInfisicalAutoRedeploymentReady(ctx, current, outcome, nil)
+
+		g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(infisicalSecret), current)).To(Succeed())
+		return current.ResourceVersion
+	}
+
+	resourceVersion := reconcileStatus(outcome)
+
+	// a reconcile where nothing changed computes the same status
+	g.Expect(reconcileStatus(outcome)).To(Equal(resourceVersion))
+
+	outcome.recordFailure(NewDeploymentWorkload(&v1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "default"}}), fmt.Errorf("conflict"))
+	g.Expect(reconcileStatus(outcome)).NotTo(Equal(resourceVersion))
+}
+
+// Fails the first status updates with a conflict, like when another writer updated the InfisicalSecret in the meantime
+type conflictingStatusClient struct {
+	client.Client
+	conflicts int
+}
+
+type conflictingStatusWriter struct {
+	client.SubResourceWriter
+	client *conflictingStatusClient
+}
+
+func (c *conflictingStatusClient) Status() client.SubResourceWriter {
+	return &conflictingStatusWriter{SubResourceWriter: c.Client.Status(), client: c}
+}
+
+func (w *conflictingStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	if w.client.conflicts > 0 {
+		w.client.conflicts--
+		return errors.NewConflict(schema.GroupResource{Group: "secrets.infisical.com", Resource: "infisicalsecrets"}, obj.GetName(), fmt.Errorf("the object has been modified"))
+	}
+	return w.SubResourceWriter.Update(ctx, obj, opts...)
+}
+
+func TestAutoRedeploymentStatusIsRetriedOnConflict(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	infisicalSecret := &secretsv1alpha1.InfisicalSecret{ObjectMeta: metav1.ObjectMeta{Name: "app-secrets", Namespace: "default"}}
+	infisicalSecret.Spec.RestartedAtOnly = true
+	r := newTestReconciler(infisicalSecret)
+	conflictingClient := &conflictingStatusClient{Client: r.Client, conflicts: 2}
+	r.Client = conflictingClient
+
+	outcome := ReconcileOutcome{ReloadedWorkloads: map[string]string{"Deployment/default/api": "v2"}}
+	outcome.record(WORKLOAD_KIND_DEPLOYMENT, WorkloadCounts{Matched: 1, Restarted: 1})
+
+	current := infisicalSecret.DeepCopy()
+	g.Expect(r.SetInfisicalAutoRedeploymentReady(ctx, current, outcome, nil)).To(Succeed())
+
+	stored := &secretsv1alpha1.InfisicalSecret{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(infisicalSecret), stored)).To(Succeed())
+	g.Expect(stored.Status.ReloadedWorkloads).To(Equal(map[string]string{"Deployment/default/api": "v2"}))
+
+	// a status that keeps conflicting is returned so the reconcile is requeued
+	conflictingClient.conflicts = 100
+	outcome.ReloadedWorkloads = map[string]string{"Deployment/default/api": "v3"}
+	err := r.SetInfisicalAutoRedeploymentReady(ctx, current, outcome, nil)
+	g.Expect(errors.IsConflict(err)).To(BeTrue())
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// hash of the managed secret keys consumed by the workload when it was last restarted. Never contains secret values in plain text
+const DEPLOYMENT_CONSUMED_KEYS_HASH_ANNOTATION_PREFIX = "secrets.infisical.com/consumed-keys-hash"
+
+// Returns the keys of the secret the references consume, or nil when the whole secret has to be considered consumed.
+// That is the case when a reference consumes the whole secret (e.g. envFrom or a secret volume without items), and when a referenced key cannot be
+// resolved statically, such as a key left templated by a chart or a key that does not exist in the secret. Restarting on any change is then the only safe choice
+func getConsumedKeys(matches []SecretReferenceMatch, secret corev1.Secret) []string {
+	seen := map[string]bool{}
+	var keys []string
+
+	for _, match := range matches {
+		if !isStaticallyResolvableKey(match.Key, secret) {
+			return nil
+		}
+
+		if !seen[match.Key] {
+			seen[match.Key] = true
+			keys = append(keys, match.Key)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func isStaticallyResolvableKey(key string, secret corev1.Secret) bool {
+	if key == "" || strings.Contains(key, "{{") || strings.Contains(key, "$(") {
+		return false
+	}
+
+	_, exists := secret.Data[key]
+	return exists
+}
+
+// Hashes the consumed keys of the secret together with their values, keyed with the fingerprint key. All keys are hashed when the consumed keys are unknown.
+// The names of the keys are part of the hash, so adding or removing a key changes it even when the key has an empty value
+func (r *InfisicalSecretReconciler) getConsumedKeysHash(consumedKeys []string, secret corev1.Secret) string {
+	if consumedKeys == nil {
+		for key := range secret.Data {
+			consumedKeys = append(consumedKeys, key)
+		}
+		sort.Strings(consumedKeys)
+	}
+
+	hash := r.newSecretDataHash()
+	for _, key := range consumedKeys {
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+		hash.Write(escapeHashSeparators(secret.Data[key]))
+		hash.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Keys can never contain the separator, but binary values can. Unescaped, a value such as "x\x00B\x00" would hash the same as the value "x" followed by
+// an empty key B. Every separator in a value is followed by 0xff, which no key starts with
+func escapeHashSeparators(value []byte) []byte {
+	if bytes.IndexByte(value, 0) == -1 {
+		return value
+	}
+
+	escaped := make([]byte, 0, len(value)+1)
+	for _, b := range value {
+		escaped = append(escaped, b)
+		if b == 0 {
+			escaped = append(escaped, 0xff)
+		}
+	}
+	return escaped
+}
+
+func (r *InfisicalSecretReconciler) GetConsumedKeysHash(workload Workload, secret corev1.Secret, infisicalSecret v1alpha1.InfisicalSecret) string {
+	return workload.fingerprints.get(workload, secret, func() string {
+		consumedKeys := getConsumedKeys(r.DetectManagedSecretReferences(*workload.PodTemplate, infisicalSecret), secret)
+		return r.getConsumedKeysHash(consumedKeys, secret)
+	})
+}
+
+// Checks if any key consumed by the workload changed since it was last restarted. The keys changed in the current version are used when the workload
+// was reconciled with the version before it, otherwise the hash recorded on the workload. Workloads without either are assumed to have changed
+func (r *InfisicalSecretReconciler) HaveConsumedKeysChanged(workload Workload, secret corev1.Secret, infisicalSecret v1alpha1.InfisicalSecret) bool {
+	if changed, known := r.haveConsumedKeysChangedSinceVersion(workload, secret, infisicalSecret); known {
+		return changed
+	}
+
+	hashAnnotationKey := fmt.Sprintf("%s.%s", DEPLOYMENT_CONSUMED_KEYS_HASH_ANNOTATION_PREFIX, secret.Name)
+
+	previousHash, isRecorded := workload.Metadata.Annotations[hashAnnotationKey]
+	if !isRecorded {
+		return true
+	}
+
+	return previousHash != r.GetConsumedKeysHash(workload, secret, infisicalSecret)
+}
+
+func (r *InfisicalSecretReconciler) recordConsumedKeysHash(workload Workload, secret corev1.Secret, infisicalSecret v1alpha1.InfisicalSecret) {
+	hashAnnotationKey := fmt.Sprintf("%s.%s", DEPLOYMENT_CONSUMED_KEYS_HASH_ANNOTATION_PREFIX, secret.Name)
+	workload.Metadata.Annotations[hashAnnotationKey] = r.GetConsumedKeysHash(workload, secret, infisicalSecret)
+}
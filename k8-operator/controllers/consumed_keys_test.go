@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestUnresolvableKeyRestartsOnAnyChange(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+	hashKey := DEPLOYMENT_CONSUMED_KEYS_HASH_ANNOTATION_PREFIX + ".managed-secret"
+
+	previousSecret := corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "managed-secret", Namespace: "default"},
+		Data:       map[string][]byte{"DB_PASS": []byte("db-password"), "API_KEY": []byte("old-api-key")},
+	}
+
+	rotatedSecret := previousSecret.DeepCopy()
+	rotatedSecret.Annotations = map[string]string{SECRET_VERSION_ANNOTATION: "v2"}
+	rotatedSecret.Data["API_KEY"] = []byte("new-api-key")
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+	infisicalSecret.Spec.RestartOnlyForConsumedKeys = true
+
+	r := newTestReconciler()
+
+	deploymentConsumingKey := func(name string, key string) *v1.Deployment {
+		deployment := &v1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1"},
+			},
+		}
+		deployment.Spec.Template.Annotations = map[string]string{versionKey: "v1"}
+		deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+			Name: "app",
+			Env: []corev1.EnvVar{{Name: "VALUE", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"},
+				Key:                  key,
+			}}}},
+		}}
+
+		// as recorded when the deployment was last restarted for the previous version of the secret
+		deployment.Annotations[hashKey] = r.GetConsumedKeysHash(NewDeploymentWorkload(deployment), previousSecret, infisicalSecret)
+		return deployment
+	}
+
+	unaffected := deploymentConsumingKey("unaffected", "DB_PASS")
+	templated := deploymentConsumingKey("templated", "{{ .Values.secretKey }}")
+
+	r = newTestReconciler(rotatedSecret, unaffected, templated)
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 2, Restarted: 1}))
+
+	unaffectedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(unaffected), unaffectedDeployment)).To(Succeed())
+	g.Expect(unaffectedDeployment.Spec.Template.Annotations[versionKey]).To(Equal("v1"))
+
+	// the key cannot be resolved, so any change of the secret is assumed to affect the workload
+	templatedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(templated), templatedDeployment)).To(Succeed())
+	g.Expect(templatedDeployment.Spec.Template.Annotations[versionKey]).To(Equal("v2"))
+	g.Expect(templatedDeployment.Annotations[hashKey]).To(Equal(r.getConsumedKeysHash(nil, *rotatedSecret)))
+}
+
+func TestConsumedKeysHashIncludesKeySet(t *testing.T) {
+	g := NewWithT(t)
+	r := newTestReconciler()
+
+	secret := corev1.Secret{Data: map[string][]byte{"DB_PASS": []byte("db-password")}}
+	withEmptyKey := corev1.Secret{Data: map[string][]byte{"DB_PASS": []byte("db-password"), "FEATURE_FLAG": {}}}
+	g.Expect(r.getConsumedKeysHash(nil, withEmptyKey)).NotTo(Equal(r.getConsumedKeysHash(nil, secret)))
+
+	// a binary value cannot pass for an additional empty key
+	binaryValue := corev1.Secret{Data: map[string][]byte{"A": []byte("x\x00B\x00")}}
+	valueWithEmptyKey := corev1.Secret{Data: map[string][]byte{"A": []byte("x"), "B": {}}}
+	g.Expect(r.getConsumedKeysHash(nil, binaryValue)).NotTo(Equal(r.getConsumedKeysHash(nil, valueWithEmptyKey)))
+
+	// the hash is keyed, so it cannot be recomputed from guessed values without the fingerprint key
+	unkeyedHash := sha256.Sum256([]byte("DB_PASS\x00db-password\x00"))
+	g.Expect(r.getConsumedKeysHash(nil, secret)).NotTo(Equal(hex.EncodeToString(unkeyedHash[:])))
+
+	otherOperator := newTestReconciler()
+	otherOperator.FingerprintKey = []byte("another-fingerprint-key-of-32-bytes")
+	g.Expect(otherOperator.getConsumedKeysHash(nil, secret)).NotTo(Equal(r.getConsumedKeysHash(nil, secret)))
+}
+
+func TestAddingOrRemovingEmptyKeyRestartsConsumers(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".external-secret"
+
+	// without a version annotation, the fingerprint of the data is the only restart signal
+	externalSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "external-secret", Namespace: "default"},
+		Data:       map[string][]byte{"DB_PASS": []byte("db-password")},
+	}
+	r := newTestReconciler()
+	initialChecksum := r.GetContentChecksum(*externalSecret)
+
+	deployment := &v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "api",
+			Namespace:   "default",
+			Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: initialChecksum},
+		},
+	}
+	deployment.Spec.Template.Annotations = map[string]string{versionKey: initialChecksum}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "api",
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "external-secret"}},
+		}},
+	}}
+
+	r = newTestReconciler(externalSecret, deployment)
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "external-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	updateData := func(update func(data map[string][]byte)) {
+		secret := &corev1.Secret{}
+		g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(externalSecret), secret)).To(Succeed())
+		update(secret.Data)
+		g.Expect(r.Client.Update(ctx, secret)).To(Succeed())
+	}
+
+	updateData(func(data map[string][]byte) { data["FEATURE_FLAG"] = []byte{} })
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Restarted: 1}))
+	checksumWithEmptyKey := outcome.ContentChecksum
+	g.Expect(checksumWithEmptyKey).NotTo(Equal(initialChecksum))
+
+	updateData(func(data map[string][]byte) { delete(data, "FEATURE_FLAG") })
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Restarted: 1}))
+	g.Expect(outcome.ContentChecksum).To(Equal(initialChecksum))
+
+	restartedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(deployment), restartedDeployment)).To(Succeed())
+	g.Expect(restartedDeployment.Spec.Template.Annotations[versionKey]).To(Equal(initialChecksum))
+}
@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Prefix of the version derived from the data of a managed secret that carries no version annotation
+const CONTENT_CHECKSUM_VERSION_PREFIX = "hmac-sha256:"
+
+// Checksum over every key and value of the secret, keyed with the fingerprint key. Only the checksum is ever stored, never the values it is computed from
+func (r *InfisicalSecretReconciler) GetContentChecksum(secret corev1.Secret) string {
+	return CONTENT_CHECKSUM_VERSION_PREFIX + r.getConsumedKeysHash(nil, secret)
+}
+
+// Secrets the operator does not write, such as one synced by another tool that the managed secret reference points at, carry no version annotation.
+// Their checksum is used as their version instead, so any change of their data restarts their consumers like a rotation would.
+// The version is only set on the fetched copy and never written to the secret. Returns true when the checksum is used
+func (r *InfisicalSecretReconciler) useContentChecksumAsVersion(secret *corev1.Secret) bool {
+	if secret.Annotations[SECRET_VERSION_ANNOTATION] != "" {
+		return false
+	}
+
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[SECRET_VERSION_ANNOTATION] = r.GetContentChecksum(*secret)
+	return true
+}
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestSecretWithoutVersionIsReloadedOnContentChange(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".external-secret"
+
+	// a secret written by another tool, without the version annotation of the operator
+	externalSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "external-secret", Namespace: "default"},
+		Data:       map[string][]byte{"DB_PASS": []byte("db-password")},
+	}
+	r := newTestReconciler()
+	initialChecksum := r.GetContentChecksum(*externalSecret)
+
+	deployment := &v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "api",
+			Namespace:   "default",
+			Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: initialChecksum},
+		},
+	}
+	deployment.Spec.Template.Annotations = map[string]string{versionKey: initialChecksum}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "api",
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "external-secret"}},
+		}},
+	}}
+
+	r = newTestReconciler(externalSecret, deployment)
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "external-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1}))
+	g.Expect(outcome.ContentChecksum).To(Equal(initialChecksum))
+	infisicalSecret.Status.ContentChecksum = outcome.ContentChecksum
+
+	changedSecret := &corev1.Secret{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(externalSecret), changedSecret)).To(Succeed())
+	changedSecret.Data["DB_PASS"] = []byte("rotated-password")
+	g.Expect(r.Client.Update(ctx, changedSecret)).To(Succeed())
+
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Restarted: 1}))
+	g.Expect(outcome.ContentChecksum).NotTo(Equal(initialChecksum))
+	g.Expect(outcome.ContentChecksum).NotTo(ContainSubstring("rotated-password"))
+
+	restartedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(deployment), restartedDeployment)).To(Succeed())
+	g.Expect(restartedDeployment.Spec.Template.Annotations[versionKey]).To(Equal(outcome.ContentChecksum))
+
+	// the checksum is never written to the secret itself
+	unchangedSecret := &corev1.Secret{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(externalSecret), unchangedSecret)).To(Succeed())
+	g.Expect(unchangedSecret.Annotations).NotTo(HaveKey(SECRET_VERSION_ANNOTATION))
+}
@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// a DaemonSet restarting more than this share of its pods at once is reported, as node agents such as CNI or logging would be disrupted on many nodes at the same time
+const BROAD_DAEMON_SET_RESTART_RATIO = 0.25
+
+// Returns how many pods of the DaemonSet its controller restarts at once and how many it runs, resolved the same way the daemon set controller does.
+// The operator only changes the pod template, so the pacing of the restart is left to the DaemonSet's own update strategy
+func getDaemonSetMaxUnavailable(daemonSet v1.DaemonSet) (maxUnavailable int, desiredPods int) {
+	desiredPods = int(daemonSet.Status.DesiredNumberScheduled)
+
+	// the value the API server defaults a missing maxUnavailable to
+	unavailable := intstr.FromInt(1)
+	if rollingUpdate := daemonSet.Spec.UpdateStrategy.RollingUpdate; rollingUpdate != nil && rollingUpdate.MaxUnavailable != nil {
+		unavailable = *rollingUpdate.MaxUnavailable
+	}
+
+	maxUnavailable, _ = intstr.GetScaledValueFromIntOrPercent(&unavailable, desiredPods, true)
+	return maxUnavailable, desiredPods
+}
+
+// Describes why restarting the DaemonSet would take down the pods on a broad share of its nodes at once, or returns an empty string when its pacing is safe
+func GetBroadDaemonSetRestartWarning(workload Workload) string {
+	daemonSet, isDaemonSet := workload.Object.(*v1.DaemonSet)
+	if !isDaemonSet || daemonSet.Spec.UpdateStrategy.Type == v1.OnDeleteDaemonSetStrategyType {
+		return ""
+	}
+
+	maxUnavailable, desiredPods := getDaemonSetMaxUnavailable(*daemonSet)
+	if maxUnavailable <= 1 || float64(maxUnavailable) <= BROAD_DAEMON_SET_RESTART_RATIO*float64(desiredPods) {
+		return ""
+	}
+
+	return fmt.Sprintf("%v allows %v of its %v pods to be unavailable at once, so their nodes restart simultaneously. Consider lowering updateStrategy.rollingUpdate.maxUnavailable", workload.Ref(), maxUnavailable, desiredPods)
+}
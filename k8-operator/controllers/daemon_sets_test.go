@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestGetBroadDaemonSetRestartWarning(t *testing.T) {
+	g := NewWithT(t)
+
+	daemonSetWithStrategy := func(strategy v1.DaemonSetUpdateStrategy, desiredPods int32) Workload {
+		daemonSet := &v1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-agent", Namespace: "kube-system"},
+			Spec:       v1.DaemonSetSpec{UpdateStrategy: strategy},
+			Status:     v1.DaemonSetStatus{DesiredNumberScheduled: desiredPods},
+		}
+		return NewDaemonSetWorkload(daemonSet)
+	}
+
+	rollingUpdate := func(maxUnavailable intstr.IntOrString) v1.DaemonSetUpdateStrategy {
+		return v1.DaemonSetUpdateStrategy{
+			Type:          v1.RollingUpdateDaemonSetStrategyType,
+			RollingUpdate: &v1.RollingUpdateDaemonSet{MaxUnavailable: &maxUnavailable},
+		}
+	}
+
+	testCases := map[string]struct {
+		workload   Workload
+		shouldWarn bool
+	}{
+		"defaults to one pod at a time":    {daemonSetWithStrategy(v1.DaemonSetUpdateStrategy{}, 20), false},
+		"small share of the nodes":         {daemonSetWithStrategy(rollingUpdate(intstr.FromString("10%")), 20), false},
+		"every node at once":               {daemonSetWithStrategy(rollingUpdate(intstr.FromString("100%")), 20), true},
+		"large absolute value":             {daemonSetWithStrategy(rollingUpdate(intstr.FromInt(8)), 20), true},
+		"two of few nodes":                 {daemonSetWithStrategy(rollingUpdate(intstr.FromInt(2)), 3), true},
+		"pods are only replaced on delete": {daemonSetWithStrategy(v1.DaemonSetUpdateStrategy{Type: v1.OnDeleteDaemonSetStrategyType}, 20), false},
+		"not a daemon set":                 {NewDeploymentWorkload(&v1.Deployment{}), false},
+	}
+
+	for name, testCase := range testCases {
+		warning := GetBroadDaemonSetRestartWarning(testCase.workload)
+		if testCase.shouldWarn {
+			g.Expect(warning).To(ContainSubstring("DaemonSet/kube-system/node-agent"), name)
+		} else {
+			g.Expect(warning).To(BeEmpty(), name)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ExternalSecrets are read without depending on the External Secrets Operator, whose CRDs may not be installed
+var externalSecretListGVK = schema.GroupVersionKind{Group: "external-secrets.io", Version: "v1beta1", Kind: "ExternalSecretList"}
+
+// Returns the namespaces of ExternalSecrets which sync a secret named like the managed secret, so that workloads consuming it are reconciled as well.
+// This covers clusters migrating between the External Secrets Operator and Infisical, where both sync the same source. A followed namespace always
+// differs from the managed secret's, which is the InfisicalSecret's own unless cross namespace references are allowed, so nothing is followed without them
+func (r *InfisicalSecretReconciler) GetExternalSecretNamespaces(ctx context.Context, infisicalSecret v1alpha1.InfisicalSecret) ([]string, error) {
+	if !r.FollowExternalSecrets {
+		return nil, nil
+	}
+
+	externalSecrets, err := r.listExternalSecrets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.getFollowedExternalSecretNamespaces(infisicalSecret, externalSecrets), nil
+}
+
+// Lists the ExternalSecrets of the cluster. Returns none when following them is disabled, cannot match because cross namespace references
+// are not allowed, or their CRDs are not installed
+func (r *InfisicalSecretReconciler) listExternalSecrets(ctx context.Context) ([]unstructured.Unstructured, error) {
+	if !r.FollowExternalSecrets || !r.AllowCrossNamespaceReferences {
+		return nil, nil
+	}
+
+	listOfExternalSecrets := &unstructured.UnstructuredList{}
+	listOfExternalSecrets.SetGroupVersionKind(externalSecretListGVK)
+
+	err := r.Client.List(ctx, listOfExternalSecrets)
+	if meta.IsNoMatchError(err) {
+		fmt.Printf("ExternalSecrets are not served by the cluster. Install the External Secrets Operator CRDs or disable following ExternalSecrets\n")
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to list ExternalSecrets [err=%w]", err)
+	}
+
+	return listOfExternalSecrets.Items, nil
+}
+
+func (r *InfisicalSecretReconciler) getFollowedExternalSecretNamespaces(infisicalSecret v1alpha1.InfisicalSecret, externalSecrets []unstructured.Unstructured) []string {
+	managedSecretName := infisicalSecret.Spec.ManagedSecretReference.SecretName
+	var namespaces []string
+	for _, externalSecret := range externalSecrets {
+		targetName, _, _ := unstructured.NestedString(externalSecret.Object, "spec", "target", "name")
+		if targetName == "" {
+			// the External Secrets Operator names the target secret after the ExternalSecret by default
+			targetName = externalSecret.GetName()
+		}
+
+		if targetName != managedSecretName || externalSecret.GetNamespace() == infisicalSecret.Spec.ManagedSecretReference.SecretNamespace {
+			continue
+		}
+
+		namespaces = append(namespaces, externalSecret.GetNamespace())
+	}
+
+	return namespaces
+}
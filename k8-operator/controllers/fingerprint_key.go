@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Secret holding the key every hash of secret data recorded by the operator is computed with. It is generated when the operator first starts
+const FINGERPRINT_KEY_SECRET_NAME = "infisical-operator-fingerprint-key"
+const FINGERPRINT_KEY_SECRET_KEY = "key"
+const FINGERPRINT_KEY_SIZE = 32
+
+// Environment variable the deployment sets to the namespace of the operator pod through the downward API
+const POD_NAMESPACE_ENV = "POD_NAMESPACE"
+
+// Returns the namespace the operator keeps its own resources in, such as the fingerprint key. An explicitly configured namespace takes precedence
+// over the namespace of the operator pod, and the namespace of the kubectl install is used when neither is known, such as when running out of cluster
+func ResolveOperatorNamespace(configuredNamespace string) string {
+	if configuredNamespace != "" {
+		return configuredNamespace
+	}
+
+	if podNamespace := os.Getenv(POD_NAMESPACE_ENV); podNamespace != "" {
+		return podNamespace
+	}
+
+	return OPERATOR_SETTINGS_CONFIGMAP_NAMESPACE
+}
+
+// Loads the fingerprint key from its secret in the operator namespace, creating the secret with a random key when it does not exist yet.
+// Replicas starting at the same time may race to create it, in which case the key of the replica that won is used
+func LoadOrCreateFingerprintKey(ctx context.Context, kubeClient client.Client, namespace string) ([]byte, error) {
+	secretKey := types.NamespacedName{Namespace: namespace, Name: FINGERPRINT_KEY_SECRET_NAME}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		keySecret := &corev1.Secret{}
+		err := kubeClient.Get(ctx, secretKey, keySecret)
+		if err == nil {
+			key := keySecret.Data[FINGERPRINT_KEY_SECRET_KEY]
+			if len(key) < FINGERPRINT_KEY_SIZE {
+				return nil, fmt.Errorf("the fingerprint key in [secret=%v] must be at least %v bytes long. Delete the secret to generate a new key", secretKey, FINGERPRINT_KEY_SIZE)
+			}
+			return key, nil
+		}
+		if !errors.IsNotFound(err) {
+			return nil, fmt.Errorf("unable to fetch the fingerprint key [secret=%v] [err=%w]", secretKey, err)
+		}
+
+		key := make([]byte, FINGERPRINT_KEY_SIZE)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("unable to generate a fingerprint key [err=%w]", err)
+		}
+
+		keySecret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: secretKey.Namespace, Name: secretKey.Name},
+			Type:       corev1.SecretTypeOpaque,
+			Data:       map[string][]byte{FINGERPRINT_KEY_SECRET_KEY: key},
+		}
+		err = kubeClient.Create(ctx, keySecret)
+		if err == nil {
+			fmt.Printf("Generated a new fingerprint key [secret=%v]\n", secretKey)
+			return key, nil
+		}
+		if !errors.IsAlreadyExists(err) {
+			return nil, fmt.Errorf("unable to create the fingerprint key [secret=%v] [err=%w]", secretKey, err)
+		}
+	}
+
+	return nil, fmt.Errorf("unable to load the fingerprint key [secret=%v]", secretKey)
+}
+
+// Returns the HMAC every hash of secret data is computed with. Unlike a plain hash, it cannot be used to guess low entropy secret values,
+// or be recomputed by anyone editing a workload, without the fingerprint key
+func (r *InfisicalSecretReconciler) newSecretDataHash() hash.Hash {
+	return hmac.New(sha256.New, r.FingerprintKey)
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestFingerprintKeyIsGeneratedOnce(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	r := newTestReconciler()
+
+	key, err := LoadOrCreateFingerprintKey(ctx, r.Client, OPERATOR_SETTINGS_CONFIGMAP_NAMESPACE)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(key).To(HaveLen(FINGERPRINT_KEY_SIZE))
+
+	// restarts and other replicas of the operator load the same key, so recorded hashes stay valid
+	reloadedKey, err := LoadOrCreateFingerprintKey(ctx, r.Client, OPERATOR_SETTINGS_CONFIGMAP_NAMESPACE)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(reloadedKey).To(Equal(key))
+
+	shortKeySecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: FINGERPRINT_KEY_SECRET_NAME, Namespace: OPERATOR_SETTINGS_CONFIGMAP_NAMESPACE},
+		Data:       map[string][]byte{FINGERPRINT_KEY_SECRET_KEY: []byte("short")},
+	}
+	_, err = LoadOrCreateFingerprintKey(ctx, newTestReconciler(shortKeySecret).Client, OPERATOR_SETTINGS_CONFIGMAP_NAMESPACE)
+	g.Expect(err).To(MatchError(ContainSubstring("must be at least 32 bytes long")))
+}
+
+func TestFingerprintKeyIsLoadedFromTheOperatorNamespace(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	// installed with helm into a namespace of its own choosing
+	t.Setenv(POD_NAMESPACE_ENV, "platform-operators")
+	namespace := ResolveOperatorNamespace("")
+	g.Expect(namespace).To(Equal("platform-operators"))
+
+	existingKeySecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: FINGERPRINT_KEY_SECRET_NAME, Namespace: "platform-operators"},
+		Data:       map[string][]byte{FINGERPRINT_KEY_SECRET_KEY: []byte("key-of-the-platform-operators-ns")},
+	}
+	r := newTestReconciler(existingKeySecret)
+
+	key, err := LoadOrCreateFingerprintKey(ctx, r.Client, namespace)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(key).To(Equal([]byte("key-of-the-platform-operators-ns")))
+
+	// nothing is created in the namespace of the kubectl install
+	defaultNamespaceSecret := &corev1.Secret{}
+	err = r.Client.Get(ctx, types.NamespacedName{Namespace: OPERATOR_SETTINGS_CONFIGMAP_NAMESPACE, Name: FINGERPRINT_KEY_SECRET_NAME}, defaultNamespaceSecret)
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+
+	// the flag overrides the namespace of the pod
+	g.Expect(ResolveOperatorNamespace("secrets-keys")).To(Equal("secrets-keys"))
+
+	t.Setenv(POD_NAMESPACE_ENV, "")
+	g.Expect(ResolveOperatorNamespace("")).To(Equal(OPERATOR_SETTINGS_CONFIGMAP_NAMESPACE))
+}
@@ -2,23 +2,100 @@ package controllers
 
 import (
 	"context"
+	goerrors "errors"
 	"fmt"
 	"time"
 
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
 	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
-	"github.com/Infisical/infisical/k8-operator/packages/api"
+	"github.com/Infisical/infisical/k8-operator/packages/audit"
 )
 
+// how soon to continue reconciling workloads after a reconcile ran into its timeout. The delay doubles with every consecutive timeout up to the maximum
+const REDEPLOYMENT_TIMEOUT_REQUEUE_TIME = time.Second
+const REDEPLOYMENT_TIMEOUT_MAX_REQUEUE_TIME = 5 * time.Minute
+
 // InfisicalSecretReconciler reconciles a InfisicalSecret object
 type InfisicalSecretReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// When enabled, restarts triggered by secret rotation are deferred while the cluster is draining nodes
+	DeferRestartsDuringDrain bool
+	// Number of unschedulable nodes at which the cluster is considered to be under maintenance. 0 disables the check
+	DrainUnschedulableNodeThreshold int
+	// Percentage of unschedulable nodes at which the cluster is considered to be under maintenance. 0 disables the check
+	DrainUnschedulableNodePercentage int
+
+	// Detectors used to find workloads consuming the managed secret. Only the builtin detector is used when nil
+	ReferenceDetectors *ReferenceDetectorRegistry
+
+	// When enabled, InfisicalSecrets may restart workloads outside of their own namespace. Their secrets are synced either way
+	AllowCrossNamespaceReferences bool
+
+	// When enabled, the permission to update each kind of workload is checked once per namespace before restarting workloads in it.
+	// Namespaces where updates are forbidden are skipped with a single warning event instead of failing every workload
+	PreflightWorkloadPermissions bool
+
+	// When enabled, pods consuming the managed secret that are not part of a Deployment, StatefulSet or DaemonSet are deleted to reload them
+	EnablePodDeletion bool
+
+	// When enabled, workloads which were never reconciled before adopt the current secret version instead of being restarted.
+	// This prevents restarting every consuming workload when the operator is first installed into an existing cluster
+	AdoptWorkloadsOnFirstObservation bool
+
+	// When enabled, the versions of all managed secrets a workload consumes are recorded in a single JSON annotation on the workload
+	// instead of one version annotation per managed secret. Versions recorded the other way are migrated as workloads are reconciled.
+	// Only the versions are consolidated. The other annotations per managed secret and the pod template annotations are left as they are
+	ConsolidateWorkloadAnnotations bool
+
+	// When enabled, an empty managed secret namespace defaults to the namespace of the InfisicalSecret. Such InfisicalSecrets are refused otherwise
+	DefaultEmptySecretNamespace bool
+
+	// When enabled, workloads consuming a secret that an ExternalSecret syncs under the name of the managed secret are reconciled as well
+	FollowExternalSecrets bool
+
+	// Number of InfisicalSecrets reconciled in parallel. Values below 1 reconcile one at a time
+	MaxConcurrentReconciles int
+
+	// Limits the parallel reconciles of InfisicalSecrets in the same namespace, so a slow namespace leaves workers for the others. nil disables the limit
+	NamespaceConcurrency *NamespaceConcurrencyLimiter
+
+	// Upper bound for reconciling the workloads of a single InfisicalSecret, unless overridden in its spec. 0 disables the timeout
+	DefaultReconcileTimeout time.Duration
+
+	// Optional sink which receives an audit record for every restart decision. nil turns auditing off
+	AuditSink audit.Sink
+
+	// When enabled, InfisicalSecrets may run pre and post restart Jobs. The Jobs run with any service account of the namespace their template names,
+	// so anyone allowed to create InfisicalSecrets in a namespace can run pods with the permissions of its service accounts
+	EnableRestartJobs bool
+
+	// Key of the HMAC used for every hash of secret data the operator records, such as the key hashes in the status and the seals on workloads.
+	// Kept in a secret in the operator namespace, so the hashes can neither be used to guess secret values nor be forged by anyone editing a workload
+	FingerprintKey []byte
+
+	// Namespaces whose auto reload annotations were checked recently
+	reloadAnnotationChecks intervalThrottle
+
+	// Managed secrets on which a rotation summary event was recorded recently, so frequent rotations do not flood their events
+	managedSecretEvents intervalThrottle
+
+	// InfisicalSecrets whose last reconciles ran into their timeout
+	redeploymentTimeouts exponentialBackoff
 }
 
 //+kubebuilder:rbac:groups=secrets.infisical.com,resources=infisicalsecrets,verbs=get;list;watch;create;update;patch;delete
@@ -27,6 +104,15 @@ type InfisicalSecretReconciler struct {
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;delete
 //+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;delete
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=list;watch;get;update
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=list;watch;get;update
+//+kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=list;watch;get;update
+//+kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=list;watch
+//+kubebuilder:rbac:groups="",resources=pods,verbs=list;watch;delete
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create
+//+kubebuilder:rbac:groups=external-secrets.io,resources=externalsecrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=selfsubjectaccessreviews,verbs=create
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -36,6 +122,16 @@ func (r *InfisicalSecretReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 	var infisicalSecretCR v1alpha1.InfisicalSecret
 	requeueTime := time.Minute // seconds
 
+	if r.NamespaceConcurrency != nil {
+		if !r.NamespaceConcurrency.TryAcquire(req.NamespacedName) {
+			fmt.Printf("all reconcile slots of [namespace=%v] are in use. Will requeue [name=%v] after [requeueTime=%v]\n", req.Namespace, req.Name, NAMESPACE_CONCURRENCY_REQUEUE_TIME)
+			return ctrl.Result{
+				RequeueAfter: NAMESPACE_CONCURRENCY_REQUEUE_TIME,
+			}, nil
+		}
+		defer r.NamespaceConcurrency.Release(req.NamespacedName)
+	}
+
 	err := r.Get(ctx, req.NamespacedName, &infisicalSecretCR)
 	if err != nil {
 		if errors.IsNotFound(err) {
@@ -65,6 +161,22 @@ func (r *InfisicalSecretReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		}, nil
 	}
 
+	infisicalSecretCR, err = ResolveEmptySecretNamespace(infisicalSecretCR, r.DefaultEmptySecretNamespace)
+	if err != nil {
+		r.SetInvalidReferenceCondition(ctx, &infisicalSecretCR, fmt.Errorf("secrets are not synced and workloads are not redeployed because %w", err))
+		fmt.Printf("refusing to reconcile Infisical Secret because [err=%v]. Will requeue after [requeueTime=%v]\n", err, requeueTime)
+		return ctrl.Result{
+			RequeueAfter: requeueTime,
+		}, nil
+	}
+
+	// references outside of the namespace of the InfisicalSecret only hold back the redeployment of workloads, its secrets are still synced
+	referenceScopeErr := ValidateReferenceScope(infisicalSecretCR, r.AllowCrossNamespaceReferences)
+	if referenceScopeErr != nil {
+		referenceScopeErr = fmt.Errorf("workloads are not redeployed because %w", referenceScopeErr)
+	}
+	r.SetInvalidReferenceCondition(ctx, &infisicalSecretCR, referenceScopeErr)
+
 	// Get modified/default config
 	infisicalConfig, err := r.GetInfisicalConfigMap(ctx)
 	if err != nil {
@@ -74,13 +186,12 @@ func (r *InfisicalSecretReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		}, nil
 	}
 
-	if infisicalSecretCR.Spec.HostAPI == "" {
-		api.API_HOST_URL = infisicalConfig["hostAPI"]
-	} else {
-		api.API_HOST_URL = infisicalSecretCR.Spec.HostAPI
+	hostAPI := infisicalConfig["hostAPI"]
+	if infisicalSecretCR.Spec.HostAPI != "" {
+		hostAPI = infisicalSecretCR.Spec.HostAPI
 	}
 
-	err = r.ReconcileInfisicalSecret(ctx, infisicalSecretCR)
+	err = r.ReconcileInfisicalSecret(ctx, infisicalSecretCR, hostAPI)
 	r.SetReadyToSyncSecretsConditions(ctx, &infisicalSecretCR, err)
 
 	if err != nil {
@@ -90,8 +201,40 @@ func (r *InfisicalSecretReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		}, nil
 	}
 
-	numDeployments, err := r.ReconcileDeploymentsWithManagedSecrets(ctx, infisicalSecretCR)
-	r.SetInfisicalAutoRedeploymentReady(ctx, &infisicalSecretCR, numDeployments, err)
+	if referenceScopeErr != nil {
+		if err := r.SetInfisicalAutoRedeploymentReady(ctx, &infisicalSecretCR, ReconcileOutcome{}, referenceScopeErr); err != nil {
+			fmt.Println(err)
+		}
+		fmt.Printf("skipping auto redeployment because [err=%v]. Will requeue after [requeueTime=%v]\n", referenceScopeErr, requeueTime)
+		return ctrl.Result{
+			RequeueAfter: requeueTime,
+		}, nil
+	}
+
+	// Namespace defaults only fill in the spec used for reconciling workloads, they are never written back to the InfisicalSecret
+	infisicalSecretWithDefaults, err := r.applyNamespaceDefaultsOrReport(ctx, &infisicalSecretCR)
+	if err != nil {
+		fmt.Printf("unable to apply namespace defaults [err=%v]. Will requeue after [requeueTime=%v]\n", err, requeueTime)
+		return ctrl.Result{
+			RequeueAfter: requeueTime,
+		}, nil
+	}
+
+	reconcileOutcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecretWithDefaults)
+	if statusErr := r.SetInfisicalAutoRedeploymentReady(ctx, &infisicalSecretCR, reconcileOutcome, err); statusErr != nil {
+		// the status tracks the workloads that were restarted, so it is written again right away instead of after the resync interval
+		fmt.Printf("unable to record the auto redeployment in the status [err=%v]. Requeueing\n", statusErr)
+		return ctrl.Result{}, statusErr
+	}
+	if goerrors.Is(err, context.DeadlineExceeded) {
+		timeoutRequeueTime := r.redeploymentTimeouts.next(req.NamespacedName.String(), REDEPLOYMENT_TIMEOUT_REQUEUE_TIME, REDEPLOYMENT_TIMEOUT_MAX_REQUEUE_TIME)
+		fmt.Printf("auto redeployment timed out [err=%v]. Continuing with the remaining workloads after [requeueTime=%v]\n", err, timeoutRequeueTime)
+		return ctrl.Result{
+			RequeueAfter: timeoutRequeueTime,
+		}, nil
+	}
+	r.redeploymentTimeouts.reset(req.NamespacedName.String())
+
 	if err != nil {
 		fmt.Printf("unable to reconcile auto redeployment because [err=%v]", err)
 		return ctrl.Result{
@@ -99,6 +242,35 @@ func (r *InfisicalSecretReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		}, nil
 	}
 
+	pendingRollouts, err := r.GetPendingWorkloadRollouts(ctx, infisicalSecretWithDefaults)
+	r.SetWorkloadRolloutsCompleteCondition(ctx, &infisicalSecretCR, pendingRollouts, err)
+	if err != nil {
+		fmt.Printf("unable to check rollout of redeployed workloads because [err=%v]\n", err)
+	}
+
+	// an invalid schedule has already been reported on the AutoRedeployReady condition
+	if restartSchedule, err := GetRestartSchedule(infisicalSecretWithDefaults); err == nil && restartSchedule != nil {
+		nextRestart := restartSchedule.Next(time.Now())
+
+		pendingRestarts, err := r.GetPendingScheduledRestarts(ctx, infisicalSecretWithDefaults)
+		r.SetScheduledRestartsCondition(ctx, &infisicalSecretCR, pendingRestarts, nextRestart, err)
+
+		// wake up in time for the next scheduled restart instead of waiting for the resync interval
+		if untilNextRestart := time.Until(nextRestart); !nextRestart.IsZero() && untilNextRestart < requeueTime {
+			requeueTime = untilNextRestart
+		}
+	}
+
+	// restart the workloads held back by a blackout window as soon as it closes
+	if untilPermitted := time.Until(reconcileOutcome.RestartsPermittedAt); !reconcileOutcome.RestartsPermittedAt.IsZero() && untilPermitted < requeueTime {
+		requeueTime = untilPermitted
+	}
+
+	// restart the workloads waiting for their own restart window as soon as the first window opens
+	if untilWindow := time.Until(reconcileOutcome.NextRestartWindow); !reconcileOutcome.NextRestartWindow.IsZero() && untilWindow < requeueTime {
+		requeueTime = untilWindow
+	}
+
 	// Sync again after the specified time
 	fmt.Printf("Operator will requeue after [%v] \n", requeueTime)
 	return ctrl.Result{
@@ -108,7 +280,18 @@ func (r *InfisicalSecretReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *InfisicalSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	controllerBuilder := ctrl.NewControllerManagedBy(mgr).
 		For(&secretsv1alpha1.InfisicalSecret{}).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(mapManagedSecretToInfisicalSecret), builder.WithPredicates(managedSecretPredicate)).
+		// reload plans carry the same labels, so approving one is acted on right away
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(mapManagedSecretToInfisicalSecret), builder.WithPredicates(managedSecretPredicate))
+
+	if r.EnableRestartJobs {
+		// so that restarts continue as soon as a pre or post restart Job finished
+		controllerBuilder = controllerBuilder.Owns(&batchv1.Job{})
+	}
+
+	return controllerBuilder.
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
 	"github.com/Infisical/infisical/k8-operator/packages/model"
@@ -13,6 +14,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const SERVICE_ACCOUNT_ACCESS_KEY = "serviceAccountAccessKey"
@@ -40,7 +42,40 @@ var AuthStrategy = struct {
 	UNIVERSAL_MACHINE_IDENTITY: "UNIVERSAL_MACHINE_IDENTITY",
 }
 
-var machineIdentityTokenInstance *util.MachineIdentityToken
+// machine identity tokens by host API and client credentials. InfisicalSecrets are reconciled in parallel and may
+// authenticate against different hosts, so each combination keeps its own token and refresh lifecycle
+type machineIdentityTokenCache struct {
+	mutex  sync.Mutex
+	tokens map[string]*util.MachineIdentityToken
+}
+
+var machineIdentityTokens = machineIdentityTokenCache{tokens: map[string]*util.MachineIdentityToken{}}
+
+func (c *machineIdentityTokenCache) get(hostAPI string, clientId string, clientSecret string) *util.MachineIdentityToken {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := hostAPI + "\x00" + clientId + "\x00" + clientSecret
+	token, ok := c.tokens[key]
+	if !ok {
+		token = util.NewMachineIdentityToken(hostAPI, clientId, clientSecret)
+		c.tokens[key] = token
+	}
+
+	return token
+}
+
+// label and annotation prefixes owned by Kubernetes and common tooling which should never be copied between objects
+var systemMetadataPrefixes = []string{"kubectl.kubernetes.io/", "kubernetes.io/", "k8s.io/", "helm.sh/"}
+
+func isSystemMetadataKey(key string) bool {
+	for _, prefix := range systemMetadataPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
 
 func (r *InfisicalSecretReconciler) GetInfisicalConfigMap(ctx context.Context) (configMap map[string]string, errToReturn error) {
 	// default key values
@@ -179,17 +214,13 @@ func (r *InfisicalSecretReconciler) CreateInfisicalManagedKubeSecret(ctx context
 		labels[k] = v
 	}
 
+	for k, v := range GetManagedByLabels(infisicalSecret) {
+		labels[k] = v
+	}
+
 	annotations := map[string]string{}
-	systemPrefixes := []string{"kubectl.kubernetes.io/", "kubernetes.io/", "k8s.io/", "helm.sh/"}
 	for k, v := range infisicalSecret.Annotations {
-		isSystem := false
-		for _, prefix := range systemPrefixes {
-			if strings.HasPrefix(k, prefix) {
-				isSystem = true
-				break
-			}
-		}
-		if !isSystem {
+		if !isSystemMetadataKey(k) {
 			annotations[k] = v
 		}
 	}
@@ -225,12 +256,16 @@ func (r *InfisicalSecretReconciler) CreateInfisicalManagedKubeSecret(ctx context
 	return nil
 }
 
-func (r *InfisicalSecretReconciler) UpdateInfisicalManagedKubeSecret(ctx context.Context, managedKubeSecret corev1.Secret, secretsFromAPI []model.SingleEnvironmentVariable, ETag string) error {
+func (r *InfisicalSecretReconciler) UpdateInfisicalManagedKubeSecret(ctx context.Context, infisicalSecret v1alpha1.InfisicalSecret, managedKubeSecret corev1.Secret, secretsFromAPI []model.SingleEnvironmentVariable, ETag string) error {
 	plainProcessedSecrets := make(map[string][]byte)
 	for _, secret := range secretsFromAPI {
 		plainProcessedSecrets[secret.Key] = []byte(secret.Value)
 	}
 
+	if managedKubeSecret.Immutable != nil && *managedKubeSecret.Immutable {
+		return r.RecreateImmutableManagedKubeSecret(ctx, infisicalSecret, managedKubeSecret, plainProcessedSecrets, ETag)
+	}
+
 	managedKubeSecret.Data = plainProcessedSecrets
 	managedKubeSecret.ObjectMeta.Annotations = map[string]string{}
 	managedKubeSecret.ObjectMeta.Annotations[SECRET_VERSION_ANNOTATION] = ETag
@@ -244,7 +279,54 @@ func (r *InfisicalSecretReconciler) UpdateInfisicalManagedKubeSecret(ctx context
 	return nil
 }
 
-func (r *InfisicalSecretReconciler) ReconcileInfisicalSecret(ctx context.Context, infisicalSecret v1alpha1.InfisicalSecret) error {
+// A copy of the managed secret with the given annotations and data which can be created in its place
+func newRecreatedKubeSecret(managedKubeSecret corev1.Secret, annotations map[string]string, data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            managedKubeSecret.Name,
+			Namespace:       managedKubeSecret.Namespace,
+			Labels:          managedKubeSecret.Labels,
+			Annotations:     annotations,
+			OwnerReferences: managedKubeSecret.OwnerReferences,
+		},
+		Type:      managedKubeSecret.Type,
+		Immutable: managedKubeSecret.Immutable,
+		Data:      data,
+	}
+}
+
+// The data of an immutable secret cannot be updated, so the secret is deleted and created again with the new data.
+// The recreated secret gets a new UID, which makes the workloads consuming it restart on the next auto redeployment.
+// When the new secret cannot be created, the previous data is restored so that consumers are not left without the secret until the next reconcile
+func (r *InfisicalSecretReconciler) RecreateImmutableManagedKubeSecret(ctx context.Context, infisicalSecret v1alpha1.InfisicalSecret, managedKubeSecret corev1.Secret, plainProcessedSecrets map[string][]byte, ETag string) error {
+	recreatedKubeSecret := newRecreatedKubeSecret(managedKubeSecret, map[string]string{SECRET_VERSION_ANNOTATION: ETag}, plainProcessedSecrets)
+
+	// only delete the exact secret that was read, so that a secret recreated by someone else in the meantime is left alone
+	err := r.Client.Delete(ctx, &managedKubeSecret, client.Preconditions{UID: &managedKubeSecret.UID})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete immutable Kubernetes secret for recreation because [%w]", err)
+	}
+
+	err = r.Client.Create(ctx, recreatedKubeSecret)
+	if err != nil && errors.IsAlreadyExists(err) {
+		return fmt.Errorf("unable to recreate immutable Kubernetes secret because it was created by someone else in the meantime [%w]", err)
+	}
+
+	if err != nil {
+		restoreErr := r.Client.Create(ctx, newRecreatedKubeSecret(managedKubeSecret, managedKubeSecret.Annotations, managedKubeSecret.Data))
+		if restoreErr != nil {
+			r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeWarning, "ManagedSecretRecreationFailed", "Immutable managed secret %v was deleted but could not be created again, and restoring its previous data failed as well: %v. It is created on the next reconcile", managedKubeSecret.Name, restoreErr)
+		} else {
+			r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeWarning, "ManagedSecretRecreationFailed", "Immutable managed secret %v could not be recreated with version %v: %v. Its previous data was restored", managedKubeSecret.Name, ETag, err)
+		}
+		return fmt.Errorf("unable to recreate immutable Kubernetes secret because [%w]", err)
+	}
+
+	r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeNormal, "ManagedSecretRecreated", "Recreated immutable managed secret %v with version %v", managedKubeSecret.Name, ETag)
+	return nil
+}
+
+func (r *InfisicalSecretReconciler) ReconcileInfisicalSecret(ctx context.Context, infisicalSecret v1alpha1.InfisicalSecret, hostAPI string) error {
 	infisicalToken, err := r.GetInfisicalTokenFromKubeSecret(ctx, infisicalSecret)
 	if err != nil {
 		return fmt.Errorf("ReconcileInfisicalSecret: unable to get service token from kube secret [err=%s]", err)
@@ -291,18 +373,21 @@ func (r *InfisicalSecretReconciler) ReconcileInfisicalSecret(ctx context.Context
 	secretVersionBasedOnETag := ""
 	if managedKubeSecret != nil {
 		secretVersionBasedOnETag = managedKubeSecret.Annotations[SECRET_VERSION_ANNOTATION]
+
+		if err := r.EnsureManagedByLabels(ctx, infisicalSecret, managedKubeSecret); err != nil {
+			fmt.Println(err)
+		}
 	}
 
-	if authStrategy == AuthStrategy.UNIVERSAL_MACHINE_IDENTITY && machineIdentityTokenInstance == nil {
-		// Create new machine identity token instance
-		machineIdentityTokenInstance = util.NewMachineIdentityToken(infisicalMachineIdentityCreds.ClientId, infisicalMachineIdentityCreds.ClientSecret)
+	if err := r.RemoveStaleManagedByLabels(ctx, infisicalSecret); err != nil {
+		fmt.Println(err)
 	}
 
 	var plainTextSecretsFromApi []model.SingleEnvironmentVariable
 	var updateDetails model.RequestUpdateUpdateDetails
 
 	if authStrategy == AuthStrategy.SERVICE_ACCOUNT { // Service Account
-		plainTextSecretsFromApi, updateDetails, err = util.GetPlainTextSecretsViaServiceAccount(serviceAccountCreds, infisicalSecret.Spec.Authentication.ServiceAccount.ProjectId, infisicalSecret.Spec.Authentication.ServiceAccount.EnvironmentName, secretVersionBasedOnETag)
+		plainTextSecretsFromApi, updateDetails, err = util.GetPlainTextSecretsViaServiceAccount(hostAPI, serviceAccountCreds, infisicalSecret.Spec.Authentication.ServiceAccount.ProjectId, infisicalSecret.Spec.Authentication.ServiceAccount.EnvironmentName, secretVersionBasedOnETag)
 		if err != nil {
 			return fmt.Errorf("\nfailed to get secrets because [err=%v]", err)
 		}
@@ -313,7 +398,7 @@ func (r *InfisicalSecretReconciler) ReconcileInfisicalSecret(ctx context.Context
 		envSlug := infisicalSecret.Spec.Authentication.ServiceToken.SecretsScope.EnvSlug
 		secretsPath := infisicalSecret.Spec.Authentication.ServiceToken.SecretsScope.SecretsPath
 
-		plainTextSecretsFromApi, updateDetails, err = util.GetPlainTextSecretsViaServiceToken(infisicalToken, secretVersionBasedOnETag, envSlug, secretsPath)
+		plainTextSecretsFromApi, updateDetails, err = util.GetPlainTextSecretsViaServiceToken(hostAPI, infisicalToken, secretVersionBasedOnETag, envSlug, secretsPath)
 		if err != nil {
 			return fmt.Errorf("\nfailed to get secrets because [err=%v]", err)
 		}
@@ -321,13 +406,14 @@ func (r *InfisicalSecretReconciler) ReconcileInfisicalSecret(ctx context.Context
 		fmt.Println("ReconcileInfisicalSecret: Fetched secrets via service token")
 	} else if authStrategy == AuthStrategy.UNIVERSAL_MACHINE_IDENTITY { // Machine Identity
 
-		accessToken, err := machineIdentityTokenInstance.GetToken()
+		machineIdentityToken := machineIdentityTokens.get(hostAPI, infisicalMachineIdentityCreds.ClientId, infisicalMachineIdentityCreds.ClientSecret)
+		accessToken, err := machineIdentityToken.GetToken()
 
 		if err != nil {
 			return fmt.Errorf("%s", "Waiting for access token to become available")
 		}
 		scope := infisicalSecret.Spec.Authentication.UniversalAuth.SecretsScope
-		plainTextSecretsFromApi, updateDetails, err = util.GetPlainTextSecretsViaUniversalAuth(accessToken, secretVersionBasedOnETag, scope)
+		plainTextSecretsFromApi, updateDetails, err = util.GetPlainTextSecretsViaUniversalAuth(hostAPI, accessToken, secretVersionBasedOnETag, scope)
 
 		if err != nil {
 			return fmt.Errorf("\nfailed to get secrets because [err=%v]", err)
@@ -346,7 +432,7 @@ func (r *InfisicalSecretReconciler) ReconcileInfisicalSecret(ctx context.Context
 	if managedKubeSecret == nil {
 		return r.CreateInfisicalManagedKubeSecret(ctx, infisicalSecret, plainTextSecretsFromApi, updateDetails.ETag)
 	} else {
-		return r.UpdateInfisicalManagedKubeSecret(ctx, *managedKubeSecret, plainTextSecretsFromApi, updateDetails.ETag)
+		return r.UpdateInfisicalManagedKubeSecret(ctx, infisicalSecret, *managedKubeSecret, plainTextSecretsFromApi, updateDetails.ETag)
 	}
 
 }
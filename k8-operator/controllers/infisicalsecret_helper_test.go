@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	"github.com/Infisical/infisical/k8-operator/packages/model"
+)
+
+// The fake client does not assign UIDs, so created objects get one the way the API server would
+type uidAssigningClient struct {
+	client.Client
+	created int
+}
+
+func (c *uidAssigningClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if obj.GetUID() == "" {
+		c.created++
+		obj.SetUID(types.UID(fmt.Sprintf("created-uid-%d", c.created)))
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestImmutableManagedSecretRotationRestartsConsumers(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+	identityKey := DEPLOYMENT_SECRET_IDENTITY_ANNOTATION_PREFIX + ".managed-secret"
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			UID:         "uid-1",
+			Labels:      map[string]string{"team": "payments"},
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v1"},
+		},
+		Type:      corev1.SecretTypeOpaque,
+		Immutable: pointer.Bool(true),
+		Data:      map[string][]byte{"DB_PASSWORD": []byte("old-password")},
+	}
+
+	deployment := &v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "api",
+			Namespace: "default",
+			Annotations: map[string]string{
+				AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true",
+				versionKey:                        "v1",
+				identityKey:                       "Opaque/uid-1",
+			},
+		},
+	}
+	deployment.Spec.Template.Annotations = map[string]string{versionKey: "v1", identityKey: "Opaque/uid-1"}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "api",
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+		}},
+	}}
+
+	r := newTestReconciler(managedSecret, deployment)
+	r.Client = &uidAssigningClient{Client: r.Client}
+
+	err := r.UpdateInfisicalManagedKubeSecret(ctx, secretsv1alpha1.InfisicalSecret{}, *managedSecret, []model.SingleEnvironmentVariable{{Key: "DB_PASSWORD", Value: "new-password"}}, "v2")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	recreatedSecret := &corev1.Secret{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(managedSecret), recreatedSecret)).To(Succeed())
+	g.Expect(recreatedSecret.UID).NotTo(Equal(managedSecret.UID))
+	g.Expect(recreatedSecret.Immutable).To(Equal(pointer.Bool(true)))
+	g.Expect(recreatedSecret.Labels).To(Equal(managedSecret.Labels))
+	g.Expect(recreatedSecret.Annotations[SECRET_VERSION_ANNOTATION]).To(Equal("v2"))
+	g.Expect(recreatedSecret.Data).To(Equal(map[string][]byte{"DB_PASSWORD": []byte("new-password")}))
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total.Restarted).To(Equal(1))
+
+	restartedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(deployment), restartedDeployment)).To(Succeed())
+	g.Expect(restartedDeployment.Spec.Template.Annotations[DEPLOYMENT_RELOAD_REASON_ANNOTATION]).To(Equal(RELOAD_REASON_UID_CHANGED))
+	g.Expect(restartedDeployment.Spec.Template.Annotations[versionKey]).To(Equal("v2"))
+	g.Expect(restartedDeployment.Spec.Template.Annotations[identityKey]).To(Equal("Opaque/" + string(recreatedSecret.UID)))
+}
+
+// Fails the first creations of secrets, like when a quota or an admission webhook rejects them
+type failingSecretCreateClient struct {
+	client.Client
+	failures int
+}
+
+func (c *failingSecretCreateClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if _, isSecret := obj.(*corev1.Secret); isSecret && c.failures > 0 {
+		c.failures--
+		return fmt.Errorf("exceeded quota: secrets")
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestImmutableManagedSecretIsRestoredWhenRecreationFails(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			UID:         "uid-1",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v1"},
+		},
+		Immutable: pointer.Bool(true),
+		Data:      map[string][]byte{"DB_PASSWORD": []byte("old-password")},
+	}
+
+	r := newTestReconciler(managedSecret)
+	r.Client = &failingSecretCreateClient{Client: r.Client, failures: 1}
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{ObjectMeta: metav1.ObjectMeta{Name: "app-secrets", Namespace: "default"}}
+	err := r.UpdateInfisicalManagedKubeSecret(ctx, infisicalSecret, *managedSecret, []model.SingleEnvironmentVariable{{Key: "DB_PASSWORD", Value: "new-password"}}, "v2")
+	g.Expect(err).To(MatchError(ContainSubstring("exceeded quota")))
+
+	restoredSecret := &corev1.Secret{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(managedSecret), restoredSecret)).To(Succeed())
+	g.Expect(restoredSecret.Annotations[SECRET_VERSION_ANNOTATION]).To(Equal("v1"))
+	g.Expect(restoredSecret.Data).To(Equal(map[string][]byte{"DB_PASSWORD": []byte("old-password")}))
+
+	events := r.Recorder.(*record.FakeRecorder).Events
+	g.Expect(<-events).To(And(HavePrefix(corev1.EventTypeWarning), ContainSubstring("ManagedSecretRecreationFailed"), ContainSubstring("previous data was restored")))
+}
+
+// Serves the universal auth login and the raw secrets of one Infisical host
+func newInfisicalHostServer(hostName string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/auth/universal-auth/login", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"accessToken":       "token-of-" + hostName,
+			"expiresIn":         3600,
+			"accessTokenMaxTTL": 3600,
+			"tokenType":         "Bearer",
+		})
+	})
+	mux.HandleFunc("/v3/secrets/raw", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("etag", "etag-of-"+hostName)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"secrets": []map[string]string{{"secretKey": "HOST", "secretValue": hostName}},
+		})
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestParallelReconcilesUseTheHostAPIOfTheirInfisicalSecret(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	hosts := map[string]*httptest.Server{}
+	objects := []client.Object{}
+	for _, hostName := range []string{"eu", "us"} {
+		server := newInfisicalHostServer(hostName)
+		t.Cleanup(server.Close)
+		hosts[hostName] = server
+
+		objects = append(objects,
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "creds-" + hostName, Namespace: "default"},
+				Data: map[string][]byte{
+					INFISICAL_MACHINE_IDENTITY_CLIENT_ID:     []byte("client-id"),
+					INFISICAL_MACHINE_IDENTITY_CLIENT_SECRET: []byte("client-secret"),
+				},
+			},
+			&secretsv1alpha1.InfisicalSecret{
+				ObjectMeta: metav1.ObjectMeta{Name: "infisical-" + hostName, Namespace: "default"},
+				Spec: secretsv1alpha1.InfisicalSecretSpec{
+					HostAPI: server.URL,
+					Authentication: secretsv1alpha1.Authentication{
+						UniversalAuth: secretsv1alpha1.UniversalAuthDetails{
+							CredentialsRef: secretsv1alpha1.KubeSecretReference{SecretName: "creds-" + hostName, SecretNamespace: "default"},
+							SecretsScope:   secretsv1alpha1.MachineIdentityScopeInWorkspace{ProjectSlug: "project", EnvSlug: "prod", SecretsPath: "/"},
+						},
+					},
+					ManagedSecretReference: secretsv1alpha1.MangedKubeSecretConfig{SecretName: "managed-" + hostName, SecretNamespace: "default"},
+				},
+			},
+		)
+	}
+	r := newTestReconciler(objects...)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(hosts))
+	for hostName, server := range hosts {
+		infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+		g.Expect(r.Get(ctx, types.NamespacedName{Name: "infisical-" + hostName, Namespace: "default"}, &infisicalSecret)).To(Succeed())
+
+		wg.Add(1)
+		go func(infisicalSecret secretsv1alpha1.InfisicalSecret, hostAPI string) {
+			defer wg.Done()
+
+			// the access token is fetched in the background, so the first passes wait for it
+			deadline := time.Now().Add(10 * time.Second)
+			err := r.ReconcileInfisicalSecret(ctx, infisicalSecret, hostAPI)
+			for err != nil && time.Now().Before(deadline) {
+				time.Sleep(50 * time.Millisecond)
+				err = r.ReconcileInfisicalSecret(ctx, infisicalSecret, hostAPI)
+			}
+			errs <- err
+		}(infisicalSecret, server.URL)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		g.Expect(err).NotTo(HaveOccurred())
+	}
+
+	for hostName := range hosts {
+		managedSecret := corev1.Secret{}
+		g.Expect(r.Get(ctx, types.NamespacedName{Name: "managed-" + hostName, Namespace: "default"}, &managedSecret)).To(Succeed())
+		g.Expect(string(managedSecret.Data["HOST"])).To(Equal(hostName))
+	}
+}
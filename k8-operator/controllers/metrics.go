@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const RELOAD_REASON_DATA_CHANGED = "data-changed"
+const RELOAD_REASON_TYPE_CHANGED = "type-changed"
+const RELOAD_REASON_FORCED = "forced"
+const RELOAD_REASON_SECRET_CREATED = "secret-created"
+const RELOAD_REASON_UID_CHANGED = "uid-changed"
+const RELOAD_REASON_OPTIONAL_KEY_CHANGED = "optional-key-changed"
+const RELOAD_REASON_OPTIONAL_SECRET_CREATED = "optional-secret-created"
+const RELOAD_REASON_RECORDED_VERSION_MISMATCH = "recorded-version-mismatch"
+
+var workloadReloadsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "infisical_workload_reloads_total",
+		Help: "Number of workloads restarted by the operator, partitioned by workload kind and what triggered the restart",
+	},
+	[]string{"kind", "reason"},
+)
+
+var namespaceQueueDepth = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "infisical_namespace_queue_depth",
+		Help: "Number of InfisicalSecrets being reconciled or waiting for a reconcile slot, partitioned by namespace. Only recorded when reconciles are limited per namespace",
+	},
+	[]string{"namespace"},
+)
+
+var misconfiguredReloadAnnotations = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "infisical_misconfigured_reload_annotations",
+		Help: "Number of workloads with auto reload enabled that consume the secret of no InfisicalSecret, partitioned by namespace",
+	},
+	[]string{"namespace"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(workloadReloadsTotal)
+	metrics.Registry.MustRegister(namespaceQueueDepth)
+	metrics.Registry.MustRegister(misconfiguredReloadAnnotations)
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// how soon an InfisicalSecret is retried when its namespace already uses all of its reconcile slots
+const NAMESPACE_CONCURRENCY_REQUEUE_TIME = time.Second
+
+// how long an InfisicalSecret counts as waiting after its last attempt to acquire a slot. Waiting InfisicalSecrets retry every
+// NAMESPACE_CONCURRENCY_REQUEUE_TIME, so the ones that stopped retrying, such as deleted ones, are dropped after missing several retries
+const NAMESPACE_CONCURRENCY_WAITING_EXPIRY = 30 * NAMESPACE_CONCURRENCY_REQUEUE_TIME
+
+// Limits how many InfisicalSecrets of the same namespace are reconciled at once. Reconciles over the limit are requeued
+// instead of waiting for a slot, so a namespace with slow reconciles cannot occupy every worker of the shared work queue
+type NamespaceConcurrencyLimiter struct {
+	maxPerNamespace int
+
+	mutex sync.Mutex
+	// number of reconciles currently running, per namespace
+	active map[string]int
+	// InfisicalSecrets requeued because their namespace had no free slot, with the time of their last attempt, per namespace
+	waiting map[string]map[string]time.Time
+
+	now func() time.Time
+}
+
+func NewNamespaceConcurrencyLimiter(maxPerNamespace int) *NamespaceConcurrencyLimiter {
+	return &NamespaceConcurrencyLimiter{
+		maxPerNamespace: maxPerNamespace,
+		active:          map[string]int{},
+		waiting:         map[string]map[string]time.Time{},
+		now:             time.Now,
+	}
+}
+
+// Takes a reconcile slot of the namespace of the InfisicalSecret. Returns false when the namespace has no free slot,
+// in which case the InfisicalSecret counts as waiting until it acquires one
+func (l *NamespaceConcurrencyLimiter) TryAcquire(infisicalSecret types.NamespacedName) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	defer l.recordQueueDepth(infisicalSecret.Namespace)
+
+	now := l.now()
+	l.expireWaiting(now)
+
+	if l.active[infisicalSecret.Namespace] >= l.maxPerNamespace {
+		if l.waiting[infisicalSecret.Namespace] == nil {
+			l.waiting[infisicalSecret.Namespace] = map[string]time.Time{}
+		}
+		l.waiting[infisicalSecret.Namespace][infisicalSecret.Name] = now
+		return false
+	}
+
+	l.active[infisicalSecret.Namespace]++
+	delete(l.waiting[infisicalSecret.Namespace], infisicalSecret.Name)
+	return true
+}
+
+// Frees the slot taken by a successful TryAcquire
+func (l *NamespaceConcurrencyLimiter) Release(infisicalSecret types.NamespacedName) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	defer l.recordQueueDepth(infisicalSecret.Namespace)
+
+	if l.active[infisicalSecret.Namespace] > 0 {
+		l.active[infisicalSecret.Namespace]--
+	}
+}
+
+// Number of InfisicalSecrets of the namespace that are being reconciled or waiting for a slot
+func (l *NamespaceConcurrencyLimiter) QueueDepth(namespace string) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.active[namespace] + len(l.waiting[namespace])
+}
+
+// must be called while holding the mutex. Drops the waiting InfisicalSecrets that did not retry within the expiry
+func (l *NamespaceConcurrencyLimiter) expireWaiting(now time.Time) {
+	for namespace, waitingSecrets := range l.waiting {
+		expired := false
+		for name, lastAttempt := range waitingSecrets {
+			if now.Sub(lastAttempt) >= NAMESPACE_CONCURRENCY_WAITING_EXPIRY {
+				delete(waitingSecrets, name)
+				expired = true
+			}
+		}
+
+		if expired {
+			l.recordQueueDepth(namespace)
+		}
+	}
+}
+
+// must be called while holding the mutex. Idle namespaces are removed so that the metric does not grow with every namespace ever seen
+func (l *NamespaceConcurrencyLimiter) recordQueueDepth(namespace string) {
+	depth := l.active[namespace] + len(l.waiting[namespace])
+	if depth == 0 {
+		delete(l.active, namespace)
+		delete(l.waiting, namespace)
+		namespaceQueueDepth.DeleteLabelValues(namespace)
+		return
+	}
+	namespaceQueueDepth.WithLabelValues(namespace).Set(float64(depth))
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestSlowNamespaceDoesNotBlockOtherNamespaces(t *testing.T) {
+	g := NewWithT(t)
+
+	limiter := NewNamespaceConcurrencyLimiter(1)
+	slowSecret := types.NamespacedName{Namespace: "team-slow", Name: "first"}
+	queuedSecret := types.NamespacedName{Namespace: "team-slow", Name: "second"}
+	otherSecret := types.NamespacedName{Namespace: "team-fast", Name: "first"}
+
+	g.Expect(limiter.TryAcquire(slowSecret)).To(BeTrue())
+	g.Expect(limiter.TryAcquire(queuedSecret)).To(BeFalse())
+	g.Expect(limiter.TryAcquire(otherSecret)).To(BeTrue())
+
+	g.Expect(limiter.QueueDepth("team-slow")).To(Equal(2))
+	g.Expect(testutil.ToFloat64(namespaceQueueDepth.WithLabelValues("team-slow"))).To(Equal(float64(2)))
+
+	// retrying while the namespace is still busy does not count the InfisicalSecret twice
+	g.Expect(limiter.TryAcquire(queuedSecret)).To(BeFalse())
+	g.Expect(limiter.QueueDepth("team-slow")).To(Equal(2))
+
+	limiter.Release(slowSecret)
+	g.Expect(limiter.TryAcquire(queuedSecret)).To(BeTrue())
+	g.Expect(limiter.QueueDepth("team-slow")).To(Equal(1))
+
+	limiter.Release(queuedSecret)
+	limiter.Release(otherSecret)
+	g.Expect(limiter.QueueDepth("team-slow")).To(Equal(0))
+	g.Expect(testutil.CollectAndCount(namespaceQueueDepth)).To(Equal(0))
+}
+
+func TestWaitingInfisicalSecretsThatStopRetryingExpire(t *testing.T) {
+	g := NewWithT(t)
+
+	now := time.Now()
+	limiter := NewNamespaceConcurrencyLimiter(1)
+	limiter.now = func() time.Time { return now }
+
+	runningSecret := types.NamespacedName{Namespace: "team-a", Name: "running"}
+	deletedSecret := types.NamespacedName{Namespace: "team-a", Name: "deleted"}
+	otherSecret := types.NamespacedName{Namespace: "team-b", Name: "first"}
+
+	g.Expect(limiter.TryAcquire(runningSecret)).To(BeTrue())
+	g.Expect(limiter.TryAcquire(deletedSecret)).To(BeFalse())
+	g.Expect(limiter.QueueDepth("team-a")).To(Equal(2))
+
+	// the waiting InfisicalSecret is deleted and never retries, while reconciles of other namespaces continue
+	now = now.Add(NAMESPACE_CONCURRENCY_WAITING_EXPIRY)
+	g.Expect(limiter.TryAcquire(otherSecret)).To(BeTrue())
+	g.Expect(limiter.QueueDepth("team-a")).To(Equal(1))
+	g.Expect(testutil.ToFloat64(namespaceQueueDepth.WithLabelValues("team-a"))).To(Equal(float64(1)))
+
+	limiter.Release(runningSecret)
+	limiter.Release(otherSecret)
+	g.Expect(testutil.CollectAndCount(namespaceQueueDepth)).To(Equal(0))
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ConfigMap which platform teams can create in a namespace to provide defaults for the InfisicalSecrets in that namespace
+const NAMESPACE_DEFAULTS_CONFIGMAP_NAME = "infisical-operator-defaults"
+
+const NAMESPACE_DEFAULT_PROPAGATE_SECRET_METADATA = "propagateSecretMetadata" // comma separated list of keys
+const NAMESPACE_DEFAULT_RESTART_ONLY_OUTDATED_PODS = "restartOnlyOutdatedPods"
+const NAMESPACE_DEFAULT_RECONCILE_TIMEOUT_SECONDS = "reconcileTimeoutSeconds"
+const NAMESPACE_DEFAULT_CASE_INSENSITIVE_SECRET_MATCHING = "caseInsensitiveSecretMatching"
+const NAMESPACE_DEFAULT_FIRST_OBSERVATION_POLICY = "firstObservationPolicy"
+
+// Returns a copy of the InfisicalSecret where the spec fields it leaves unset are filled in from the defaults ConfigMap of its namespace.
+// The ConfigMap is read on every reconcile, so changes to it apply without restarting the operator
+func (r *InfisicalSecretReconciler) ApplyNamespaceDefaults(ctx context.Context, infisicalSecret v1alpha1.InfisicalSecret) (v1alpha1.InfisicalSecret, error) {
+	defaultsConfigMap := &corev1.ConfigMap{}
+	err := r.Client.Get(ctx, types.NamespacedName{Namespace: infisicalSecret.Namespace, Name: NAMESPACE_DEFAULTS_CONFIGMAP_NAME}, defaultsConfigMap)
+	if errors.IsNotFound(err) {
+		return infisicalSecret, nil
+	}
+
+	if err != nil {
+		return infisicalSecret, fmt.Errorf("unable to fetch namespace defaults in [namespace=%s] [err=%s]", infisicalSecret.Namespace, err)
+	}
+
+	return MergeNamespaceDefaults(infisicalSecret, defaultsConfigMap.Data)
+}
+
+// Applies the namespace defaults like ApplyNamespaceDefaults. When they cannot be applied, no workloads are redeployed, which is reported on the
+// AutoRedeployReady condition and with a warning event so the owners of the namespace notice the broken ConfigMap
+func (r *InfisicalSecretReconciler) applyNamespaceDefaultsOrReport(ctx context.Context, infisicalSecret *v1alpha1.InfisicalSecret) (v1alpha1.InfisicalSecret, error) {
+	infisicalSecretWithDefaults, err := r.ApplyNamespaceDefaults(ctx, *infisicalSecret)
+	if err != nil {
+		r.Recorder.Eventf(infisicalSecret, corev1.EventTypeWarning, "InvalidNamespaceDefaults", "Workloads are not redeployed until the %v ConfigMap of namespace %v is fixed: %v", NAMESPACE_DEFAULTS_CONFIGMAP_NAME, infisicalSecret.Namespace, err)
+		if err := r.SetInfisicalAutoRedeploymentReady(ctx, infisicalSecret, ReconcileOutcome{}, fmt.Errorf("workloads are not redeployed because the namespace defaults cannot be applied: %w", err)); err != nil {
+			fmt.Println(err)
+		}
+	}
+	return infisicalSecretWithDefaults, err
+}
+
+// Fills the unset spec fields of the InfisicalSecret from the given defaults. Values set on the InfisicalSecret always take precedence,
+// including booleans explicitly set to false. Keys other than the NAMESPACE_DEFAULT_* keys are ignored
+func MergeNamespaceDefaults(infisicalSecret v1alpha1.InfisicalSecret, defaults map[string]string) (v1alpha1.InfisicalSecret, error) {
+	merged := *infisicalSecret.DeepCopy()
+
+	if value, exists := defaults[NAMESPACE_DEFAULT_PROPAGATE_SECRET_METADATA]; exists && len(merged.Spec.PropagateSecretMetadata) == 0 {
+		for _, key := range strings.Split(value, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				merged.Spec.PropagateSecretMetadata = append(merged.Spec.PropagateSecretMetadata, key)
+			}
+		}
+	}
+
+	if value, exists := defaults[NAMESPACE_DEFAULT_RESTART_ONLY_OUTDATED_PODS]; exists && merged.Spec.RestartOnlyOutdatedPods == nil {
+		parsedValue, err := parseNamespaceDefaultBool(NAMESPACE_DEFAULT_RESTART_ONLY_OUTDATED_PODS, value)
+		if err != nil {
+			return infisicalSecret, err
+		}
+		merged.Spec.RestartOnlyOutdatedPods = &parsedValue
+	}
+
+	if value, exists := defaults[NAMESPACE_DEFAULT_RECONCILE_TIMEOUT_SECONDS]; exists && merged.Spec.ReconcileTimeoutSeconds == 0 {
+		parsedValue, err := strconv.Atoi(value)
+		if err != nil || parsedValue < 0 {
+			return infisicalSecret, fmt.Errorf("invalid namespace default for [%s]: must be a positive number of seconds", NAMESPACE_DEFAULT_RECONCILE_TIMEOUT_SECONDS)
+		}
+		merged.Spec.ReconcileTimeoutSeconds = parsedValue
+	}
+
+	if value, exists := defaults[NAMESPACE_DEFAULT_CASE_INSENSITIVE_SECRET_MATCHING]; exists && merged.Spec.CaseInsensitiveSecretMatching == nil {
+		parsedValue, err := parseNamespaceDefaultBool(NAMESPACE_DEFAULT_CASE_INSENSITIVE_SECRET_MATCHING, value)
+		if err != nil {
+			return infisicalSecret, err
+		}
+		merged.Spec.CaseInsensitiveSecretMatching = &parsedValue
+	}
+
+	if value, exists := defaults[NAMESPACE_DEFAULT_FIRST_OBSERVATION_POLICY]; exists && merged.Spec.FirstObservationPolicy == "" {
+		if value != FIRST_OBSERVATION_POLICY_ADOPT && value != FIRST_OBSERVATION_POLICY_RESTART {
+			return infisicalSecret, fmt.Errorf("invalid namespace default for [%s]: must be %s or %s", NAMESPACE_DEFAULT_FIRST_OBSERVATION_POLICY, FIRST_OBSERVATION_POLICY_ADOPT, FIRST_OBSERVATION_POLICY_RESTART)
+		}
+		merged.Spec.FirstObservationPolicy = value
+	}
+
+	return merged, nil
+}
+
+func parseNamespaceDefaultBool(key string, value string) (bool, error) {
+	parsedValue, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid namespace default for [%s] [err=%s]", key, err)
+	}
+	return parsedValue, nil
+}
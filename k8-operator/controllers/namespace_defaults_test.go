@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestApplyNamespaceDefaults(t *testing.T) {
+	g := NewWithT(t)
+
+	defaultsConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: NAMESPACE_DEFAULTS_CONFIGMAP_NAME, Namespace: "team-a"},
+		Data: map[string]string{
+			NAMESPACE_DEFAULT_PROPAGATE_SECRET_METADATA:        "team, cost-center",
+			NAMESPACE_DEFAULT_RESTART_ONLY_OUTDATED_PODS:       "true",
+			NAMESPACE_DEFAULT_RECONCILE_TIMEOUT_SECONDS:        "30",
+			NAMESPACE_DEFAULT_CASE_INSENSITIVE_SECRET_MATCHING: "true",
+			NAMESPACE_DEFAULT_FIRST_OBSERVATION_POLICY:         FIRST_OBSERVATION_POLICY_RESTART,
+		},
+	}
+	r := newTestReconciler(defaultsConfigMap)
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-secrets", Namespace: "team-a"},
+		Spec: secretsv1alpha1.InfisicalSecretSpec{
+			ReconcileTimeoutSeconds: 10,
+		},
+	}
+
+	merged, err := r.ApplyNamespaceDefaults(context.Background(), infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(merged.Spec.PropagateSecretMetadata).To(Equal([]string{"team", "cost-center"}))
+	g.Expect(merged.Spec.RestartOnlyOutdatedPods).To(Equal(pointer.Bool(true)))
+	g.Expect(merged.Spec.CaseInsensitiveSecretMatching).To(Equal(pointer.Bool(true)))
+	g.Expect(merged.Spec.FirstObservationPolicy).To(Equal(FIRST_OBSERVATION_POLICY_RESTART))
+	// values set on the InfisicalSecret take precedence over the namespace defaults
+	g.Expect(merged.Spec.ReconcileTimeoutSeconds).To(Equal(10))
+	// the InfisicalSecret passed in is left untouched
+	g.Expect(infisicalSecret.Spec.PropagateSecretMetadata).To(BeEmpty())
+
+	infisicalSecret.Namespace = "team-b"
+	merged, err = r.ApplyNamespaceDefaults(context.Background(), infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(merged.Spec).To(Equal(infisicalSecret.Spec))
+
+	// booleans explicitly turned off on the InfisicalSecret are not overridden by a namespace default of true
+	infisicalSecret.Namespace = "team-a"
+	infisicalSecret.Spec.RestartOnlyOutdatedPods = pointer.Bool(false)
+	merged, err = r.ApplyNamespaceDefaults(context.Background(), infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(merged.Spec.RestartOnlyOutdatedPods).To(Equal(pointer.Bool(false)))
+	g.Expect(merged.Spec.CaseInsensitiveSecretMatching).To(Equal(pointer.Bool(true)))
+
+	_, err = MergeNamespaceDefaults(secretsv1alpha1.InfisicalSecret{}, map[string]string{NAMESPACE_DEFAULT_RECONCILE_TIMEOUT_SECONDS: "soon"})
+	g.Expect(err).To(HaveOccurred())
+
+	_, err = MergeNamespaceDefaults(secretsv1alpha1.InfisicalSecret{}, map[string]string{NAMESPACE_DEFAULT_FIRST_OBSERVATION_POLICY: "ignore"})
+	g.Expect(err).To(MatchError(ContainSubstring("firstObservationPolicy")))
+}
+
+func TestInvalidNamespaceDefaultsAreReported(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	defaultsConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: NAMESPACE_DEFAULTS_CONFIGMAP_NAME, Namespace: "team-a"},
+		Data:       map[string]string{NAMESPACE_DEFAULT_RESTART_ONLY_OUTDATED_PODS: "sometimes"},
+	}
+	infisicalSecret := &secretsv1alpha1.InfisicalSecret{ObjectMeta: metav1.ObjectMeta{Name: "app-secrets", Namespace: "team-a"}}
+	r := newTestReconciler(defaultsConfigMap, infisicalSecret)
+
+	_, err := r.applyNamespaceDefaultsOrReport(ctx, infisicalSecret)
+	g.Expect(err).To(MatchError(ContainSubstring("invalid namespace default for [restartOnlyOutdatedPods]")))
+
+	stored := &secretsv1alpha1.InfisicalSecret{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(infisicalSecret), stored)).To(Succeed())
+	condition := meta.FindStatusCondition(stored.Status.Conditions, "secrets.infisical.com/AutoRedeployReady")
+	g.Expect(condition).NotTo(BeNil())
+	g.Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+	g.Expect(condition.Message).To(ContainSubstring("namespace defaults cannot be applied"))
+
+	events := r.Recorder.(*record.FakeRecorder).Events
+	g.Expect(events).To(HaveLen(1))
+	g.Expect(<-events).To(And(HavePrefix(corev1.EventTypeWarning), ContainSubstring("InvalidNamespaceDefaults")))
+}
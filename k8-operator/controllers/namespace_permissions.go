@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Resources of the apps API group, per workload kind, that need to be updated to restart a workload
+var WORKLOAD_RESOURCES = map[string]string{
+	WORKLOAD_KIND_DEPLOYMENT:   "deployments",
+	WORKLOAD_KIND_STATEFUL_SET: "statefulsets",
+	WORKLOAD_KIND_DAEMON_SET:   "daemonsets",
+}
+
+// Remembers the outcome of the permission checks made during a single reconcile, so every namespace and workload kind is only checked once
+type workloadPermissionCache struct {
+	allowed map[string]bool
+	// workload resources the operator may not update, per namespace
+	forbidden map[string][]string
+}
+
+func newWorkloadPermissionCache() *workloadPermissionCache {
+	return &workloadPermissionCache{allowed: map[string]bool{}, forbidden: map[string][]string{}}
+}
+
+// Checks with a SelfSubjectAccessReview whether the operator may update workloads of the given kind in the namespace.
+// When the review itself fails the update is assumed to be allowed, so that workloads are still attempted individually
+func (r *InfisicalSecretReconciler) CanUpdateWorkload(ctx context.Context, permissions *workloadPermissionCache, workload Workload) bool {
+	resource, isKnownResource := WORKLOAD_RESOURCES[workload.Kind]
+	if !isKnownResource {
+		return true
+	}
+
+	cacheKey := fmt.Sprintf("%s/%s", workload.Metadata.Namespace, resource)
+	if allowed, isCached := permissions.allowed[cacheKey]; isCached {
+		return allowed
+	}
+
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: workload.Metadata.Namespace,
+				Verb:      "update",
+				Group:     "apps",
+				Resource:  resource,
+			},
+		},
+	}
+
+	if err := r.Client.Create(ctx, review); err != nil {
+		fmt.Printf("unable to check permission to update [resource=%v] in [namespace=%v]. Attempting updates anyway [err=%v]\n", resource, workload.Metadata.Namespace, err)
+		return true
+	}
+
+	permissions.allowed[cacheKey] = review.Status.Allowed
+	if !review.Status.Allowed {
+		permissions.forbidden[workload.Metadata.Namespace] = append(permissions.forbidden[workload.Metadata.Namespace], resource)
+	}
+
+	return review.Status.Allowed
+}
+
+// Emits a single warning event per namespace in which the operator was not allowed to update consuming workloads
+func (r *InfisicalSecretReconciler) RecordForbiddenNamespaces(infisicalSecret *v1alpha1.InfisicalSecret, permissions *workloadPermissionCache) {
+	namespaces := make([]string, 0, len(permissions.forbidden))
+	for namespace := range permissions.forbidden {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	for _, namespace := range namespaces {
+		resources := strings.Join(permissions.forbidden[namespace], ", ")
+		fmt.Printf("operator is not allowed to update [resources=%v] in [namespace=%v]. Skipping their restart\n", resources, namespace)
+		r.Recorder.Eventf(infisicalSecret, corev1.EventTypeWarning, "NamespaceForbidden", "Skipped restarting %v in namespace %v because the operator is not allowed to update them. Grant the operator update access to reload them", resources, namespace)
+	}
+}
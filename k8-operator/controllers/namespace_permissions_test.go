@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+// Answers access reviews the way the API server would for an operator that may not update workloads in the forbidden namespaces
+type accessReviewClient struct {
+	client.Client
+	forbiddenNamespaces map[string]bool
+	reviews             int
+}
+
+func (c *accessReviewClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if review, isReview := obj.(*authorizationv1.SelfSubjectAccessReview); isReview {
+		c.reviews++
+		review.Status.Allowed = !c.forbiddenNamespaces[review.Spec.ResourceAttributes.Namespace]
+		return nil
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestPreflightSkipsNamespacesWithoutUpdatePermission(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+
+	secretInNamespace := func(namespace string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "managed-secret",
+				Namespace:   namespace,
+				Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+			},
+		}
+	}
+
+	deployment := func(namespace string, name string) *v1.Deployment {
+		deployment := &v1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   namespace,
+				Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1"},
+			},
+		}
+		deployment.Spec.Template.Annotations = map[string]string{versionKey: "v1"}
+		deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+			Name: "app",
+			EnvFrom: []corev1.EnvFromSource{{
+				SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+			}},
+		}}
+		return deployment
+	}
+
+	r := newTestReconciler(
+		secretInNamespace("default"),
+		deployment("default", "api"),
+		secretInNamespace("restricted"),
+		deployment("restricted", "api"),
+		deployment("restricted", "worker"),
+	)
+	reviewClient := &accessReviewClient{Client: r.Client, forbiddenNamespaces: map[string]bool{"restricted": true}}
+	r.Client = reviewClient
+	r.PreflightWorkloadPermissions = true
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+	infisicalSecret.Spec.ReloadNamespaces = []string{"restricted"}
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 3, Restarted: 1, Skipped: 2}))
+	g.Expect(reviewClient.reviews).To(Equal(2))
+
+	restricted := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, types.NamespacedName{Namespace: "restricted", Name: "api"}, restricted)).To(Succeed())
+	g.Expect(restricted.Spec.Template.Annotations[versionKey]).To(Equal("v1"))
+
+	var warnings []string
+	for len(r.Recorder.(*record.FakeRecorder).Events) > 0 {
+		event := <-r.Recorder.(*record.FakeRecorder).Events
+		if strings.HasPrefix(event, corev1.EventTypeWarning) {
+			warnings = append(warnings, event)
+		}
+	}
+	g.Expect(warnings).To(HaveLen(1))
+	g.Expect(warnings[0]).To(ContainSubstring("namespace restricted"))
+
+	// once the operator is granted access, only the namespace with outdated workloads is reviewed
+	reviewClient.forbiddenNamespaces = map[string]bool{}
+	reviewClient.reviews = 0
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 3, Restarted: 2}))
+	g.Expect(reviewClient.reviews).To(Equal(1))
+
+	// resyncs of up to date workloads make no reviews at all
+	reviewClient.reviews = 0
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 3}))
+	g.Expect(reviewClient.reviews).To(Equal(0))
+}
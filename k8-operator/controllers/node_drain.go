@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Checks if the cluster is going through node maintenance, which is the case when the number (or percentage) of cordoned nodes reaches the configured thresholds.
+// A node counts as cordoned when it is marked unschedulable or carries the node.kubernetes.io/unschedulable taint
+func (r *InfisicalSecretReconciler) IsClusterUnderMaintenance(ctx context.Context) (bool, string, error) {
+	listOfNodes := &corev1.NodeList{}
+	if err := r.Client.List(ctx, listOfNodes); err != nil {
+		return false, "", fmt.Errorf("unable to list cluster nodes [err=%w]", err)
+	}
+
+	totalNodes := len(listOfNodes.Items)
+	if totalNodes == 0 {
+		return false, "", nil
+	}
+
+	unschedulableNodes := 0
+	for _, node := range listOfNodes.Items {
+		if isNodeUnschedulable(node) {
+			unschedulableNodes++
+		}
+	}
+
+	if r.DrainUnschedulableNodeThreshold > 0 && unschedulableNodes >= r.DrainUnschedulableNodeThreshold {
+		return true, fmt.Sprintf("%v of %v nodes are unschedulable (threshold is %v nodes)", unschedulableNodes, totalNodes, r.DrainUnschedulableNodeThreshold), nil
+	}
+
+	unschedulablePercentage := unschedulableNodes * 100 / totalNodes
+	if r.DrainUnschedulableNodePercentage > 0 && unschedulablePercentage >= r.DrainUnschedulableNodePercentage {
+		return true, fmt.Sprintf("%v%% of nodes are unschedulable (threshold is %v%%)", unschedulablePercentage, r.DrainUnschedulableNodePercentage), nil
+	}
+
+	return false, "", nil
+}
+
+func isNodeUnschedulable(node corev1.Node) bool {
+	if node.Spec.Unschedulable {
+		return true
+	}
+
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == corev1.TaintNodeUnschedulable {
+			return true
+		}
+	}
+
+	return false
+}
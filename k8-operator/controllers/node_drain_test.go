@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestIsClusterUnderMaintenance(t *testing.T) {
+	g := NewWithT(t)
+
+	nodes := []client.Object{
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-b"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-c"}, Spec: corev1.NodeSpec{Unschedulable: true}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-d"}, Spec: corev1.NodeSpec{
+			Taints: []corev1.Taint{{Key: corev1.TaintNodeUnschedulable, Effect: corev1.TaintEffectNoSchedule}},
+		}},
+	}
+
+	r := newTestReconciler(nodes...)
+
+	r.DrainUnschedulableNodeThreshold = 3
+	underMaintenance, _, err := r.IsClusterUnderMaintenance(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(underMaintenance).To(BeFalse())
+
+	r.DrainUnschedulableNodeThreshold = 2
+	underMaintenance, reason, err := r.IsClusterUnderMaintenance(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(underMaintenance).To(BeTrue())
+	g.Expect(reason).To(ContainSubstring("2 of 4 nodes"))
+
+	r.DrainUnschedulableNodeThreshold = 0
+	r.DrainUnschedulableNodePercentage = 50
+	underMaintenance, _, err = r.IsClusterUnderMaintenance(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(underMaintenance).To(BeTrue())
+}
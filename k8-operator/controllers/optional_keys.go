@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// comma separated list of the optionally referenced keys that were present in the managed secret when the workload was last restarted
+const DEPLOYMENT_OPTIONAL_KEYS_PRESENT_ANNOTATION_PREFIX = "secrets.infisical.com/optional-keys-present"
+
+// Returns the keys of the managed secret that the pod template references through secretKeyRef entries marked as optional, sorted and without duplicates.
+// Pods start without such keys when they are missing, so a key appearing or disappearing changes what the pods see
+func GetOptionalSecretKeyReferences(podTemplate corev1.PodTemplateSpec, managedSecretName ManagedSecretName) []string {
+	seen := map[string]bool{}
+	var keys []string
+
+	containers := append(append([]corev1.Container{}, podTemplate.Spec.InitContainers...), podTemplate.Spec.Containers...)
+	for _, container := range containers {
+		for _, env := range container.Env {
+			if env.ValueFrom == nil || env.ValueFrom.SecretKeyRef == nil {
+				continue
+			}
+
+			secretKeyRef := env.ValueFrom.SecretKeyRef
+			if secretKeyRef.Optional != nil && *secretKeyRef.Optional && managedSecretName.Matches(secretKeyRef.Name) && !seen[secretKeyRef.Key] {
+				seen[secretKeyRef.Key] = true
+				keys = append(keys, secretKeyRef.Key)
+			}
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// Checks if the pod template references the managed secret through envFrom or secretKeyRef entries marked as optional. Containers with required references
+// do not start until the secret exists, while containers with optional references start without the values of a missing secret
+func HasOptionalSecretEnvReferences(podTemplate corev1.PodTemplateSpec, managedSecretName ManagedSecretName) bool {
+	containers := append(append([]corev1.Container{}, podTemplate.Spec.InitContainers...), podTemplate.Spec.Containers...)
+	for _, container := range containers {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.SecretRef != nil && envFrom.SecretRef.Optional != nil && *envFrom.SecretRef.Optional && managedSecretName.Matches(envFrom.SecretRef.Name) {
+				return true
+			}
+		}
+	}
+
+	return len(GetOptionalSecretKeyReferences(podTemplate, managedSecretName)) > 0
+}
+
+// A workload created before the managed secret that references it optionally may run pods which started while the secret was missing
+func wasStartedWithoutOptionalSecret(workload Workload, secret corev1.Secret, managedSecretName ManagedSecretName) bool {
+	return workload.Metadata.CreationTimestamp.Before(&secret.CreationTimestamp) && HasOptionalSecretEnvReferences(*workload.PodTemplate, managedSecretName)
+}
+
+// Describes which of the optionally referenced keys exist in the secret, in the format of the optional keys present annotation
+func getOptionalKeysPresence(optionalKeys []string, secret corev1.Secret) string {
+	var presentKeys []string
+	for _, key := range optionalKeys {
+		if _, exists := secret.Data[key]; exists {
+			presentKeys = append(presentKeys, key)
+		}
+	}
+	return strings.Join(presentKeys, ",")
+}
+
+// Checks if an optionally referenced key appeared in or disappeared from the secret since the workload was last restarted.
+// Workloads restarted before their presence was tracked are considered unchanged
+func hasOptionalKeysPresenceChanged(workload Workload, secret corev1.Secret, managedSecretName ManagedSecretName) bool {
+	presenceAnnotationKey := fmt.Sprintf("%s.%s", DEPLOYMENT_OPTIONAL_KEYS_PRESENT_ANNOTATION_PREFIX, secret.Name)
+
+	previousPresence, isTracked := workload.Metadata.Annotations[presenceAnnotationKey]
+	if !isTracked {
+		return false
+	}
+
+	return previousPresence != getOptionalKeysPresence(GetOptionalSecretKeyReferences(*workload.PodTemplate, managedSecretName), secret)
+}
+
+// Records the presence of the optionally referenced keys on the workload, or removes the record when it has no optional references
+func recordOptionalKeysPresence(workload Workload, secret corev1.Secret, managedSecretName ManagedSecretName) {
+	presenceAnnotationKey := fmt.Sprintf("%s.%s", DEPLOYMENT_OPTIONAL_KEYS_PRESENT_ANNOTATION_PREFIX, secret.Name)
+
+	optionalKeys := GetOptionalSecretKeyReferences(*workload.PodTemplate, managedSecretName)
+	if len(optionalKeys) == 0 {
+		delete(workload.Metadata.Annotations, presenceAnnotationKey)
+		return
+	}
+
+	workload.Metadata.Annotations[presenceAnnotationKey] = getOptionalKeysPresence(optionalKeys, secret)
+}
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestOptionalSecretKeyTransitions(t *testing.T) {
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+	presenceKey := DEPLOYMENT_OPTIONAL_KEYS_PRESENT_ANNOTATION_PREFIX + ".managed-secret"
+
+	secretWithData := func(data map[string][]byte) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "managed-secret",
+				Namespace:   "default",
+				Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+			},
+			Data: data,
+		}
+	}
+
+	deploymentWithPresence := func(presence string) *v1.Deployment {
+		deployment := &v1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "api",
+				Namespace:   "default",
+				Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v2", presenceKey: presence},
+			},
+		}
+		deployment.Spec.Template.Annotations = map[string]string{versionKey: "v2"}
+		deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+			Name: "api",
+			Env: []corev1.EnvVar{
+				{Name: "DB_PASS", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"},
+					Key:                  "DB_PASS",
+				}}},
+				{Name: "API_KEY", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"},
+					Key:                  "API_KEY",
+					Optional:             pointer.Bool(true),
+				}}},
+			},
+		}}
+		return deployment
+	}
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	testCases := map[string]struct {
+		previousPresence string
+		data             map[string][]byte
+		reason           string
+		presence         string
+	}{
+		"key appears":      {"", map[string][]byte{"DB_PASS": []byte("pass"), "API_KEY": []byte("key")}, RELOAD_REASON_OPTIONAL_KEY_CHANGED, "API_KEY"},
+		"key disappears":   {"API_KEY", map[string][]byte{"DB_PASS": []byte("pass")}, RELOAD_REASON_OPTIONAL_KEY_CHANGED, ""},
+		"key still absent": {"", map[string][]byte{"DB_PASS": []byte("pass")}, "", ""},
+		"key still there":  {"API_KEY", map[string][]byte{"DB_PASS": []byte("pass"), "API_KEY": []byte("key")}, "", "API_KEY"},
+	}
+
+	for name, testCase := range testCases {
+		g := NewWithT(t)
+
+		secret := secretWithData(testCase.data)
+		deployment := deploymentWithPresence(testCase.previousPresence)
+		g.Expect(newTestReconciler().GetReloadReason(NewDeploymentWorkload(deployment), *secret, infisicalSecret)).To(Equal(testCase.reason), name)
+
+		r := newTestReconciler(secret, deployment)
+		_, err := r.ReconcileWorkloadsWithManagedSecrets(context.Background(), infisicalSecret)
+		g.Expect(err).NotTo(HaveOccurred(), name)
+
+		reconciledDeployment := &v1.Deployment{}
+		g.Expect(r.Client.Get(context.Background(), client.ObjectKeyFromObject(deployment), reconciledDeployment)).To(Succeed(), name)
+		g.Expect(reconciledDeployment.Annotations[presenceKey]).To(Equal(testCase.presence), name)
+		g.Expect(reconciledDeployment.Spec.Template.Annotations[DEPLOYMENT_RELOAD_REASON_ANNOTATION]).To(Equal(testCase.reason), name)
+	}
+}
+
+func TestOptionalEnvFromRestartsWhenSecretIsCreatedLater(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+	deployedAt := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+
+	deploymentWithEnvFrom := func(name string, optional bool) *v1.Deployment {
+		deployment := &v1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: deployedAt,
+				Annotations:       map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true"},
+			},
+		}
+		deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+			Name: "app",
+			EnvFrom: []corev1.EnvFromSource{{
+				SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"},
+					Optional:             pointer.Bool(optional),
+				},
+			}},
+		}}
+		return deployment
+	}
+
+	optionalConsumer := deploymentWithEnvFrom("optional-consumer", true)
+	requiredConsumer := deploymentWithEnvFrom("required-consumer", false)
+
+	// the secret is created by the operator after both workloads were deployed
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "managed-secret",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(deployedAt.Add(30 * time.Minute)),
+			Annotations:       map[string]string{SECRET_VERSION_ANNOTATION: "v1"},
+		},
+	}
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	r := newTestReconciler(managedSecret, optionalConsumer, requiredConsumer)
+	r.AdoptWorkloadsOnFirstObservation = true
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 2, Restarted: 1, Adopted: 1}))
+
+	restartedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(optionalConsumer), restartedDeployment)).To(Succeed())
+	g.Expect(restartedDeployment.Spec.Template.Annotations[versionKey]).To(Equal("v1"))
+	g.Expect(restartedDeployment.Spec.Template.Annotations[DEPLOYMENT_RELOAD_REASON_ANNOTATION]).To(Equal(RELOAD_REASON_OPTIONAL_SECRET_CREATED))
+
+	// containers with a required reference waited for the secret to be created, so they already use it
+	adoptedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(requiredConsumer), adoptedDeployment)).To(Succeed())
+	g.Expect(adoptedDeployment.Annotations[versionKey]).To(Equal("v1"))
+	g.Expect(adoptedDeployment.Spec.Template.Annotations).NotTo(HaveKey(versionKey))
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	"github.com/Infisical/infisical/k8-operator/packages/audit"
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const WORKLOAD_KIND_POD = "Pod"
+const DELETE_POD_ON_RELOAD_ANNOTATION = "secrets.infisical.com/delete-on-reload" // needs to be set to true for a pod without a controller to be deleted when the managed secret changes
+
+// Wraps a pod so it can be matched and audited like a workload. The pod template is a copy, as pods have no template of their own
+func NewPodWorkload(pod *corev1.Pod) Workload {
+	return Workload{
+		Kind:        WORKLOAD_KIND_POD,
+		Object:      pod,
+		Metadata:    &pod.ObjectMeta,
+		PodTemplate: &corev1.PodTemplateSpec{ObjectMeta: pod.ObjectMeta, Spec: pod.Spec},
+	}
+}
+
+// Deletes the pods with auto reload enabled which consume an outdated version of the managed secret and are not managed through a pod template
+// the operator already restarts. Pods with a controller are recreated by it, while pods without one are gone for good, so those must opt in explicitly
+func (r *InfisicalSecretReconciler) ReconcileStandalonePods(ctx context.Context, namespaces []string, secret corev1.Secret, infisicalSecret v1alpha1.InfisicalSecret, outcome *ReconcileOutcome) error {
+	secretLastModified := GetSecretLastModifiedTime(secret)
+
+	for _, namespace := range namespaces {
+		listOfPods := &corev1.PodList{}
+		err := r.Client.List(ctx, listOfPods, &client.ListOptions{Namespace: namespace})
+		if err != nil {
+			return fmt.Errorf("unable to get pods in the [namespace=%v] [err=%w]", namespace, err)
+		}
+
+		for i := range listOfPods.Items {
+			pod := &listOfPods.Items[i]
+			if pod.DeletionTimestamp != nil || pod.Annotations[AUTO_RELOAD_DEPLOYMENT_ANNOTATION] != "true" {
+				continue
+			}
+
+			workload := NewPodWorkload(pod)
+			if !r.IsWorkloadUsingManagedSecret(workload, infisicalSecret) {
+				continue
+			}
+
+			restartedThroughTemplate, err := r.IsPodRestartedThroughTemplate(ctx, pod)
+			if err != nil {
+				fmt.Println(err)
+				outcome.recordFailure(workload, err)
+				continue
+			}
+
+			if restartedThroughTemplate {
+				continue
+			}
+
+			outcome.record(WORKLOAD_KIND_POD, WorkloadCounts{Matched: 1})
+
+			// pods pick up the secret when they are created, so only pods created after the last change already carry it
+			if pod.CreationTimestamp.After(secretLastModified.Time) {
+				continue
+			}
+
+			if metav1.GetControllerOf(pod) == nil && pod.Annotations[DELETE_POD_ON_RELOAD_ANNOTATION] != "true" {
+				fmt.Printf("[pod=%v] has no controller and does not opt in to deletion. Skipping reload\n", workload.Ref())
+				r.AuditRestartDecision(infisicalSecret, workload, "", secret.Annotations[SECRET_VERSION_ANNOTATION], audit.DECISION_SKIPPED, nil)
+				outcome.record(WORKLOAD_KIND_POD, WorkloadCounts{Skipped: 1})
+				continue
+			}
+
+			fmt.Printf("pod is using outdated managed secret. Deleting [pod=%v]\n", workload.Ref())
+
+			err = r.Client.Delete(ctx, pod, client.Preconditions{UID: &pod.UID})
+			if err != nil && !errors.IsNotFound(err) {
+				err = fmt.Errorf("failed to delete pod: %w", err)
+				fmt.Println(err)
+				r.AuditRestartDecision(infisicalSecret, workload, "", secret.Annotations[SECRET_VERSION_ANNOTATION], audit.DECISION_RESTARTED, err)
+				outcome.recordFailure(workload, err)
+				continue
+			}
+
+			r.AuditRestartDecision(infisicalSecret, workload, "", secret.Annotations[SECRET_VERSION_ANNOTATION], audit.DECISION_RESTARTED, nil)
+			workloadReloadsTotal.WithLabelValues(WORKLOAD_KIND_POD, RELOAD_REASON_DATA_CHANGED).Inc()
+			outcome.record(WORKLOAD_KIND_POD, WorkloadCounts{Restarted: 1})
+		}
+	}
+
+	return nil
+}
+
+// Checks if the pod belongs to a Deployment, StatefulSet or DaemonSet, which are restarted by updating their pod template instead
+func (r *InfisicalSecretReconciler) IsPodRestartedThroughTemplate(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	controllerRef := metav1.GetControllerOf(pod)
+	if controllerRef == nil {
+		return false, nil
+	}
+
+	switch controllerRef.Kind {
+	case WORKLOAD_KIND_STATEFUL_SET, WORKLOAD_KIND_DAEMON_SET:
+		return true, nil
+	case "ReplicaSet":
+		replicaSet := &v1.ReplicaSet{}
+		err := r.Client.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: controllerRef.Name}, replicaSet)
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+
+		if err != nil {
+			return false, fmt.Errorf("unable to fetch replica set of [pod=%v/%v] [err=%w]", pod.Namespace, pod.Name, err)
+		}
+
+		replicaSetController := metav1.GetControllerOf(replicaSet)
+		return replicaSetController != nil && replicaSetController.Kind == WORKLOAD_KIND_DEPLOYMENT, nil
+	}
+
+	return false, nil
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestStandalonePodsAreOnlyDeletedWhenSafe(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	secretModified := time.Now().Add(-time.Hour)
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "managed-secret",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(secretModified),
+			Annotations:       map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	controllerRef := func(kind string, name string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: kind, Name: name, UID: types.UID(name), Controller: pointer.Bool(true)}}
+	}
+
+	consumingPod := func(name string, created time.Time, owners []metav1.OwnerReference, annotations map[string]string) *corev1.Pod {
+		podAnnotations := map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true"}
+		for key, value := range annotations {
+			podAnnotations[key] = value
+		}
+
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				UID:               types.UID(name),
+				CreationTimestamp: metav1.NewTime(created),
+				OwnerReferences:   owners,
+				Annotations:       podAnnotations,
+			},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name: "app",
+				EnvFrom: []corev1.EnvFromSource{{
+					SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+				}},
+			}}},
+		}
+	}
+
+	outdated := secretModified.Add(-time.Hour)
+
+	r := newTestReconciler(
+		managedSecret,
+		&v1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "api-7d4b9", Namespace: "default", OwnerReferences: controllerRef("Deployment", "api")}},
+		consumingPod("job-runner", outdated, controllerRef("Job", "migration"), nil),
+		consumingPod("standalone", outdated, nil, nil),
+		consumingPod("standalone-opted-in", outdated, nil, map[string]string{DELETE_POD_ON_RELOAD_ANNOTATION: "true"}),
+		consumingPod("fresh", secretModified.Add(time.Minute), controllerRef("Job", "migration"), nil),
+		// restarted through the pod template of its deployment
+		consumingPod("api-7d4b9-x2x8k", outdated, controllerRef("ReplicaSet", "api-7d4b9"), nil),
+		consumingPod("db-0", outdated, controllerRef("StatefulSet", "db"), nil),
+	)
+	r.EnablePodDeletion = true
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.ByKind[WORKLOAD_KIND_POD]).To(Equal(WorkloadCounts{Matched: 4, Restarted: 2, Skipped: 1}))
+
+	expectDeleted := map[string]bool{
+		"job-runner":          true,
+		"standalone-opted-in": true,
+		"standalone":          false,
+		"fresh":               false,
+		"api-7d4b9-x2x8k":     false,
+		"db-0":                false,
+	}
+	for name, deleted := range expectDeleted {
+		err := r.Client.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, &corev1.Pod{})
+		if deleted {
+			g.Expect(errors.IsNotFound(err)).To(BeTrue(), name)
+		} else {
+			g.Expect(err).NotTo(HaveOccurred(), name)
+		}
+	}
+}
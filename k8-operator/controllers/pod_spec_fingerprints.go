@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Fingerprints of the managed secret computed while reconciling the workloads of a single InfisicalSecret. Which keys a workload consumes only
+// depends on its pod spec, so workloads with identical pod specs, such as generated copies of a Deployment, share one fingerprint instead of each
+// computing it again. Only the pod spec is compared as the operator's own pod template annotations differ between otherwise identical workloads
+type podSpecFingerprints struct {
+	// hash of the pod spec of every workload, keyed by its Ref
+	podSpecHashes map[string]string
+
+	mutex  sync.Mutex
+	hashes map[string]string
+}
+
+func newPodSpecFingerprints(workloads []Workload) *podSpecFingerprints {
+	fingerprints := &podSpecFingerprints{
+		podSpecHashes: map[string]string{},
+		hashes:        map[string]string{},
+	}
+
+	for _, workload := range workloads {
+		if podSpecHash, err := getPodSpecHash(workload.PodTemplate.Spec); err == nil {
+			fingerprints.podSpecHashes[workload.Ref()] = podSpecHash
+		}
+	}
+	return fingerprints
+}
+
+func getPodSpecHash(podSpec corev1.PodSpec) (string, error) {
+	encodedPodSpec, err := json.Marshal(podSpec)
+	if err != nil {
+		return "", err
+	}
+
+	hash := fnv.New64a()
+	hash.Write(encodedPodSpec)
+	return fmt.Sprintf("%x", hash.Sum64()), nil
+}
+
+// Returns the fingerprint of the secret shared by the workloads with the same pod spec, computing it for the first of them only.
+// Computes it every time when fingerprints are not shared, e.g. for workloads reconciled outside of ReconcileWorkloadsWithManagedSecrets
+func (f *podSpecFingerprints) get(workload Workload, secret corev1.Secret, compute func() string) string {
+	if f == nil {
+		return compute()
+	}
+
+	podSpecHash, isHashed := f.podSpecHashes[workload.Ref()]
+	if !isHashed {
+		return compute()
+	}
+
+	key := fmt.Sprintf("%s/%s@%s/%s", secret.Namespace, secret.Name, secret.Annotations[SECRET_VERSION_ANNOTATION], podSpecHash)
+
+	f.mutex.Lock()
+	fingerprint, isComputed := f.hashes[key]
+	f.mutex.Unlock()
+	if isComputed {
+		return fingerprint
+	}
+
+	fingerprint = compute()
+
+	f.mutex.Lock()
+	f.hashes[key] = fingerprint
+	f.mutex.Unlock()
+	return fingerprint
+}
+
+// Refs of the workloads sharing an identical pod spec, for every pod spec shared by more than one workload
+func (f *podSpecFingerprints) GetSharedPodSpecs(workloads []Workload) [][]string {
+	refsByPodSpec := map[string][]string{}
+	var podSpecs []string
+	for _, workload := range workloads {
+		podSpecHash, isHashed := f.podSpecHashes[workload.Ref()]
+		if !isHashed {
+			continue
+		}
+
+		if _, seen := refsByPodSpec[podSpecHash]; !seen {
+			podSpecs = append(podSpecs, podSpecHash)
+		}
+		refsByPodSpec[podSpecHash] = append(refsByPodSpec[podSpecHash], workload.Ref())
+	}
+
+	var shared [][]string
+	for _, podSpecHash := range podSpecs {
+		if len(refsByPodSpec[podSpecHash]) > 1 {
+			shared = append(shared, refsByPodSpec[podSpecHash])
+		}
+	}
+	return shared
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestIdenticalPodSpecsShareFingerprint(t *testing.T) {
+	g := NewWithT(t)
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+	deploymentWithKey := func(name string, key string, version string) Workload {
+		deployment := &v1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		// generated copies only differ in the annotations the operator records on them
+		deployment.Spec.Template.Annotations = map[string]string{versionKey: version}
+		deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+			Name: "app",
+			Env: []corev1.EnvVar{{
+				Name: key,
+				ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"},
+					Key:                  key,
+				}},
+			}},
+		}}
+		return NewDeploymentWorkload(deployment)
+	}
+
+	workloads := []Workload{
+		deploymentWithKey("copy-1", "DB_PASS", "v1"),
+		deploymentWithKey("other", "API_KEY", "v1"),
+		deploymentWithKey("copy-2", "DB_PASS", "v2"),
+	}
+	secret := corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "managed-secret", Namespace: "default", Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"}},
+		Data:       map[string][]byte{"DB_PASS": []byte("db-password"), "API_KEY": []byte("api-key")},
+	}
+
+	fingerprints := newPodSpecFingerprints(workloads)
+	g.Expect(fingerprints.GetSharedPodSpecs(workloads)).To(Equal([][]string{{"Deployment/default/copy-1", "Deployment/default/copy-2"}}))
+
+	computations := 0
+	for i := range workloads {
+		workloads[i].fingerprints = fingerprints
+		workloads[i].fingerprints.get(workloads[i], secret, func() string {
+			computations++
+			return "fingerprint"
+		})
+	}
+	g.Expect(computations).To(Equal(2))
+
+	// a shared fingerprint is the one each of the workloads would compute on its own
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	r := newTestReconciler()
+	sharedFingerprints := newPodSpecFingerprints(workloads)
+	workloads[0].fingerprints = sharedFingerprints
+	workloads[2].fingerprints = sharedFingerprints
+	g.Expect(r.GetConsumedKeysHash(workloads[0], secret, infisicalSecret)).To(Equal(r.getConsumedKeysHash([]string{"DB_PASS"}, secret)))
+	g.Expect(r.GetConsumedKeysHash(workloads[2], secret, infisicalSecret)).To(Equal(r.getConsumedKeysHash([]string{"DB_PASS"}, secret)))
+}
@@ -0,0 +1,262 @@
+package controllers
+
+import (
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const BUILTIN_REFERENCE_DETECTOR = "builtin"
+const PROJECTED_REFERENCE_DETECTOR = "projected"
+const CSI_REFERENCE_DETECTOR = "csi"
+const IMAGE_PULL_SECRET_REFERENCE_DETECTOR = "image-pull-secret"
+const ANNOTATION_REFERENCE_DETECTOR = "annotation"
+
+// Pod template annotation listing secrets consumed by a workload that cannot be detected from its spec (e.g. secrets read through the Kubernetes API)
+const USES_SECRETS_ANNOTATION = "secrets.infisical.com/uses-secrets"
+
+const REFERENCE_SOURCE_ENV_FROM = "envFrom"
+const REFERENCE_SOURCE_ENV = "env"
+const REFERENCE_SOURCE_VOLUME = "volume"
+const REFERENCE_SOURCE_PROJECTED_VOLUME = "projectedVolume"
+const REFERENCE_SOURCE_CSI_VOLUME = "csiVolume"
+const REFERENCE_SOURCE_IMAGE_PULL_SECRET = "imagePullSecret"
+const REFERENCE_SOURCE_ANNOTATION = "annotation"
+
+// The name of the managed secret workloads are scanned for
+type ManagedSecretName struct {
+	Name            string
+	CaseInsensitive bool
+	// Names the secret had before it was renamed, which are still matched while workloads migrate to the new name
+	PreviousNames []string
+}
+
+func (n ManagedSecretName) Matches(referencedName string) bool {
+	return isSameSecretName(referencedName, n.Name, n.CaseInsensitive) || n.IsPreviousName(referencedName)
+}
+
+func (n ManagedSecretName) IsPreviousName(referencedName string) bool {
+	for _, previousName := range n.PreviousNames {
+		if isSameSecretName(referencedName, previousName, n.CaseInsensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// A single place in a pod template where the managed secret is consumed
+type SecretReferenceMatch struct {
+	Detector string
+	Source   string
+	// Name of the consuming container. Empty when the secret is referenced at the pod level only (e.g. an unmounted volume)
+	Container string
+	// Key of the secret that is consumed. Empty when the whole secret is consumed
+	Key string
+	// Name of the env var the key is exposed as. Only set for env references, and not unique across the containers of a pod
+	Variable string
+}
+
+// Groups the consumed keys of the secret by the container consuming them, so containers defining the same env var from different keys are told apart.
+// A container consuming the whole secret maps to an empty key. References made at the pod level only are not attributed to any container
+func GetConsumedKeysByContainer(matches []SecretReferenceMatch) map[string][]string {
+	keysByContainer := map[string][]string{}
+	seen := map[string]bool{}
+	for _, match := range matches {
+		if match.Container == "" {
+			continue
+		}
+
+		containerKey := match.Container + "/" + match.Key
+		if !seen[containerKey] {
+			seen[containerKey] = true
+			keysByContainer[match.Container] = append(keysByContainer[match.Container], match.Key)
+		}
+	}
+
+	for _, keys := range keysByContainer {
+		sort.Strings(keys)
+	}
+	return keysByContainer
+}
+
+// Finds references to the managed secret in a pod template. Detectors can be registered to support additional ways of delivering secrets to pods
+type ReferenceDetector interface {
+	DetectReferences(podTemplate corev1.PodTemplateSpec, managedSecretName ManagedSecretName) []SecretReferenceMatch
+}
+
+type registeredReferenceDetector struct {
+	detector    ReferenceDetector
+	enabled     bool
+	description string
+}
+
+// Holds the available reference detectors and whether each of them is enabled
+type ReferenceDetectorRegistry struct {
+	detectors map[string]*registeredReferenceDetector
+}
+
+// Creates a registry with all reference detectors shipped with the operator. Only the builtin detector is enabled by default
+func NewReferenceDetectorRegistry() *ReferenceDetectorRegistry {
+	registry := &ReferenceDetectorRegistry{detectors: map[string]*registeredReferenceDetector{}}
+	registry.Register(BUILTIN_REFERENCE_DETECTOR, BuiltinReferenceDetector{}, true, "Detect secrets consumed through env, envFrom and secret volumes.")
+	registry.Register(PROJECTED_REFERENCE_DETECTOR, ProjectedVolumeReferenceDetector{}, false, "Detect secrets consumed through projected volumes.")
+	registry.Register(CSI_REFERENCE_DETECTOR, CSIVolumeReferenceDetector{}, false, "Detect secrets referenced as the node publish secret of CSI volumes.")
+	registry.Register(IMAGE_PULL_SECRET_REFERENCE_DETECTOR, ImagePullSecretReferenceDetector{}, false, "Detect secrets used as image pull secrets.")
+	registry.Register(ANNOTATION_REFERENCE_DETECTOR, AnnotationReferenceDetector{}, false, "Detect secrets listed in the "+USES_SECRETS_ANNOTATION+" pod template annotation.")
+	return registry
+}
+
+// Registers a detector under the given name, replacing any detector previously registered under that name
+func (r *ReferenceDetectorRegistry) Register(name string, detector ReferenceDetector, enabled bool, description string) {
+	r.detectors[name] = &registeredReferenceDetector{detector: detector, enabled: enabled, description: description}
+}
+
+// Returns a pointer to the enabled state of the named detector, so that it can be bound to a flag
+func (r *ReferenceDetectorRegistry) EnabledFlag(name string) *bool {
+	return &r.detectors[name].enabled
+}
+
+func (r *ReferenceDetectorRegistry) Description(name string) string {
+	return r.detectors[name].description
+}
+
+// Names of all registered detectors in alphabetical order
+func (r *ReferenceDetectorRegistry) Names() []string {
+	names := make([]string, 0, len(r.detectors))
+	for name := range r.detectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *ReferenceDetectorRegistry) DetectReferences(podTemplate corev1.PodTemplateSpec, managedSecretName ManagedSecretName) []SecretReferenceMatch {
+	var matches []SecretReferenceMatch
+	for _, name := range r.Names() {
+		registered := r.detectors[name]
+		if !registered.enabled {
+			continue
+		}
+
+		for _, match := range registered.detector.DetectReferences(podTemplate, managedSecretName) {
+			match.Detector = name
+			matches = append(matches, match)
+		}
+	}
+	return matches
+}
+
+// Finds references to the managed secret through env, envFrom and secret volumes.
+// Values composed from other variables with $(VAR) are intentionally not parsed, as the variable they expand is already a reference
+type BuiltinReferenceDetector struct{}
+
+func (BuiltinReferenceDetector) DetectReferences(podTemplate corev1.PodTemplateSpec, managedSecretName ManagedSecretName) []SecretReferenceMatch {
+	var matches []SecretReferenceMatch
+
+	for _, container := range getPodContainers(podTemplate.Spec) {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.SecretRef != nil && managedSecretName.Matches(envFrom.SecretRef.LocalObjectReference.Name) {
+				matches = append(matches, SecretReferenceMatch{Source: REFERENCE_SOURCE_ENV_FROM, Container: container.Name})
+			}
+		}
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil && managedSecretName.Matches(env.ValueFrom.SecretKeyRef.LocalObjectReference.Name) {
+				matches = append(matches, SecretReferenceMatch{Source: REFERENCE_SOURCE_ENV, Container: container.Name, Key: env.ValueFrom.SecretKeyRef.Key, Variable: env.Name})
+			}
+		}
+	}
+
+	for _, volume := range podTemplate.Spec.Volumes {
+		if volume.Secret != nil && managedSecretName.Matches(volume.Secret.SecretName) {
+			matches = append(matches, volumeReferenceMatches(podTemplate.Spec, volume.Name, REFERENCE_SOURCE_VOLUME)...)
+		}
+	}
+
+	return matches
+}
+
+// Finds references to the managed secret through the secret sources of projected volumes
+type ProjectedVolumeReferenceDetector struct{}
+
+func (ProjectedVolumeReferenceDetector) DetectReferences(podTemplate corev1.PodTemplateSpec, managedSecretName ManagedSecretName) []SecretReferenceMatch {
+	var matches []SecretReferenceMatch
+	for _, volume := range podTemplate.Spec.Volumes {
+		if volume.Projected == nil {
+			continue
+		}
+
+		for _, source := range volume.Projected.Sources {
+			if source.Secret != nil && managedSecretName.Matches(source.Secret.LocalObjectReference.Name) {
+				matches = append(matches, volumeReferenceMatches(podTemplate.Spec, volume.Name, REFERENCE_SOURCE_PROJECTED_VOLUME)...)
+			}
+		}
+	}
+	return matches
+}
+
+// Finds CSI volumes which use the managed secret as their node publish secret
+type CSIVolumeReferenceDetector struct{}
+
+func (CSIVolumeReferenceDetector) DetectReferences(podTemplate corev1.PodTemplateSpec, managedSecretName ManagedSecretName) []SecretReferenceMatch {
+	var matches []SecretReferenceMatch
+	for _, volume := range podTemplate.Spec.Volumes {
+		if volume.CSI != nil && volume.CSI.NodePublishSecretRef != nil && managedSecretName.Matches(volume.CSI.NodePublishSecretRef.Name) {
+			matches = append(matches, volumeReferenceMatches(podTemplate.Spec, volume.Name, REFERENCE_SOURCE_CSI_VOLUME)...)
+		}
+	}
+	return matches
+}
+
+// Finds the managed secret in the image pull secrets of the pod
+type ImagePullSecretReferenceDetector struct{}
+
+func (ImagePullSecretReferenceDetector) DetectReferences(podTemplate corev1.PodTemplateSpec, managedSecretName ManagedSecretName) []SecretReferenceMatch {
+	var matches []SecretReferenceMatch
+	for _, imagePullSecret := range podTemplate.Spec.ImagePullSecrets {
+		if managedSecretName.Matches(imagePullSecret.Name) {
+			matches = append(matches, SecretReferenceMatch{Source: REFERENCE_SOURCE_IMAGE_PULL_SECRET})
+		}
+	}
+	return matches
+}
+
+// Finds the managed secret in the comma separated list of the uses-secrets pod template annotation
+type AnnotationReferenceDetector struct{}
+
+func (AnnotationReferenceDetector) DetectReferences(podTemplate corev1.PodTemplateSpec, managedSecretName ManagedSecretName) []SecretReferenceMatch {
+	var matches []SecretReferenceMatch
+	for _, secretName := range strings.Split(podTemplate.Annotations[USES_SECRETS_ANNOTATION], ",") {
+		if managedSecretName.Matches(strings.TrimSpace(secretName)) {
+			matches = append(matches, SecretReferenceMatch{Source: REFERENCE_SOURCE_ANNOTATION})
+		}
+	}
+	return matches
+}
+
+// Returns the containers, init containers and ephemeral containers of the pod, as each of them can consume the managed secret
+func getPodContainers(podSpec corev1.PodSpec) []corev1.Container {
+	containers := append(append([]corev1.Container{}, podSpec.Containers...), podSpec.InitContainers...)
+	for _, ephemeralContainer := range podSpec.EphemeralContainers {
+		containers = append(containers, corev1.Container(ephemeralContainer.EphemeralContainerCommon))
+	}
+	return containers
+}
+
+// Returns a match for every container mounting the volume, or a single pod level match if no container mounts it
+func volumeReferenceMatches(podSpec corev1.PodSpec, volumeName string, source string) []SecretReferenceMatch {
+	var matches []SecretReferenceMatch
+	for _, container := range getPodContainers(podSpec) {
+		for _, volumeMount := range container.VolumeMounts {
+			if volumeMount.Name == volumeName {
+				matches = append(matches, SecretReferenceMatch{Source: source, Container: container.Name})
+				break
+			}
+		}
+	}
+
+	if len(matches) == 0 {
+		matches = append(matches, SecretReferenceMatch{Source: source})
+	}
+	return matches
+}
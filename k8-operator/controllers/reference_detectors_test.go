@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestReferenceDetectorRegistry(t *testing.T) {
+	g := NewWithT(t)
+
+	podTemplate := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{USES_SECRETS_ANNOTATION: "other-secret, managed-secret"},
+		},
+		Spec: corev1.PodSpec{
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "managed-secret"}},
+			Containers:       []corev1.Container{{Name: "api"}},
+		},
+	}
+
+	managedSecretName := ManagedSecretName{Name: "managed-secret"}
+	registry := NewReferenceDetectorRegistry()
+	g.Expect(registry.DetectReferences(podTemplate, managedSecretName)).To(BeEmpty())
+
+	*registry.EnabledFlag(IMAGE_PULL_SECRET_REFERENCE_DETECTOR) = true
+	*registry.EnabledFlag(ANNOTATION_REFERENCE_DETECTOR) = true
+	g.Expect(registry.DetectReferences(podTemplate, managedSecretName)).To(ConsistOf(
+		SecretReferenceMatch{Detector: ANNOTATION_REFERENCE_DETECTOR, Source: REFERENCE_SOURCE_ANNOTATION},
+		SecretReferenceMatch{Detector: IMAGE_PULL_SECRET_REFERENCE_DETECTOR, Source: REFERENCE_SOURCE_IMAGE_PULL_SECRET},
+	))
+}
+
+func TestBuiltinReferenceDetectorVolumes(t *testing.T) {
+	g := NewWithT(t)
+
+	podTemplate := corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{{
+				Name:         "credentials",
+				VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "managed-secret"}},
+			}},
+			Containers: []corev1.Container{
+				{Name: "api", VolumeMounts: []corev1.VolumeMount{{Name: "credentials", MountPath: "/etc/credentials"}}},
+				{Name: "sidecar"},
+			},
+		},
+	}
+
+	matches := BuiltinReferenceDetector{}.DetectReferences(podTemplate, ManagedSecretName{Name: "managed-secret"})
+	g.Expect(matches).To(ConsistOf(SecretReferenceMatch{Source: REFERENCE_SOURCE_VOLUME, Container: "api"}))
+	g.Expect(GetConsumedKeysByContainer(matches)).To(Equal(map[string][]string{"api": {""}}))
+}
+
+func TestBuiltinReferenceDetectorEnvNameCollision(t *testing.T) {
+	g := NewWithT(t)
+
+	envFromKey := func(key string) []corev1.EnvVar {
+		return []corev1.EnvVar{{Name: "API_KEY", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"},
+			Key:                  key,
+		}}}}
+	}
+
+	podTemplate := corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "api", Env: envFromKey("PUBLIC_API_KEY")},
+				{Name: "worker", Env: envFromKey("INTERNAL_API_KEY")},
+			},
+		},
+	}
+
+	matches := BuiltinReferenceDetector{}.DetectReferences(podTemplate, ManagedSecretName{Name: "managed-secret"})
+	g.Expect(matches).To(ConsistOf(
+		SecretReferenceMatch{Source: REFERENCE_SOURCE_ENV, Container: "api", Key: "PUBLIC_API_KEY", Variable: "API_KEY"},
+		SecretReferenceMatch{Source: REFERENCE_SOURCE_ENV, Container: "worker", Key: "INTERNAL_API_KEY", Variable: "API_KEY"},
+	))
+	g.Expect(GetConsumedKeysByContainer(matches)).To(Equal(map[string][]string{
+		"api":    {"PUBLIC_API_KEY"},
+		"worker": {"INTERNAL_API_KEY"},
+	}))
+}
+
+func TestBuiltinReferenceDetectorInitAndEphemeralContainers(t *testing.T) {
+	g := NewWithT(t)
+
+	podTemplate := corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{{
+				Name:         "credentials",
+				VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "managed-secret"}},
+			}},
+			InitContainers: []corev1.Container{{
+				Name: "migrate",
+				Env: []corev1.EnvVar{{Name: "DATABASE_URL", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"},
+					Key:                  "DATABASE_URL",
+				}}}},
+			}},
+			Containers: []corev1.Container{{Name: "api"}},
+			EphemeralContainers: []corev1.EphemeralContainer{{EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+				Name:         "debugger",
+				VolumeMounts: []corev1.VolumeMount{{Name: "credentials", MountPath: "/etc/credentials"}},
+			}}},
+		},
+	}
+
+	g.Expect(BuiltinReferenceDetector{}.DetectReferences(podTemplate, ManagedSecretName{Name: "managed-secret"})).To(ConsistOf(
+		SecretReferenceMatch{Source: REFERENCE_SOURCE_ENV, Container: "migrate", Key: "DATABASE_URL", Variable: "DATABASE_URL"},
+		SecretReferenceMatch{Source: REFERENCE_SOURCE_VOLUME, Container: "debugger"},
+	))
+}
+
+func TestProjectedVolumeWithMixedSources(t *testing.T) {
+	g := NewWithT(t)
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	deployment := &v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "api",
+			Namespace:   "default",
+			Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1"},
+		},
+	}
+	deployment.Spec.Template.Annotations = map[string]string{versionKey: "v1"}
+	deployment.Spec.Template.Spec.Volumes = []corev1.Volume{{
+		Name: "config",
+		VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+			{DownwardAPI: &corev1.DownwardAPIProjection{Items: []corev1.DownwardAPIVolumeFile{{
+				Path:     "labels",
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.labels"},
+			}}}},
+			{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "app-config"}}},
+			{Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "other-secret"}}},
+			{Secret: &corev1.SecretProjection{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"},
+				Items:                []corev1.KeyToPath{{Key: "DB_PASS", Path: "db/password"}},
+			}},
+		}}},
+	}}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{
+		{Name: "api", VolumeMounts: []corev1.VolumeMount{{Name: "config", MountPath: "/etc/config"}}},
+		{Name: "sidecar"},
+	}
+
+	matches := ProjectedVolumeReferenceDetector{}.DetectReferences(deployment.Spec.Template, ManagedSecretName{Name: "managed-secret"})
+	g.Expect(matches).To(Equal([]SecretReferenceMatch{{Source: REFERENCE_SOURCE_PROJECTED_VOLUME, Container: "api"}}))
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	r := newTestReconciler(managedSecret, deployment)
+	r.ReferenceDetectors = NewReferenceDetectorRegistry()
+	*r.ReferenceDetectors.EnabledFlag(PROJECTED_REFERENCE_DETECTOR) = true
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(context.Background(), infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Restarted: 1}))
+
+	restartedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(context.Background(), client.ObjectKeyFromObject(deployment), restartedDeployment)).To(Succeed())
+	g.Expect(restartedDeployment.Spec.Template.Annotations[versionKey]).To(Equal("v2"))
+}
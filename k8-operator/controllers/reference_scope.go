@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+// Checks that the managed secret and the reload namespaces of the InfisicalSecret stay within its own namespace.
+// Without this, anyone allowed to create an InfisicalSecret could overwrite secrets and restart workloads of other tenants.
+// Platform teams can lift the restriction for the whole cluster with the cross namespace reference policy of the operator
+func ValidateReferenceScope(infisicalSecret v1alpha1.InfisicalSecret, allowCrossNamespaceReferences bool) error {
+	if allowCrossNamespaceReferences {
+		return nil
+	}
+
+	if secretNamespace := infisicalSecret.Spec.ManagedSecretReference.SecretNamespace; secretNamespace != infisicalSecret.Namespace {
+		return fmt.Errorf("the managed secret [namespace=%v] differs from the namespace of the InfisicalSecret [namespace=%v] and cross namespace references are not allowed by the operator", secretNamespace, infisicalSecret.Namespace)
+	}
+
+	for _, namespace := range infisicalSecret.Spec.ReloadNamespaces {
+		if namespace != "" && namespace != infisicalSecret.Namespace {
+			return fmt.Errorf("the reload [namespace=%v] differs from the namespace of the InfisicalSecret [namespace=%v] and cross namespace references are not allowed by the operator", namespace, infisicalSecret.Namespace)
+		}
+	}
+
+	return nil
+}
+
+// An empty namespace would make the operator list workloads across all namespaces. Depending on the policy of the operator, the managed secret
+// either defaults to the namespace of the InfisicalSecret, or the InfisicalSecret is refused until the namespace is set
+func ResolveEmptySecretNamespace(infisicalSecret v1alpha1.InfisicalSecret, defaultToOwnNamespace bool) (v1alpha1.InfisicalSecret, error) {
+	if infisicalSecret.Spec.ManagedSecretReference.SecretNamespace != "" {
+		return infisicalSecret, nil
+	}
+
+	if !defaultToOwnNamespace {
+		return infisicalSecret, fmt.Errorf("managedSecretReference.secretNamespace is empty and the operator does not default it to the namespace of the InfisicalSecret [namespace=%v]", infisicalSecret.Namespace)
+	}
+
+	resolved := *infisicalSecret.DeepCopy()
+	resolved.Spec.ManagedSecretReference.SecretNamespace = infisicalSecret.Namespace
+	return resolved, nil
+}
@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestEmptySecretNamespaceNeverListsClusterWide(t *testing.T) {
+	g := NewWithT(t)
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{ObjectMeta: metav1.ObjectMeta{Name: "app-secrets", Namespace: "team-a"}}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+
+	resolved, err := ResolveEmptySecretNamespace(infisicalSecret, true)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(resolved.Spec.ManagedSecretReference.SecretNamespace).To(Equal("team-a"))
+	g.Expect(infisicalSecret.Spec.ManagedSecretReference.SecretNamespace).To(BeEmpty())
+
+	_, err = ResolveEmptySecretNamespace(infisicalSecret, false)
+	g.Expect(err).To(MatchError(ContainSubstring("managedSecretReference.secretNamespace is empty")))
+
+	// an explicit namespace is kept by either policy
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "shared"
+	resolved, err = ResolveEmptySecretNamespace(infisicalSecret, false)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(resolved.Spec.ManagedSecretReference.SecretNamespace).To(Equal("shared"))
+
+	// listing workloads without a namespace is refused even if a blank namespace slips through
+	r := newTestReconciler()
+	_, err = r.ListWorkloads(context.Background(), "")
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// minimum time between two checks of the auto reload annotations of the same namespace. Every InfisicalSecret reloading a namespace
+// lists its workloads, but the check only has to run for one of them, which also keeps the warning from being recorded by each of them
+const MISCONFIGURED_RELOAD_CHECK_INTERVAL = 5 * time.Minute
+
+// Returns the namespaces whose auto reload annotations are due to be checked, and remembers that they were checked
+func (r *InfisicalSecretReconciler) claimReloadAnnotationChecks(namespaces []string, now time.Time) []string {
+	var dueNamespaces []string
+	for _, namespace := range namespaces {
+		if r.reloadAnnotationChecks.allow(namespace, MISCONFIGURED_RELOAD_CHECK_INTERVAL, now) {
+			dueNamespaces = append(dueNamespaces, namespace)
+		}
+	}
+	return dueNamespaces
+}
+
+func filterWorkloadsByNamespace(workloads []Workload, namespaces []string) []Workload {
+	var filtered []Workload
+	for _, workload := range workloads {
+		for _, namespace := range namespaces {
+			if workload.Metadata.Namespace == namespace {
+				filtered = append(filtered, workload)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// Returns the workloads with auto reload enabled that consume the secret of no InfisicalSecret reloading their namespace. Such workloads are
+// never restarted, which usually means the secret reference or the annotation ended up on the wrong workload
+func (r *InfisicalSecretReconciler) GetMisconfiguredReloadWorkloads(ctx context.Context, workloads []Workload) ([]Workload, error) {
+	if len(workloads) == 0 {
+		return nil, nil
+	}
+
+	infisicalSecrets := &v1alpha1.InfisicalSecretList{}
+	if err := r.Client.List(ctx, infisicalSecrets); err != nil {
+		return nil, fmt.Errorf("unable to list InfisicalSecrets to validate auto reload annotations [err=%w]", err)
+	}
+
+	externalSecrets, err := r.listExternalSecrets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var reloadingInfisicalSecrets []reloadingInfisicalSecret
+	for _, infisicalSecret := range infisicalSecrets.Items {
+		if resolved, isReloading := r.resolveReloadingInfisicalSecret(ctx, infisicalSecret, externalSecrets); isReloading {
+			reloadingInfisicalSecrets = append(reloadingInfisicalSecrets, resolved)
+		}
+	}
+
+	var misconfiguredWorkloads []Workload
+	for _, workload := range workloads {
+		if !r.isWorkloadReloadedByAny(workload, reloadingInfisicalSecrets) {
+			misconfiguredWorkloads = append(misconfiguredWorkloads, workload)
+		}
+	}
+	return misconfiguredWorkloads, nil
+}
+
+// An InfisicalSecret resolved the way Reconcile resolves it, together with the namespaces it may reload workloads in
+type reloadingInfisicalSecret struct {
+	infisicalSecret v1alpha1.InfisicalSecret
+	namespaces      []string
+}
+
+// InfisicalSecrets that Reconcile refuses or that are being deleted reload no workloads. The namespaces are not narrowed down to the ones holding
+// an up to date replica of the managed secret, which would take a request per namespace and only hide workloads waiting for their replica
+func (r *InfisicalSecretReconciler) resolveReloadingInfisicalSecret(ctx context.Context, infisicalSecret v1alpha1.InfisicalSecret, externalSecrets []unstructured.Unstructured) (reloadingInfisicalSecret, bool) {
+	if infisicalSecret.GetDeletionTimestamp() != nil {
+		return reloadingInfisicalSecret{}, false
+	}
+
+	resolved, err := ResolveEmptySecretNamespace(infisicalSecret, r.DefaultEmptySecretNamespace)
+	if err != nil {
+		return reloadingInfisicalSecret{}, false
+	}
+
+	resolved, err = r.ApplyNamespaceDefaults(ctx, resolved)
+	if err != nil {
+		return reloadingInfisicalSecret{}, false
+	}
+
+	namespaces := append(GetReloadNamespaces(resolved), r.getFollowedExternalSecretNamespaces(resolved, externalSecrets)...)
+	return reloadingInfisicalSecret{infisicalSecret: resolved, namespaces: namespaces}, true
+}
+
+func (r *InfisicalSecretReconciler) isWorkloadReloadedByAny(workload Workload, reloadingInfisicalSecrets []reloadingInfisicalSecret) bool {
+	for _, reloading := range reloadingInfisicalSecrets {
+		for _, namespace := range reloading.namespaces {
+			if namespace == workload.Metadata.Namespace && r.IsWorkloadUsingManagedSecret(workload, reloading.infisicalSecret) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Records the number of misconfigured workloads of every checked namespace, including the ones without any so that resolved misconfigurations are cleared
+func recordMisconfiguredReloadAnnotations(namespaces []string, misconfiguredWorkloads []Workload) {
+	counts := map[string]int{}
+	for _, workload := range misconfiguredWorkloads {
+		counts[workload.Metadata.Namespace]++
+	}
+
+	for _, namespace := range namespaces {
+		misconfiguredReloadAnnotations.WithLabelValues(namespace).Set(float64(counts[namespace]))
+	}
+}
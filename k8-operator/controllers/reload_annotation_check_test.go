@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestMisconfiguredReloadAnnotationsAreReported(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	newInfisicalSecret := func(name string, managedSecretName string) *secretsv1alpha1.InfisicalSecret {
+		infisicalSecret := &secretsv1alpha1.InfisicalSecret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		infisicalSecret.Spec.ManagedSecretReference.SecretName = managedSecretName
+		infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+		return infisicalSecret
+	}
+	infisicalSecret := newInfisicalSecret("api-secrets", "managed-secret")
+	otherInfisicalSecret := newInfisicalSecret("worker-secrets", "other-secret")
+	// resolved the way Reconcile resolves it, so the empty secret namespace defaults to its own
+	otherInfisicalSecret.Spec.ManagedSecretReference.SecretNamespace = ""
+	// matches its secret case insensitively, through the defaults of its namespace
+	casedInfisicalSecret := newInfisicalSecret("cache-secrets", "Cache-Secret")
+	namespaceDefaults := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: NAMESPACE_DEFAULTS_CONFIGMAP_NAME, Namespace: "default"},
+		Data:       map[string]string{NAMESPACE_DEFAULT_CASE_INSENSITIVE_SECRET_MATCHING: "true"},
+	}
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v1"},
+		},
+	}
+
+	deploymentConsuming := func(name string, secretName string, autoReload bool) *v1.Deployment {
+		deployment := &v1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Annotations: map[string]string{}}}
+		if autoReload {
+			deployment.Annotations[AUTO_RELOAD_DEPLOYMENT_ANNOTATION] = "true"
+		}
+		deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+			Name: name,
+			EnvFrom: []corev1.EnvFromSource{{
+				SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: secretName}},
+			}},
+		}}
+		return deployment
+	}
+	misconfigured := deploymentConsuming("misconfigured", "hand-written-secret", true)
+
+	r := newTestReconciler(
+		infisicalSecret,
+		otherInfisicalSecret,
+		casedInfisicalSecret,
+		namespaceDefaults,
+		managedSecret,
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "other-secret", Namespace: "default", Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v1"}}},
+		deploymentConsuming("api", "managed-secret", true),
+		deploymentConsuming("worker", "other-secret", true),
+		deploymentConsuming("cache", "cache-secret", true),
+		deploymentConsuming("not-reloaded", "hand-written-secret", false),
+		misconfigured,
+	)
+	r.DefaultEmptySecretNamespace = true
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, *infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total.Matched).To(Equal(1))
+
+	drainEvents := func() []string {
+		var events []string
+		for len(r.Recorder.(*record.FakeRecorder).Events) > 0 {
+			events = append(events, <-r.Recorder.(*record.FakeRecorder).Events)
+		}
+		return events
+	}
+
+	// the worker and the cache are reloaded by the other InfisicalSecrets, and workloads without the annotation are not expected to be reloaded
+	g.Expect(drainEvents()).To(ContainElement(And(ContainSubstring("MisconfiguredReloadAnnotation"), HaveSuffix(": Deployment/default/misconfigured"))))
+	g.Expect(testutil.ToFloat64(misconfiguredReloadAnnotations.WithLabelValues("default"))).To(Equal(float64(1)))
+
+	// the namespace was just checked, so the other InfisicalSecrets reloading it do not report the same workloads again
+	_, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, *newInfisicalSecret("worker-secrets", "other-secret"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(drainEvents()).NotTo(ContainElement(ContainSubstring("MisconfiguredReloadAnnotation")))
+
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(misconfigured), misconfigured)).To(Succeed())
+	delete(misconfigured.Annotations, AUTO_RELOAD_DEPLOYMENT_ANNOTATION)
+	g.Expect(r.Client.Update(ctx, misconfigured)).To(Succeed())
+
+	// as if the interval passed since the last check
+	r.reloadAnnotationChecks.lastAllowed["default"] = time.Now().Add(-MISCONFIGURED_RELOAD_CHECK_INTERVAL)
+
+	_, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, *infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(testutil.ToFloat64(misconfiguredReloadAnnotations.WithLabelValues("default"))).To(Equal(float64(0)))
+}
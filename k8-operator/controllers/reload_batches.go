@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const RELOAD_BATCH_PHASE_IN_PROGRESS = "InProgress"
+const RELOAD_BATCH_PHASE_COMPLETE = "Complete"
+const RELOAD_BATCH_PHASE_ABORTED = "Aborted"
+
+const DEFAULT_RELOAD_BATCH_HEALTH_TIMEOUT = 10 * time.Minute
+
+func getReloadBatchHealthTimeout(infisicalSecret v1alpha1.InfisicalSecret) time.Duration {
+	if infisicalSecret.Spec.ReloadBatchHealthTimeoutSeconds > 0 {
+		return time.Duration(infisicalSecret.Spec.ReloadBatchHealthTimeoutSeconds) * time.Second
+	}
+	return DEFAULT_RELOAD_BATCH_HEALTH_TIMEOUT
+}
+
+// Continues the batches of the current secret version from the status and returns how many workloads may be restarted in this reconcile.
+// A new batch may only start once every workload of the previous batch finished rolling out the new version, or once the health timeout passed without aborting
+func (r *InfisicalSecretReconciler) GetReloadBatchSlots(ctx context.Context, infisicalSecret v1alpha1.InfisicalSecret, matchedWorkloads []Workload, annotationKey string, secretVersion string, now time.Time) (*v1alpha1.ReloadBatchStatus, int) {
+	batchSize := infisicalSecret.Spec.ReloadBatchSize
+
+	previous := infisicalSecret.Status.ReloadBatches
+	if previous == nil || previous.SecretVersion != secretVersion {
+		return &v1alpha1.ReloadBatchStatus{SecretVersion: secretVersion, Phase: RELOAD_BATCH_PHASE_IN_PROGRESS}, batchSize
+	}
+
+	batch := previous.DeepCopy()
+	if batch.Phase == RELOAD_BATCH_PHASE_ABORTED {
+		return batch, 0
+	}
+
+	unhealthyWorkloads := r.getUnhealthyBatchWorkloads(ctx, infisicalSecret, batch.Workloads, matchedWorkloads, annotationKey, secretVersion)
+	if len(unhealthyWorkloads) == 0 {
+		return batch, batchSize
+	}
+
+	healthTimeout := getReloadBatchHealthTimeout(infisicalSecret)
+	if batch.StartedAt != nil && now.Sub(batch.StartedAt.Time) < healthTimeout {
+		fmt.Printf("waiting for batch [batch=%v] to finish rolling out [workloads=%v] before restarting the next batch\n", batch.CurrentBatch, unhealthyWorkloads)
+		return batch, 0
+	}
+
+	if infisicalSecret.Spec.AbortOnUnhealthyBatch {
+		batch.Phase = RELOAD_BATCH_PHASE_ABORTED
+		r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeWarning, "ReloadBatchAborted", "Batch %v of %v did not become healthy within %v: %v. The remaining batches for secret version %v are not restarted", batch.CurrentBatch, batch.TotalBatches, healthTimeout, unhealthyWorkloads, secretVersion)
+		return batch, 0
+	}
+
+	fmt.Printf("batch [batch=%v] did not become healthy within [timeout=%v]. Restarting the next batch regardless [unhealthy=%v]\n", batch.CurrentBatch, healthTimeout, unhealthyWorkloads)
+	return batch, batchSize
+}
+
+// Workloads of the batch whose restart for the secret version failed or did not finish rolling out yet. Workloads that no longer consume the secret are ignored
+func (r *InfisicalSecretReconciler) getUnhealthyBatchWorkloads(ctx context.Context, infisicalSecret v1alpha1.InfisicalSecret, batchWorkloads []string, matchedWorkloads []Workload, annotationKey string, secretVersion string) []string {
+	inBatch := map[string]bool{}
+	for _, workloadRef := range batchWorkloads {
+		inBatch[workloadRef] = true
+	}
+
+	var unhealthy []string
+	for _, workload := range matchedWorkloads {
+		if !inBatch[workload.Ref()] {
+			continue
+		}
+
+		// the batch only holds workloads that were restarted or failed to restart, so a workload without the version failed and is retried
+		if getRestartedVersion(workload, infisicalSecret, annotationKey) != secretVersion {
+			unhealthy = append(unhealthy, workload.Ref())
+			continue
+		}
+
+		settled, err := r.isWorkloadSettled(ctx, workload, infisicalSecret, annotationKey, secretVersion)
+		if err != nil {
+			fmt.Printf("unable to check rollout of [workload=%v] in the current batch [err=%v]\n", workload.Ref(), err)
+		}
+
+		if !settled {
+			unhealthy = append(unhealthy, workload.Ref())
+		}
+	}
+	return unhealthy
+}
+
+// Members of the current batch are restarted until their restart succeeds, without taking the slots of the next batch
+func isReloadBatchMember(batch *v1alpha1.ReloadBatchStatus, workload Workload) bool {
+	if batch.Phase != RELOAD_BATCH_PHASE_IN_PROGRESS {
+		return false
+	}
+	for _, workloadRef := range batch.Workloads {
+		if workloadRef == workload.Ref() {
+			return true
+		}
+	}
+	return false
+}
+
+// Removes the workload from the batch workloads, so that a workload whose restart was skipped does not count against the batch size. Returns whether it was a member
+func removeReloadBatchWorkload(workloads []string, workloadRef string) ([]string, bool) {
+	for i, batchWorkloadRef := range workloads {
+		if batchWorkloadRef == workloadRef {
+			return append(workloads[:i:i], workloads[i+1:]...), true
+		}
+	}
+	return workloads, false
+}
+
+// Records the batch restarted in this reconcile and the batches still needed for the workloads that are waiting
+func recordReloadBatch(batch *v1alpha1.ReloadBatchStatus, restartedWorkloads []string, waitingWorkloads int, batchSize int, slots int, now time.Time) {
+	if len(restartedWorkloads) > 0 {
+		batch.CurrentBatch++
+		batch.Workloads = restartedWorkloads
+		batch.StartedAt = &metav1.Time{Time: now}
+	}
+
+	batch.TotalBatches = batch.CurrentBatch + (waitingWorkloads+batchSize-1)/batchSize
+
+	if batch.Phase == RELOAD_BATCH_PHASE_ABORTED {
+		return
+	}
+
+	// the latest batch is healthy once slots were granted, so nothing is left to do when no workload restarted or waits
+	if len(restartedWorkloads) == 0 && waitingWorkloads == 0 && slots > 0 {
+		batch.Phase = RELOAD_BATCH_PHASE_COMPLETE
+	} else {
+		batch.Phase = RELOAD_BATCH_PHASE_IN_PROGRESS
+	}
+}
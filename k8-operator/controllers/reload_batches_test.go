@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func newBatchTestStatefulSet(name string, versionKey string) *v1.StatefulSet {
+	statefulSet := &v1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "default",
+			Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1"},
+		},
+	}
+	statefulSet.Spec.Template.Annotations = map[string]string{versionKey: "v1"}
+	statefulSet.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "app",
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+		}},
+	}}
+	return statefulSet
+}
+
+func TestWorkloadsAreRestartedInHealthyBatches(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	r := newTestReconciler(managedSecret, newBatchTestStatefulSet("api", versionKey), newBatchTestStatefulSet("cache", versionKey), newBatchTestStatefulSet("worker", versionKey))
+
+	markRolledOut := func(names ...string) {
+		for _, name := range names {
+			statefulSet := &v1.StatefulSet{}
+			g.Expect(r.Client.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, statefulSet)).To(Succeed())
+			statefulSet.Status = v1.StatefulSetStatus{CurrentRevision: "2", UpdateRevision: "2", UpdatedReplicas: 1, AvailableReplicas: 1}
+			g.Expect(r.Client.Update(ctx, statefulSet)).To(Succeed())
+		}
+	}
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+	infisicalSecret.Spec.ReloadBatchSize = 2
+
+	reconcile := func() ReconcileOutcome {
+		outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+		g.Expect(err).NotTo(HaveOccurred())
+		infisicalSecret.Status.ReloadBatches = outcome.ReloadBatches
+		return outcome
+	}
+
+	outcome := reconcile()
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 3, Restarted: 2, Deferred: 1}))
+	g.Expect(outcome.ReloadBatches.Phase).To(Equal(RELOAD_BATCH_PHASE_IN_PROGRESS))
+	g.Expect(outcome.ReloadBatches.CurrentBatch).To(Equal(1))
+	g.Expect(outcome.ReloadBatches.TotalBatches).To(Equal(2))
+	g.Expect(outcome.ReloadBatches.Workloads).To(Equal([]string{"StatefulSet/default/api", "StatefulSet/default/cache"}))
+
+	// the first batch is still rolling out
+	markRolledOut("api")
+	outcome = reconcile()
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 3, Deferred: 1}))
+	g.Expect(outcome.ReloadBatches.CurrentBatch).To(Equal(1))
+
+	markRolledOut("cache")
+	outcome = reconcile()
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 3, Restarted: 1}))
+	g.Expect(outcome.ReloadBatches.CurrentBatch).To(Equal(2))
+	g.Expect(outcome.ReloadBatches.TotalBatches).To(Equal(2))
+	g.Expect(outcome.ReloadBatches.Workloads).To(Equal([]string{"StatefulSet/default/worker"}))
+
+	markRolledOut("worker")
+	outcome = reconcile()
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 3}))
+	g.Expect(outcome.ReloadBatches.Phase).To(Equal(RELOAD_BATCH_PHASE_COMPLETE))
+}
+
+func TestUnhealthyBatchAbortsRemainingBatches(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	r := newTestReconciler(managedSecret, newBatchTestStatefulSet("api", versionKey), newBatchTestStatefulSet("worker", versionKey))
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+	infisicalSecret.Spec.ReloadBatchSize = 1
+	infisicalSecret.Spec.ReloadBatchHealthTimeoutSeconds = 60
+	infisicalSecret.Spec.AbortOnUnhealthyBatch = true
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 2, Restarted: 1, Deferred: 1}))
+
+	// the first batch never becomes healthy
+	infisicalSecret.Status.ReloadBatches = outcome.ReloadBatches
+	infisicalSecret.Status.ReloadBatches.StartedAt = &metav1.Time{Time: time.Now().Add(-2 * time.Minute)}
+
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 2, Deferred: 1}))
+	g.Expect(outcome.ReloadBatches.Phase).To(Equal(RELOAD_BATCH_PHASE_ABORTED))
+	g.Expect(outcome.ReloadBatches.CurrentBatch).To(Equal(1))
+}
+
+// Fails the first updates of the named workload, like when an admission webhook rejects its restart
+type failingWorkloadUpdateClient struct {
+	client.Client
+	workloadName string
+	failures     int
+}
+
+func (c *failingWorkloadUpdateClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if obj.GetName() == c.workloadName && c.failures > 0 {
+		c.failures--
+		return fmt.Errorf("admission webhook denied the request")
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func TestFailedBatchRestartHoldsTheNextBatch(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	r := newTestReconciler(managedSecret, newBatchTestStatefulSet("api", versionKey), newBatchTestStatefulSet("worker", versionKey))
+	r.Client = &failingWorkloadUpdateClient{Client: r.Client, workloadName: "api", failures: 1}
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+	infisicalSecret.Spec.ReloadBatchSize = 1
+
+	reconcile := func() ReconcileOutcome {
+		outcome, _ := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+		infisicalSecret.Status.ReloadBatches = outcome.ReloadBatches
+		return outcome
+	}
+
+	outcome := reconcile()
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 2, Failed: 1, Deferred: 1}))
+	g.Expect(outcome.ReloadBatches.Workloads).To(Equal([]string{"StatefulSet/default/api"}))
+
+	// the failed workload is retried within its batch instead of the next batch starting
+	outcome = reconcile()
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 2, Restarted: 1, Deferred: 1}))
+	g.Expect(outcome.ReloadBatches.CurrentBatch).To(Equal(1))
+	g.Expect(outcome.ReloadBatches.Workloads).To(Equal([]string{"StatefulSet/default/api"}))
+
+	worker := &v1.StatefulSet{}
+	g.Expect(r.Client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "worker"}, worker)).To(Succeed())
+	g.Expect(worker.Spec.Template.Annotations[versionKey]).To(Equal("v1"))
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Returns the namespace of the managed secret followed by the additional reload namespaces of the InfisicalSecret, without duplicates
+func GetReloadNamespaces(infisicalSecret v1alpha1.InfisicalSecret) []string {
+	namespaces := []string{infisicalSecret.Spec.ManagedSecretReference.SecretNamespace}
+	seen := map[string]bool{infisicalSecret.Spec.ManagedSecretReference.SecretNamespace: true}
+
+	for _, namespace := range infisicalSecret.Spec.ReloadNamespaces {
+		if namespace != "" && !seen[namespace] {
+			seen[namespace] = true
+			namespaces = append(namespaces, namespace)
+		}
+	}
+
+	return namespaces
+}
+
+// Workloads can only consume secrets of their own namespace, so a workload in another namespace referencing the managed secret's name
+// consumes a secret of that namespace. That secret is only treated as the managed secret when it holds exactly the same data, which
+// rules out unrelated secrets that happen to share the name, and replicas that have not caught up with the latest rotation yet
+func (r *InfisicalSecretReconciler) IsManagedSecretReplicatedTo(ctx context.Context, namespace string, managedKubeSecret corev1.Secret) (bool, error) {
+	if namespace == managedKubeSecret.Namespace {
+		return true, nil
+	}
+
+	replicaSecret := &corev1.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: managedKubeSecret.Name}, replicaSecret)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("unable to fetch replica of the managed secret in [namespace=%v] [err=%w]", namespace, err)
+	}
+
+	return hasSameSecretData(*replicaSecret, managedKubeSecret), nil
+}
+
+func hasSameSecretData(secret corev1.Secret, otherSecret corev1.Secret) bool {
+	if len(secret.Data) != len(otherSecret.Data) {
+		return false
+	}
+
+	for key, value := range secret.Data {
+		otherValue, exists := otherSecret.Data[key]
+		if !exists || !bytes.Equal(value, otherValue) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the reload namespaces, and the namespaces of followed ExternalSecrets, which hold the managed secret or a replica of it
+func (r *InfisicalSecretReconciler) GetReplicatedReloadNamespaces(ctx context.Context, infisicalSecret v1alpha1.InfisicalSecret, managedKubeSecret corev1.Secret) ([]string, error) {
+	candidateNamespaces := GetReloadNamespaces(infisicalSecret)
+
+	externalSecretNamespaces, err := r.GetExternalSecretNamespaces(ctx, infisicalSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for _, namespace := range candidateNamespaces {
+		seen[namespace] = true
+	}
+	for _, namespace := range externalSecretNamespaces {
+		if !seen[namespace] {
+			seen[namespace] = true
+			candidateNamespaces = append(candidateNamespaces, namespace)
+		}
+	}
+
+	var namespaces []string
+	for _, namespace := range candidateNamespaces {
+		replicated, err := r.IsManagedSecretReplicatedTo(ctx, namespace, managedKubeSecret)
+		if err != nil {
+			return nil, err
+		}
+
+		if !replicated {
+			fmt.Printf("skipping workloads in [namespace=%v] because it holds no up to date replica of the managed secret [name=%v]\n", namespace, managedKubeSecret.Name)
+			continue
+		}
+		namespaces = append(namespaces, namespace)
+	}
+
+	return namespaces, nil
+}
+
+// Lists the workloads of every reload namespace which holds the managed secret or a replica of it
+func (r *InfisicalSecretReconciler) ListReloadableWorkloads(ctx context.Context, namespaces []string) ([]Workload, error) {
+	var workloads []Workload
+	for _, namespace := range namespaces {
+		namespaceWorkloads, err := r.ListWorkloads(ctx, namespace)
+		if err != nil {
+			return nil, err
+		}
+		workloads = append(workloads, namespaceWorkloads...)
+	}
+
+	return workloads, nil
+}
@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestReloadNamespacesIgnoreUnrelatedSecretsWithTheSameName(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+
+	secretInNamespace := func(namespace string, password string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "managed-secret",
+				Namespace:   namespace,
+				Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+			},
+			Data: map[string][]byte{"DB_PASSWORD": []byte(password)},
+		}
+	}
+
+	deploymentInNamespace := func(namespace string) *v1.Deployment {
+		deployment := &v1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "api",
+				Namespace:   namespace,
+				Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1"},
+			},
+		}
+		deployment.Spec.Template.Annotations = map[string]string{versionKey: "v1"}
+		deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+			Name: "api",
+			EnvFrom: []corev1.EnvFromSource{{
+				SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+			}},
+		}}
+		return deployment
+	}
+
+	r := newTestReconciler(
+		secretInNamespace("default", "rotated-password"),
+		deploymentInNamespace("default"),
+		// an unrelated secret which only shares the name of the managed secret
+		secretInNamespace("unrelated", "someone-elses-password"),
+		deploymentInNamespace("unrelated"),
+		secretInNamespace("replicated", "rotated-password"),
+		deploymentInNamespace("replicated"),
+		// no secret of that name at all, so the workload cannot be consuming the managed secret
+		deploymentInNamespace("missing"),
+	)
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+	infisicalSecret.Spec.ReloadNamespaces = []string{"unrelated", "replicated", "missing", "default"}
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 2, Restarted: 2}))
+
+	expectedVersions := map[string]string{"default": "v2", "replicated": "v2", "unrelated": "v1", "missing": "v1"}
+	for namespace, expectedVersion := range expectedVersions {
+		deployment := &v1.Deployment{}
+		g.Expect(r.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "api"}, deployment)).To(Succeed())
+		g.Expect(deployment.Spec.Template.Annotations[versionKey]).To(Equal(expectedVersion), namespace)
+	}
+
+	// a workload restarted for a secret of the same name and version in its own namespace is not waited for
+	unrelatedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, types.NamespacedName{Namespace: "unrelated", Name: "api"}, unrelatedDeployment)).To(Succeed())
+	unrelatedDeployment.Spec.Template.Annotations[versionKey] = "v2"
+	g.Expect(r.Client.Update(ctx, unrelatedDeployment)).To(Succeed())
+
+	pendingRollouts, err := r.GetPendingWorkloadRollouts(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(pendingRollouts).To(ConsistOf("Deployment/replicated/api", "Deployment/default/api"))
+}
+
+func TestFollowExternalSecretsSyncingTheManagedSecret(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+		Data: map[string][]byte{"DB_PASS": []byte("rotated-password")},
+	}
+
+	// the same secret synced by the External Secrets Operator into a namespace that has not migrated yet
+	syncedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "managed-secret", Namespace: "legacy"},
+		Data:       map[string][]byte{"DB_PASS": []byte("rotated-password")},
+	}
+
+	externalSecret := &unstructured.Unstructured{}
+	externalSecret.SetAPIVersion("external-secrets.io/v1beta1")
+	externalSecret.SetKind("ExternalSecret")
+	externalSecret.SetName("database")
+	externalSecret.SetNamespace("legacy")
+	g.Expect(unstructured.SetNestedField(externalSecret.Object, "managed-secret", "spec", "target", "name")).To(Succeed())
+
+	deployment := &v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "api",
+			Namespace:   "legacy",
+			Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1"},
+		},
+	}
+	deployment.Spec.Template.Annotations = map[string]string{versionKey: "v1"}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "api",
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+		}},
+	}}
+
+	r := newTestReconciler(managedSecret, syncedSecret, externalSecret, deployment)
+	r.AllowCrossNamespaceReferences = true
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{ObjectMeta: metav1.ObjectMeta{Name: "app-secrets", Namespace: "default"}}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{}))
+
+	r.FollowExternalSecrets = true
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Restarted: 1}))
+
+	restartedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, types.NamespacedName{Namespace: "legacy", Name: "api"}, restartedDeployment)).To(Succeed())
+	g.Expect(restartedDeployment.Spec.Template.Annotations[versionKey]).To(Equal("v2"))
+}
+
+func TestFollowExternalSecretsRequiresCrossNamespaceReferences(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	externalSecret := &unstructured.Unstructured{}
+	externalSecret.SetAPIVersion("external-secrets.io/v1beta1")
+	externalSecret.SetKind("ExternalSecret")
+	externalSecret.SetName("managed-secret")
+	externalSecret.SetNamespace("legacy")
+
+	r := newTestReconciler(externalSecret)
+	r.FollowExternalSecrets = true
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{ObjectMeta: metav1.ObjectMeta{Name: "app-secrets", Namespace: "default"}}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	// under the default policy the managed secret lives in the InfisicalSecret's namespace, which is never followed
+	namespaces, err := r.GetExternalSecretNamespaces(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(namespaces).To(BeEmpty())
+
+	r.AllowCrossNamespaceReferences = true
+	namespaces, err = r.GetExternalSecretNamespaces(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(namespaces).To(Equal([]string{"legacy"}))
+}
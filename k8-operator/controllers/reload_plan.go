@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const RELOAD_PLAN_LABEL = "secrets.infisical.com/reload-plan"
+const RELOAD_PLAN_APPROVED_ANNOTATION = "secrets.infisical.com/reload-plan-approved" // needs to be set to true by a reviewer for the operator to execute the plan
+const RELOAD_PLAN_DATA_KEY = "plan.json"
+
+// The restarts the operator would perform for a rotation of the managed secret, written to a ConfigMap for review
+type ReloadPlan struct {
+	InfisicalSecret string          `json:"infisicalSecret"`
+	SecretVersion   string          `json:"secretVersion"`
+	Workloads       []PlannedReload `json:"workloads"`
+}
+
+type PlannedReload struct {
+	Workload string `json:"workload"`
+	Reason   string `json:"reason"`
+}
+
+// Checks if the plan includes restarting the workload
+func (p ReloadPlan) Contains(workloadRef string) bool {
+	for _, plannedReload := range p.Workloads {
+		if plannedReload.Workload == workloadRef {
+			return true
+		}
+	}
+	return false
+}
+
+// Plans are named after the InfisicalSecret and the secret version, so that every rotation gets its own plan
+func GetReloadPlanName(infisicalSecret v1alpha1.InfisicalSecret, secretVersion string) string {
+	versionHash := sha256.Sum256([]byte(secretVersion))
+	return fmt.Sprintf("%s-reload-plan-%s", infisicalSecret.Name, hex.EncodeToString(versionHash[:])[:10])
+}
+
+// Returns the plan for the current version of the managed secret, if one was written, and whether a reviewer approved it
+func (r *InfisicalSecretReconciler) GetReloadPlan(ctx context.Context, infisicalSecret v1alpha1.InfisicalSecret, secret corev1.Secret) (*ReloadPlan, bool, error) {
+	planConfigMap := &corev1.ConfigMap{}
+	err := r.Client.Get(ctx, types.NamespacedName{Namespace: infisicalSecret.Namespace, Name: GetReloadPlanName(infisicalSecret, secret.Annotations[SECRET_VERSION_ANNOTATION])}, planConfigMap)
+	if errors.IsNotFound(err) {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to fetch reload plan [err=%w]", err)
+	}
+
+	plan := &ReloadPlan{}
+	if err := json.Unmarshal([]byte(planConfigMap.Data[RELOAD_PLAN_DATA_KEY]), plan); err != nil {
+		return nil, false, fmt.Errorf("unable to parse reload plan [configMap=%v] [err=%w]", planConfigMap.Name, err)
+	}
+
+	return plan, planConfigMap.Annotations[RELOAD_PLAN_APPROVED_ANNOTATION] == "true", nil
+}
+
+// Writes the plan for the current version of the managed secret and removes the plans of earlier versions, which can no longer be executed, whether
+// they were approved or not. An approved plan is never rewritten, so the operator executes exactly what was reviewed
+func (r *InfisicalSecretReconciler) WriteReloadPlan(ctx context.Context, infisicalSecret v1alpha1.InfisicalSecret, plan ReloadPlan) error {
+	planJSON, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to serialize reload plan [err=%w]", err)
+	}
+
+	planName := GetReloadPlanName(infisicalSecret, plan.SecretVersion)
+
+	labels := GetManagedByLabels(infisicalSecret)
+	labels[RELOAD_PLAN_LABEL] = "true"
+
+	listOfPlans := &corev1.ConfigMapList{}
+	err = r.Client.List(ctx, listOfPlans, client.InNamespace(infisicalSecret.Namespace), client.MatchingLabels(labels))
+	if err != nil {
+		return fmt.Errorf("unable to list reload plans [err=%w]", err)
+	}
+
+	var existingPlan *corev1.ConfigMap
+	for i := range listOfPlans.Items {
+		planConfigMap := &listOfPlans.Items[i]
+		if !strings.HasPrefix(planConfigMap.Name, infisicalSecret.Name+"-reload-plan-") {
+			continue
+		}
+
+		if planConfigMap.Name == planName {
+			existingPlan = planConfigMap
+			continue
+		}
+
+		if err := r.Client.Delete(ctx, planConfigMap); err != nil && !errors.IsNotFound(err) {
+			fmt.Printf("unable to delete outdated reload [plan=%v] [err=%v]\n", planConfigMap.Name, err)
+		}
+	}
+
+	if existingPlan == nil {
+		planConfigMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        planName,
+				Namespace:   infisicalSecret.Namespace,
+				Labels:      labels,
+				Annotations: map[string]string{SECRET_VERSION_ANNOTATION: plan.SecretVersion},
+			},
+			Data: map[string]string{RELOAD_PLAN_DATA_KEY: string(planJSON)},
+		}
+
+		// the plan is garbage collected together with the InfisicalSecret
+		if err := ctrl.SetControllerReference(&infisicalSecret, planConfigMap, r.Scheme); err != nil {
+			return fmt.Errorf("unable to set the owner of reload [plan=%v] [err=%w]", planName, err)
+		}
+
+		if err := r.Client.Create(ctx, planConfigMap); err != nil {
+			return fmt.Errorf("unable to create reload plan [err=%w]", err)
+		}
+		return nil
+	}
+
+	if existingPlan.Annotations[RELOAD_PLAN_APPROVED_ANNOTATION] == "true" || existingPlan.Data[RELOAD_PLAN_DATA_KEY] == string(planJSON) {
+		return nil
+	}
+
+	existingPlan.Data = map[string]string{RELOAD_PLAN_DATA_KEY: string(planJSON)}
+	if err := r.Client.Update(ctx, existingPlan); err != nil {
+		return fmt.Errorf("unable to update reload plan [err=%w]", err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestApprovedReloadPlanIsExecutedExactly(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	outdatedDeployment := func(name string) *v1.Deployment {
+		deployment := &v1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1"},
+			},
+		}
+		deployment.Spec.Template.Annotations = map[string]string{versionKey: "v1"}
+		deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+			Name: "app",
+			EnvFrom: []corev1.EnvFromSource{{
+				SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+			}},
+		}}
+		return deployment
+	}
+
+	templateVersion := func(r *InfisicalSecretReconciler, name string) string {
+		deployment := &v1.Deployment{}
+		g.Expect(r.Client.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, deployment)).To(Succeed())
+		return deployment.Spec.Template.Annotations[versionKey]
+	}
+
+	r := newTestReconciler(managedSecret, outdatedDeployment("api"), outdatedDeployment("worker"))
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{ObjectMeta: metav1.ObjectMeta{Name: "app-secrets", Namespace: "default"}}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+	infisicalSecret.Spec.RequireReloadApproval = true
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 2, Deferred: 2}))
+	g.Expect(templateVersion(r, "api")).To(Equal("v1"))
+
+	planConfigMap := &corev1.ConfigMap{}
+	g.Expect(r.Client.Get(ctx, types.NamespacedName{Namespace: "default", Name: GetReloadPlanName(infisicalSecret, "v2")}, planConfigMap)).To(Succeed())
+
+	plan := ReloadPlan{}
+	g.Expect(json.Unmarshal([]byte(planConfigMap.Data[RELOAD_PLAN_DATA_KEY]), &plan)).To(Succeed())
+	g.Expect(plan).To(Equal(ReloadPlan{
+		InfisicalSecret: "default/app-secrets",
+		SecretVersion:   "v2",
+		Workloads: []PlannedReload{
+			{Workload: "Deployment/default/api", Reason: RELOAD_REASON_DATA_CHANGED},
+			{Workload: "Deployment/default/worker", Reason: RELOAD_REASON_DATA_CHANGED},
+		},
+	}))
+
+	planConfigMap.Annotations[RELOAD_PLAN_APPROVED_ANNOTATION] = "true"
+	g.Expect(r.Client.Update(ctx, planConfigMap)).To(Succeed())
+
+	// a workload showing up after the plan was reviewed is not restarted as part of it
+	g.Expect(r.Client.Create(ctx, outdatedDeployment("cron"))).To(Succeed())
+
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 3, Restarted: 2, Skipped: 1}))
+	g.Expect(templateVersion(r, "api")).To(Equal("v2"))
+	g.Expect(templateVersion(r, "worker")).To(Equal("v2"))
+	g.Expect(templateVersion(r, "cron")).To(Equal("v1"))
+
+	// the next rotation supersedes the approved plan, which is removed once the new plan is written
+	managedSecret.Annotations[SECRET_VERSION_ANNOTATION] = "v3"
+	g.Expect(r.Client.Update(ctx, managedSecret)).To(Succeed())
+
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 3, Deferred: 3}))
+
+	plans := &corev1.ConfigMapList{}
+	g.Expect(r.Client.List(ctx, plans, client.InNamespace("default"))).To(Succeed())
+	g.Expect(plans.Items).To(HaveLen(1))
+	g.Expect(plans.Items[0].Name).To(Equal(GetReloadPlanName(infisicalSecret, "v3")))
+	g.Expect(plans.Items[0].OwnerReferences).To(HaveLen(1))
+	g.Expect(plans.Items[0].OwnerReferences[0].Name).To(Equal("app-secrets"))
+}
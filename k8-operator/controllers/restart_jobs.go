@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const RESTART_JOB_PHASE_PENDING = "Pending"
+const RESTART_JOB_PHASE_RUNNING = "Running"
+const RESTART_JOB_PHASE_SUCCEEDED = "Succeeded"
+const RESTART_JOB_PHASE_FAILED = "Failed"
+
+const RESTART_JOB_STAGE_PRE = "pre-restart"
+const RESTART_JOB_STAGE_POST = "post-restart"
+
+const DEFAULT_RESTART_JOB_TIMEOUT_SECONDS = int64(600)
+
+// The Job controller labels the pods of a Job with its name, so Job names may not be longer than a label value
+const MAX_RESTART_JOB_NAME_LENGTH = validation.LabelValueMaxLength
+
+// Returns an error when the InfisicalSecret defines restart Jobs although the operator does not run them, so its restarts are not performed without them
+func (r *InfisicalSecretReconciler) ValidateRestartJobs(infisicalSecret v1alpha1.InfisicalSecret) error {
+	if infisicalSecret.Spec.PreRestartJob == nil && infisicalSecret.Spec.PostRestartJob == nil {
+		return nil
+	}
+	if !r.EnableRestartJobs {
+		return fmt.Errorf("the InfisicalSecret defines restart Jobs, but the operator was not started with --enable-restart-jobs. No workloads are restarted until the flag is set or the Jobs are removed")
+	}
+
+	for _, stage := range []string{RESTART_JOB_STAGE_PRE, RESTART_JOB_STAGE_POST} {
+		jobName := GetRestartJobName(infisicalSecret, stage, "")
+		if errs := validation.IsValidLabelValue(jobName); len(errs) > 0 {
+			return fmt.Errorf("the %s Job name %s of the InfisicalSecret is invalid [err=%s]", stage, jobName, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// Jobs are named after the InfisicalSecret, the stage and the secret version, so that every rotation runs its own Job exactly once.
+// Names that would be too long keep a prefix of the InfisicalSecret name followed by a hash of the full name
+func GetRestartJobName(infisicalSecret v1alpha1.InfisicalSecret, stage string, secretVersion string) string {
+	versionHash := sha256.Sum256([]byte(secretVersion))
+	suffix := fmt.Sprintf("-%s-%s", stage, hex.EncodeToString(versionHash[:])[:10])
+	if len(infisicalSecret.Name)+len(suffix) <= MAX_RESTART_JOB_NAME_LENGTH {
+		return infisicalSecret.Name + suffix
+	}
+
+	nameHash := sha256.Sum256([]byte(infisicalSecret.Name))
+	shortenedName := hex.EncodeToString(nameHash[:])[:10]
+	prefix := strings.TrimRight(infisicalSecret.Name[:MAX_RESTART_JOB_NAME_LENGTH-len(suffix)-len(shortenedName)-1], "-.")
+	return fmt.Sprintf("%s-%s%s", prefix, shortenedName, suffix)
+}
+
+func isRestartJobFinished(jobStatus *v1alpha1.RestartJobStatus) bool {
+	return jobStatus.Phase == RESTART_JOB_PHASE_SUCCEEDED || jobStatus.Phase == RESTART_JOB_PHASE_FAILED
+}
+
+// Creates the Job of the stage for the secret version unless it exists already, and returns its progress.
+// A finished Job is taken from the previous status, so Jobs removed after finishing (e.g. through ttlSecondsAfterFinished) are not run again
+func (r *InfisicalSecretReconciler) RunRestartJob(ctx context.Context, infisicalSecret v1alpha1.InfisicalSecret, restartJob v1alpha1.RestartJob, previous *v1alpha1.RestartJobStatus, stage string, secretVersion string) (*v1alpha1.RestartJobStatus, error) {
+	if previous != nil && previous.SecretVersion == secretVersion && isRestartJobFinished(previous) {
+		return previous, nil
+	}
+
+	jobName := GetRestartJobName(infisicalSecret, stage, secretVersion)
+	jobStatus := &v1alpha1.RestartJobStatus{SecretVersion: secretVersion, JobName: jobName, Phase: RESTART_JOB_PHASE_RUNNING}
+
+	job := &batchv1.Job{}
+	err := r.Client.Get(ctx, types.NamespacedName{Namespace: infisicalSecret.Namespace, Name: jobName}, job)
+	if errors.IsNotFound(err) {
+		job = newRestartJob(infisicalSecret, restartJob, jobName, secretVersion)
+		// the Job is garbage collected together with the InfisicalSecret
+		if err := ctrl.SetControllerReference(&infisicalSecret, job, r.Scheme); err != nil {
+			return nil, fmt.Errorf("unable to set the owner of %s [job=%v] [err=%w]", stage, jobName, err)
+		}
+
+		if err := r.Client.Create(ctx, job); err != nil {
+			return nil, fmt.Errorf("unable to create %s [job=%v] [err=%w]", stage, jobName, err)
+		}
+
+		fmt.Printf("created %s [job=%v] for secret [version=%v]\n", stage, jobName, secretVersion)
+		r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeNormal, "RestartJobCreated", "Created %s Job %v for secret version %v", stage, jobName, secretVersion)
+		return jobStatus, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch %s [job=%v] [err=%w]", stage, jobName, err)
+	}
+
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+
+		switch condition.Type {
+		case batchv1.JobComplete:
+			jobStatus.Phase = RESTART_JOB_PHASE_SUCCEEDED
+		case batchv1.JobFailed:
+			jobStatus.Phase = RESTART_JOB_PHASE_FAILED
+			jobStatus.Message = fmt.Sprintf("%s: %s", condition.Reason, condition.Message)
+		}
+	}
+
+	if isRestartJobFinished(jobStatus) && (previous == nil || !isRestartJobFinished(previous) || previous.SecretVersion != secretVersion) {
+		if jobStatus.Phase == RESTART_JOB_PHASE_FAILED {
+			r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeWarning, "RestartJobFailed", "%s Job %v for secret version %v failed: %v", stage, jobName, secretVersion, jobStatus.Message)
+		} else {
+			r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeNormal, "RestartJobSucceeded", "%s Job %v for secret version %v succeeded", stage, jobName, secretVersion)
+		}
+	}
+
+	return jobStatus, nil
+}
+
+// The Job is owned by the InfisicalSecret, so its completion triggers a reconcile of the InfisicalSecret right away.
+// The timeout is enforced by the Job controller through activeDeadlineSeconds, which fails the Job once it is exceeded
+func newRestartJob(infisicalSecret v1alpha1.InfisicalSecret, restartJob v1alpha1.RestartJob, jobName string, secretVersion string) *batchv1.Job {
+	template := restartJob.JobTemplate.DeepCopy()
+
+	labels := template.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for key, value := range GetManagedByLabels(infisicalSecret) {
+		labels[key] = value
+	}
+
+	annotations := template.Annotations
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[SECRET_VERSION_ANNOTATION] = secretVersion
+
+	timeoutSeconds := restartJob.TimeoutSeconds
+	if timeoutSeconds == 0 {
+		timeoutSeconds = DEFAULT_RESTART_JOB_TIMEOUT_SECONDS
+	}
+	if template.Spec.ActiveDeadlineSeconds == nil || *template.Spec.ActiveDeadlineSeconds > timeoutSeconds {
+		template.Spec.ActiveDeadlineSeconds = &timeoutSeconds
+	}
+
+	if template.Spec.Template.Spec.RestartPolicy == "" {
+		template.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyNever
+	}
+
+	job := &batchv1.Job{Spec: template.Spec}
+	job.Name = jobName
+	job.Namespace = infisicalSecret.Namespace
+	job.Labels = labels
+	job.Annotations = annotations
+	return job
+}
+
+// Runs the post restart Job once every workload restarted for the secret version finished rolling it out. Nothing is run for versions that did not restart any workload
+func (r *InfisicalSecretReconciler) ReconcilePostRestartJob(ctx context.Context, infisicalSecret v1alpha1.InfisicalSecret, matchedWorkloads []Workload, annotationKey string, secretVersion string, outcome ReconcileOutcome) (*v1alpha1.RestartJobStatus, error) {
+	previous := infisicalSecret.Status.PostRestartJob
+	if outcome.Total.Restarted > 0 && (previous == nil || previous.SecretVersion != secretVersion) {
+		previous = &v1alpha1.RestartJobStatus{SecretVersion: secretVersion, Phase: RESTART_JOB_PHASE_PENDING}
+	}
+
+	if previous == nil || previous.SecretVersion != secretVersion || isRestartJobFinished(previous) {
+		return previous, nil
+	}
+
+	// restarts still deferred or failing would otherwise miss the Job
+	if outcome.Total.Restarted > 0 || outcome.Total.Deferred > 0 || outcome.Total.Failed > 0 {
+		return previous, nil
+	}
+
+	if previous.Phase == RESTART_JOB_PHASE_PENDING {
+		for _, workload := range matchedWorkloads {
+			settled, err := r.isWorkloadSettled(ctx, workload, infisicalSecret, annotationKey, secretVersion)
+			if err != nil {
+				return previous, err
+			}
+
+			if !settled {
+				fmt.Printf("waiting for [workload=%v] to finish rolling out secret [version=%v] before running the post restart job\n", workload.Ref(), secretVersion)
+				return previous, nil
+			}
+		}
+	}
+
+	return r.RunRestartJob(ctx, infisicalSecret, *infisicalSecret.Spec.PostRestartJob, previous, RESTART_JOB_STAGE_POST, secretVersion)
+}
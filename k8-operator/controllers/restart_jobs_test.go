@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func newRestartJobTestFixtures() (*corev1.Secret, *v1.StatefulSet, secretsv1alpha1.InfisicalSecret) {
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	statefulSet := &v1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "api",
+			Namespace:   "default",
+			Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1"},
+		},
+	}
+	statefulSet.Spec.Template.Annotations = map[string]string{versionKey: "v1"}
+	statefulSet.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "api",
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+		}},
+	}}
+
+	restartJob := &secretsv1alpha1.RestartJob{}
+	restartJob.JobTemplate.Spec.Template.Spec.Containers = []corev1.Container{{Name: "migrate", Image: "migrations:latest"}}
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{ObjectMeta: metav1.ObjectMeta{Name: "app-secrets", Namespace: "default"}}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+	infisicalSecret.Spec.PreRestartJob = restartJob
+	infisicalSecret.Spec.PostRestartJob = restartJob.DeepCopy()
+
+	return managedSecret, statefulSet, infisicalSecret
+}
+
+func setRestartJobCondition(g *WithT, r *InfisicalSecretReconciler, jobName string, conditionType batchv1.JobConditionType) {
+	job := &batchv1.Job{}
+	g.Expect(r.Client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: jobName}, job)).To(Succeed())
+	job.Status.Conditions = []batchv1.JobCondition{{Type: conditionType, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded"}}
+	g.Expect(r.Client.Update(context.Background(), job)).To(Succeed())
+}
+
+func TestRestartJobsRunAroundRestart(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	managedSecret, statefulSet, infisicalSecret := newRestartJobTestFixtures()
+	r := newTestReconciler(managedSecret, statefulSet)
+	r.EnableRestartJobs = true
+
+	reconcile := func() ReconcileOutcome {
+		outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+		g.Expect(err).NotTo(HaveOccurred())
+		if outcome.PreRestartJob != nil {
+			infisicalSecret.Status.PreRestartJob = outcome.PreRestartJob
+		}
+		if outcome.PostRestartJob != nil {
+			infisicalSecret.Status.PostRestartJob = outcome.PostRestartJob
+		}
+		return outcome
+	}
+
+	preRestartJobName := GetRestartJobName(infisicalSecret, RESTART_JOB_STAGE_PRE, "v2")
+	postRestartJobName := GetRestartJobName(infisicalSecret, RESTART_JOB_STAGE_POST, "v2")
+
+	outcome := reconcile()
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Deferred: 1}))
+	g.Expect(outcome.PreRestartJob.Phase).To(Equal(RESTART_JOB_PHASE_RUNNING))
+
+	preRestartJob := &batchv1.Job{}
+	g.Expect(r.Client.Get(ctx, types.NamespacedName{Namespace: "default", Name: preRestartJobName}, preRestartJob)).To(Succeed())
+	g.Expect(*preRestartJob.Spec.ActiveDeadlineSeconds).To(Equal(DEFAULT_RESTART_JOB_TIMEOUT_SECONDS))
+	g.Expect(preRestartJob.Labels).To(HaveKeyWithValue(MANAGED_BY_LABEL, "app-secrets"))
+	g.Expect(preRestartJob.OwnerReferences).To(ConsistOf(HaveField("Name", "app-secrets")))
+
+	setRestartJobCondition(g, r, preRestartJobName, batchv1.JobComplete)
+
+	outcome = reconcile()
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Restarted: 1}))
+	g.Expect(outcome.PreRestartJob.Phase).To(Equal(RESTART_JOB_PHASE_SUCCEEDED))
+	g.Expect(outcome.PostRestartJob.Phase).To(Equal(RESTART_JOB_PHASE_PENDING))
+
+	// the post restart Job waits for the rollout of the restarted workload
+	outcome = reconcile()
+	g.Expect(outcome.PostRestartJob.Phase).To(Equal(RESTART_JOB_PHASE_PENDING))
+
+	restartedStatefulSet := &v1.StatefulSet{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(statefulSet), restartedStatefulSet)).To(Succeed())
+	restartedStatefulSet.Status = v1.StatefulSetStatus{CurrentRevision: "2", UpdateRevision: "2", UpdatedReplicas: 1, AvailableReplicas: 1}
+	g.Expect(r.Client.Update(ctx, restartedStatefulSet)).To(Succeed())
+
+	outcome = reconcile()
+	g.Expect(outcome.PostRestartJob.Phase).To(Equal(RESTART_JOB_PHASE_RUNNING))
+	g.Expect(outcome.PostRestartJob.JobName).To(Equal(postRestartJobName))
+
+	setRestartJobCondition(g, r, postRestartJobName, batchv1.JobComplete)
+
+	outcome = reconcile()
+	g.Expect(outcome.PostRestartJob.Phase).To(Equal(RESTART_JOB_PHASE_SUCCEEDED))
+}
+
+func TestFailedPreRestartJobAbortsRestart(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	managedSecret, statefulSet, infisicalSecret := newRestartJobTestFixtures()
+	infisicalSecret.Spec.PostRestartJob = nil
+	r := newTestReconciler(managedSecret, statefulSet)
+	r.EnableRestartJobs = true
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	infisicalSecret.Status.PreRestartJob = outcome.PreRestartJob
+
+	setRestartJobCondition(g, r, outcome.PreRestartJob.JobName, batchv1.JobFailed)
+
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Skipped: 1}))
+	g.Expect(outcome.PreRestartJob.Phase).To(Equal(RESTART_JOB_PHASE_FAILED))
+	g.Expect(outcome.PreRestartJob.Message).To(ContainSubstring("BackoffLimitExceeded"))
+
+	unchangedStatefulSet := &v1.StatefulSet{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(statefulSet), unchangedStatefulSet)).To(Succeed())
+	g.Expect(unchangedStatefulSet.Spec.Template.Annotations[DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX+".managed-secret"]).To(Equal("v1"))
+}
+
+func TestRestartJobsRequireOptIn(t *testing.T) {
+	g := NewWithT(t)
+
+	managedSecret, statefulSet, infisicalSecret := newRestartJobTestFixtures()
+	r := newTestReconciler(managedSecret, statefulSet)
+
+	// the Jobs would run with service accounts chosen by whoever created the InfisicalSecret
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(context.Background(), infisicalSecret)
+	g.Expect(err).To(MatchError(ContainSubstring("--enable-restart-jobs")))
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{}))
+
+	jobs := &batchv1.JobList{}
+	g.Expect(r.Client.List(context.Background(), jobs)).To(Succeed())
+	g.Expect(jobs.Items).To(BeEmpty())
+}
+
+func TestRestartJobNamesOfLongInfisicalSecretNamesAreShortened(t *testing.T) {
+	g := NewWithT(t)
+
+	_, _, infisicalSecret := newRestartJobTestFixtures()
+	g.Expect(GetRestartJobName(infisicalSecret, RESTART_JOB_STAGE_POST, "v2")).To(HavePrefix("app-secrets-post-restart-"))
+
+	infisicalSecret.Name = "payments-api-production-eu-west-1-secrets"
+	otherInfisicalSecret := infisicalSecret
+	otherInfisicalSecret.Name = "payments-api-production-eu-west-1-secrets-canary"
+
+	jobName := GetRestartJobName(infisicalSecret, RESTART_JOB_STAGE_POST, "v2")
+	g.Expect(len(jobName)).To(BeNumerically("<=", MAX_RESTART_JOB_NAME_LENGTH))
+	g.Expect(jobName).To(HavePrefix("payments-api-production-eu-"))
+	g.Expect(jobName).NotTo(Equal(GetRestartJobName(otherInfisicalSecret, RESTART_JOB_STAGE_POST, "v2")))
+	g.Expect(jobName).NotTo(Equal(GetRestartJobName(infisicalSecret, RESTART_JOB_STAGE_POST, "v3")))
+
+	r := newTestReconciler()
+	r.EnableRestartJobs = true
+	g.Expect(r.ValidateRestartJobs(infisicalSecret)).To(Succeed())
+	g.Expect(r.ValidateRestartJobs(otherInfisicalSecret)).To(Succeed())
+}
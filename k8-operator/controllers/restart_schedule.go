@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	"github.com/Infisical/infisical/k8-operator/packages/schedule"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// set on a workload to the time a rotation of the managed secret was first observed while waiting for the restart schedule
+const DEPLOYMENT_PENDING_RESTART_ANNOTATION_PREFIX = "secrets.infisical.com/pending-restart-since"
+
+// set on a workload by its owners to a cron expression of the times it may be restarted for rotations. Takes precedence over the restart schedule of the InfisicalSecret
+const WORKLOAD_RESTART_WINDOW_ANNOTATION = "secrets.infisical.com/restart-window"
+
+// optional time zone the restart window of a workload is evaluated in, such as Europe/Berlin. Defaults to UTC
+const WORKLOAD_RESTART_WINDOW_TIME_ZONE_ANNOTATION = "secrets.infisical.com/restart-window-time-zone"
+
+// Parses the restart schedule of the InfisicalSecret. Returns nil when restarts are not scheduled
+func GetRestartSchedule(infisicalSecret v1alpha1.InfisicalSecret) (*schedule.Schedule, error) {
+	if infisicalSecret.Spec.RestartSchedule == nil {
+		return nil, nil
+	}
+
+	restartSchedule, err := schedule.Parse(infisicalSecret.Spec.RestartSchedule.Cron, infisicalSecret.Spec.RestartSchedule.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid restart schedule [err=%w]", err)
+	}
+
+	return restartSchedule, nil
+}
+
+// Parses the restart window annotation of the workload. Returns nil when the workload does not restrict its restarts
+func GetWorkloadRestartWindow(workload Workload) (*schedule.Schedule, error) {
+	expression, hasWindow := workload.Metadata.Annotations[WORKLOAD_RESTART_WINDOW_ANNOTATION]
+	if !hasWindow {
+		return nil, nil
+	}
+
+	restartWindow, err := schedule.Parse(expression, workload.Metadata.Annotations[WORKLOAD_RESTART_WINDOW_TIME_ZONE_ANNOTATION])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation on [workload=%v] [err=%w]", WORKLOAD_RESTART_WINDOW_ANNOTATION, workload.Ref(), err)
+	}
+
+	return restartWindow, nil
+}
+
+// The restart window of the workload, or the restart schedule of the InfisicalSecret when the workload has none. nil when restarts are not scheduled
+func getEffectiveRestartSchedule(workload Workload, restartSchedule *schedule.Schedule) (*schedule.Schedule, error) {
+	restartWindow, err := GetWorkloadRestartWindow(workload)
+	if err != nil || restartWindow != nil {
+		return restartWindow, err
+	}
+	return restartSchedule, nil
+}
+
+// Returns true when the restart schedule has fired since the rotation pending on the workload was first observed.
+// A newly observed rotation is recorded on the workload, without touching its pod template, so that it is restarted the next time the schedule fires
+func (r *InfisicalSecretReconciler) IsScheduledRestartDue(ctx context.Context, workload Workload, secret corev1.Secret, infisicalSecret v1alpha1.InfisicalSecret, restartSchedule *schedule.Schedule, now time.Time) (bool, error) {
+	pendingAnnotationKey := fmt.Sprintf("%s.%s", DEPLOYMENT_PENDING_RESTART_ANNOTATION_PREFIX, secret.Name)
+
+	pendingSince, err := time.Parse(time.RFC3339, workload.Metadata.Annotations[pendingAnnotationKey])
+	if err == nil {
+		nextRestart := restartSchedule.Next(pendingSince)
+		return !nextRestart.IsZero() && !nextRestart.After(now), nil
+	}
+
+	if workload.Metadata.Annotations == nil {
+		workload.Metadata.Annotations = make(map[string]string)
+	}
+	workload.Metadata.Annotations[pendingAnnotationKey] = now.UTC().Format(time.RFC3339)
+
+	if err := r.Client.Update(ctx, workload.Object); err != nil {
+		return false, fmt.Errorf("unable to mark [workload=%v] as pending a scheduled restart [err=%w]", workload.Ref(), err)
+	}
+
+	fmt.Printf("Managed secret of [workload=%v] was rotated. Restart is pending until the next scheduled restart at [time=%v]\n", workload.Ref(), restartSchedule.Next(now))
+	return false, nil
+}
+
+// Returns the workloads which are waiting for the restart schedule to fire
+func (r *InfisicalSecretReconciler) GetPendingScheduledRestarts(ctx context.Context, infisicalSecret v1alpha1.InfisicalSecret) ([]string, error) {
+	var workloads []Workload
+	for _, namespace := range GetReloadNamespaces(infisicalSecret) {
+		namespaceWorkloads, err := r.ListWorkloads(ctx, namespace)
+		if err != nil {
+			return nil, err
+		}
+		workloads = append(workloads, namespaceWorkloads...)
+	}
+
+	pendingAnnotationKey := fmt.Sprintf("%s.%s", DEPLOYMENT_PENDING_RESTART_ANNOTATION_PREFIX, infisicalSecret.Spec.ManagedSecretReference.SecretName)
+
+	var pendingWorkloads []string
+	for _, workload := range workloads {
+		if _, isPending := workload.Metadata.Annotations[pendingAnnotationKey]; isPending {
+			pendingWorkloads = append(pendingWorkloads, workload.Ref())
+		}
+	}
+
+	return pendingWorkloads, nil
+}
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestScheduledRestarts(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+	pendingKey := DEPLOYMENT_PENDING_RESTART_ANNOTATION_PREFIX + ".managed-secret"
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	newDeployment := func(name string, version string) *v1.Deployment {
+		deployment := &v1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: version},
+			},
+		}
+		deployment.Spec.Template.Annotations = map[string]string{versionKey: version}
+		deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+			Name: "app",
+			EnvFrom: []corev1.EnvFromSource{{
+				SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+			}},
+		}}
+		return deployment
+	}
+
+	r := newTestReconciler(managedSecret, newDeployment("rotated", "v1"), newDeployment("up-to-date", "v2"))
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+	infisicalSecret.Spec.RestartSchedule = &secretsv1alpha1.RestartSchedule{Cron: "0 2 * * *", TimeZone: "America/New_York"}
+
+	getDeployment := func(name string) *v1.Deployment {
+		deployment := &v1.Deployment{}
+		g.Expect(r.Client.Get(ctx, client.ObjectKey{Namespace: "default", Name: name}, deployment)).To(Succeed())
+		return deployment
+	}
+
+	// the rotation is only recorded until the schedule fires
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 2, Deferred: 1}))
+
+	rotated := getDeployment("rotated")
+	g.Expect(rotated.Annotations).To(HaveKey(pendingKey))
+	g.Expect(rotated.Spec.Template.Annotations[versionKey]).To(Equal("v1"))
+
+	pendingRestarts, err := r.GetPendingScheduledRestarts(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(pendingRestarts).To(Equal([]string{"Deployment/default/rotated"}))
+
+	// once the schedule fired after the rotation was observed, only the workloads with a pending rotation are restarted
+	rotated.Annotations[pendingKey] = time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339)
+	g.Expect(r.Client.Update(ctx, rotated)).To(Succeed())
+
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 2, Restarted: 1}))
+
+	rotated = getDeployment("rotated")
+	g.Expect(rotated.Annotations).NotTo(HaveKey(pendingKey))
+	g.Expect(rotated.Spec.Template.Annotations[versionKey]).To(Equal("v2"))
+
+	upToDate := getDeployment("up-to-date")
+	g.Expect(upToDate.Annotations).NotTo(HaveKey(pendingKey))
+	g.Expect(upToDate.Spec.Template.Annotations).NotTo(HaveKey(DEPLOYMENT_RELOAD_REASON_ANNOTATION))
+}
+
+func TestWorkloadRestartWindow(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+	pendingKey := DEPLOYMENT_PENDING_RESTART_ANNOTATION_PREFIX + ".managed-secret"
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	newDeployment := func(name string, restartWindow string) *v1.Deployment {
+		deployment := &v1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1"},
+			},
+		}
+		if restartWindow != "" {
+			deployment.Annotations[WORKLOAD_RESTART_WINDOW_ANNOTATION] = restartWindow
+			deployment.Annotations[WORKLOAD_RESTART_WINDOW_TIME_ZONE_ANNOTATION] = "Europe/Berlin"
+		}
+		deployment.Spec.Template.Annotations = map[string]string{versionKey: "v1"}
+		deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+			Name: "app",
+			EnvFrom: []corev1.EnvFromSource{{
+				SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+			}},
+		}}
+		return deployment
+	}
+
+	r := newTestReconciler(managedSecret, newDeployment("windowed", "0 3 * * 6"), newDeployment("immediate", ""), newDeployment("misconfigured", "every night"))
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	getDeployment := func(name string) *v1.Deployment {
+		deployment := &v1.Deployment{}
+		g.Expect(r.Client.Get(ctx, client.ObjectKey{Namespace: "default", Name: name}, deployment)).To(Succeed())
+		return deployment
+	}
+
+	// only the workload with a restart window waits for it, the others are restarted right away
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 3, Restarted: 1, Deferred: 1, Failed: 1}))
+	g.Expect(outcome.Failures).To(HaveKeyWithValue("Deployment/default/misconfigured", ContainSubstring(WORKLOAD_RESTART_WINDOW_ANNOTATION)))
+	g.Expect(outcome.NextRestartWindow.Weekday()).To(Equal(time.Saturday))
+
+	windowed := getDeployment("windowed")
+	g.Expect(windowed.Annotations).To(HaveKey(pendingKey))
+	g.Expect(windowed.Spec.Template.Annotations[versionKey]).To(Equal("v1"))
+	g.Expect(getDeployment("immediate").Spec.Template.Annotations[versionKey]).To(Equal("v2"))
+
+	// the pending restart is executed once the window opened after the rotation was observed
+	windowed.Annotations[pendingKey] = time.Now().Add(-8 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	g.Expect(r.Client.Update(ctx, windowed)).To(Succeed())
+
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 3, Restarted: 1, Failed: 1}))
+	g.Expect(outcome.NextRestartWindow.IsZero()).To(BeTrue())
+
+	windowed = getDeployment("windowed")
+	g.Expect(windowed.Annotations).NotTo(HaveKey(pendingKey))
+	g.Expect(windowed.Spec.Template.Annotations[versionKey]).To(Equal("v2"))
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	"github.com/Infisical/infisical/k8-operator/packages/audit"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Reason to restart a workload when the versions it was reloaded at are tracked in the status of the InfisicalSecret instead of on the workload
+func getStatusTrackedReloadReason(workload Workload, secret corev1.Secret, infisicalSecret v1alpha1.InfisicalSecret) string {
+	if workload.Metadata.Annotations[FORCE_RELOAD_DEPLOYMENT_ANNOTATION] == "true" {
+		return RELOAD_REASON_FORCED
+	}
+
+	reloadedVersion, isTracked := infisicalSecret.Status.ReloadedWorkloads[workload.Ref()]
+	if !isTracked {
+		return RELOAD_REASON_SECRET_CREATED
+	}
+
+	if reloadedVersion != secret.Annotations[SECRET_VERSION_ANNOTATION] {
+		return RELOAD_REASON_DATA_CHANGED
+	}
+
+	return ""
+}
+
+// Versions the matched workloads were reloaded at according to the status. Workloads that no longer consume the managed secret are dropped
+func GetReloadedWorkloads(previous map[string]string, matchedWorkloads []Workload) map[string]string {
+	reloadedWorkloads := map[string]string{}
+	for _, workload := range matchedWorkloads {
+		if version, isTracked := previous[workload.Ref()]; isTracked {
+			reloadedWorkloads[workload.Ref()] = version
+		}
+	}
+	return reloadedWorkloads
+}
+
+// Restarts the workload the way `kubectl rollout restart` does, by only setting the restartedAt annotation of its pod template.
+// Adopted workloads are not updated at all. The caller records the version in the status once the decision was made
+func (r *InfisicalSecretReconciler) ReconcileWorkloadWithRestartedAtOnly(ctx context.Context, workload Workload, secret corev1.Secret, infisicalSecret v1alpha1.InfisicalSecret, reloadReason string) (string, error) {
+	annotationValue := secret.Annotations[SECRET_VERSION_ANNOTATION]
+	previousVersion := infisicalSecret.Status.ReloadedWorkloads[workload.Ref()]
+
+	if r.shouldAdoptWorkload(reloadReason, infisicalSecret) || (reloadReason != RELOAD_REASON_FORCED && isWorkloadYoungerThan(workload, infisicalSecret.Spec.MinWorkloadAgeSeconds, time.Now())) {
+		fmt.Printf("Adopting the current managed secret version for [workload=%v] without a restart\n", workload.Ref())
+		r.AuditRestartDecision(infisicalSecret, workload, previousVersion, annotationValue, audit.DECISION_ADOPTED, nil)
+		return audit.DECISION_ADOPTED, nil
+	}
+
+	fmt.Printf("workload is using outdated managed secret. Starting re-deployment through the restartedAt annotation [workload=%v] [reason=%v]\n", workload.Ref(), reloadReason)
+
+	if workload.PodTemplate.Annotations == nil {
+		workload.PodTemplate.Annotations = make(map[string]string)
+	}
+
+	// the force annotation is set by users to request a restart, so it is still removed once the restart was performed
+	delete(workload.Metadata.Annotations, FORCE_RELOAD_DEPLOYMENT_ANNOTATION)
+	workload.PodTemplate.Annotations[RESTARTED_AT_ANNOTATION] = time.Now().Format(time.RFC3339)
+
+	if err := r.Client.Update(ctx, workload.Object); err != nil {
+		err = fmt.Errorf("failed to update %s restartedAt annotation: %w", workload.Kind, err)
+		r.AuditRestartDecision(infisicalSecret, workload, previousVersion, annotationValue, audit.DECISION_RESTARTED, err)
+		return audit.DECISION_RESTARTED, err
+	}
+
+	r.AuditRestartDecision(infisicalSecret, workload, previousVersion, annotationValue, audit.DECISION_RESTARTED, nil)
+	workloadReloadsTotal.WithLabelValues(workload.Kind, reloadReason).Inc()
+	return audit.DECISION_RESTARTED, nil
+}
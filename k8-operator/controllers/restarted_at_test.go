@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestRestartedAtOnlyTracksReloadsInStatus(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	deployment := &v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "api",
+			Namespace:   "default",
+			Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true"},
+		},
+	}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "api",
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+		}},
+	}}
+	deploymentRef := "Deployment/default/api"
+
+	r := newTestReconciler(managedSecret, deployment)
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+	infisicalSecret.Spec.RestartedAtOnly = true
+	infisicalSecret.Status.ReloadedWorkloads = map[string]string{deploymentRef: "v1", "Deployment/default/deleted": "v1"}
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Restarted: 1}))
+	g.Expect(outcome.ReloadedWorkloads).To(Equal(map[string]string{deploymentRef: "v2"}))
+
+	restartedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(deployment), restartedDeployment)).To(Succeed())
+	g.Expect(restartedDeployment.Spec.Template.Annotations).To(HaveKey(RESTARTED_AT_ANNOTATION))
+	g.Expect(restartedDeployment.Spec.Template.Annotations).To(HaveLen(1))
+	g.Expect(restartedDeployment.Annotations).To(Equal(map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true"}))
+
+	// the version recorded in the status prevents restarting the workload again
+	infisicalSecret.Status.ReloadedWorkloads = outcome.ReloadedWorkloads
+
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1}))
+	g.Expect(outcome.ReloadedWorkloads).To(Equal(map[string]string{deploymentRef: "v2"}))
+
+	unchangedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(deployment), unchangedDeployment)).To(Succeed())
+	g.Expect(unchangedDeployment.ResourceVersion).To(Equal(restartedDeployment.ResourceVersion))
+}
+
+func TestRestartedAtOnlyWorkloadSettlesOnceItsRestartRolledOut(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	annotationKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+	labels := map[string]string{"app": "api"}
+
+	deployment := &v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default", UID: "deployment-uid", Generation: 2},
+		Spec: v1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+		},
+		Status: v1.DeploymentStatus{
+			ObservedGeneration: 2,
+			Conditions: []v1.DeploymentCondition{
+				{Type: v1.DeploymentAvailable, Status: corev1.ConditionTrue},
+				{Type: v1.DeploymentProgressing, Status: corev1.ConditionTrue, Reason: NEW_REPLICA_SET_AVAILABLE_REASON},
+			},
+		},
+	}
+	deployment.Spec.Template.Annotations = map[string]string{RESTARTED_AT_ANNOTATION: "2024-01-02T00:00:00Z"}
+
+	replicaSetFor := func(name string, restartedAt string, availableReplicas int32) *v1.ReplicaSet {
+		replicaSet := &v1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    labels,
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: "apps/v1", Kind: "Deployment", Name: "api", UID: "deployment-uid", Controller: pointer.Bool(true),
+				}},
+			},
+			Spec:   v1.ReplicaSetSpec{Replicas: pointer.Int32(2)},
+			Status: v1.ReplicaSetStatus{AvailableReplicas: availableReplicas},
+		}
+		replicaSet.Spec.Template.Annotations = map[string]string{RESTARTED_AT_ANNOTATION: restartedAt}
+		return replicaSet
+	}
+
+	newReplicaSet := replicaSetFor("api-new", "2024-01-02T00:00:00Z", 1)
+	r := newTestReconciler(replicaSetFor("api-old", "2024-01-01T00:00:00Z", 2), newReplicaSet)
+	workload := NewDeploymentWorkload(deployment)
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.RestartedAtOnly = true
+	infisicalSecret.Status.ReloadedWorkloads = map[string]string{workload.Ref(): "v2"}
+
+	// the workload carries no version annotation, but was restarted for the version and its new pods are not all available yet
+	settled, err := r.isWorkloadSettled(ctx, workload, infisicalSecret, annotationKey, "v2")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(settled).To(BeFalse())
+
+	newReplicaSet.Status.AvailableReplicas = 2
+	g.Expect(r.Client.Update(ctx, newReplicaSet)).To(Succeed())
+
+	settled, err = r.isWorkloadSettled(ctx, workload, infisicalSecret, annotationKey, "v2")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(settled).To(BeTrue())
+
+	// workloads not restarted for the version have nothing to roll out
+	settled, err = r.isWorkloadSettled(ctx, workload, infisicalSecret, annotationKey, "v3")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(settled).To(BeTrue())
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reason set by the deployment controller on the Progressing condition once the newest ReplicaSet is fully available
+const NEW_REPLICA_SET_AVAILABLE_REASON = "NewReplicaSetAvailable"
+
+// Returns the workloads that were restarted for the current version of the managed secret, but whose new pods are not all running and ready yet
+func (r *InfisicalSecretReconciler) GetPendingWorkloadRollouts(ctx context.Context, infisicalSecret v1alpha1.InfisicalSecret) ([]string, error) {
+	managedKubeSecret := &corev1.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{
+		Namespace: infisicalSecret.Spec.ManagedSecretReference.SecretNamespace,
+		Name:      infisicalSecret.Spec.ManagedSecretReference.SecretName,
+	}, managedKubeSecret)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch Kubernetes secret to check workload rollouts: %w", err)
+	}
+	if err := r.useJSONPathAsVersion(managedKubeSecret, infisicalSecret); err != nil {
+		return nil, err
+	}
+	r.useContentChecksumAsVersion(managedKubeSecret)
+
+	// the same workloads ReconcileWorkloadsWithManagedSecrets restarts, so workloads sharing only the name of the secret are not waited for
+	reloadNamespaces, err := r.GetReplicatedReloadNamespaces(ctx, infisicalSecret, *managedKubeSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	workloads, err := r.ListReloadableWorkloads(ctx, reloadNamespaces)
+	if err != nil {
+		return nil, err
+	}
+
+	annotationKey := fmt.Sprintf("%s.%s", DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX, managedKubeSecret.Name)
+	secretVersion := managedKubeSecret.Annotations[SECRET_VERSION_ANNOTATION]
+
+	var pendingRollouts []string
+	for _, workload := range workloads {
+		if workload.Metadata.Annotations[AUTO_RELOAD_DEPLOYMENT_ANNOTATION] != "true" || !r.IsWorkloadUsingManagedSecret(workload, infisicalSecret) {
+			continue
+		}
+
+		settled, err := r.isWorkloadSettled(ctx, workload, infisicalSecret, annotationKey, secretVersion)
+		if err != nil {
+			return nil, err
+		}
+
+		if !settled {
+			pendingRollouts = append(pendingRollouts, workload.Ref())
+		}
+	}
+
+	return pendingRollouts, nil
+}
+
+// Pod template annotation identifying the rollout a workload was last restarted with. Workloads restarted through the restartedAt annotation carry
+// no version annotation, so their rollout is identified by the restartedAt value the operator wrote, or a later one that also includes the version
+func getRolloutAnnotation(workload Workload, annotationKey string, infisicalSecret v1alpha1.InfisicalSecret) (string, string) {
+	if infisicalSecret.Spec.RestartedAtOnly {
+		annotationKey = RESTARTED_AT_ANNOTATION
+	}
+	return annotationKey, workload.PodTemplate.Annotations[annotationKey]
+}
+
+// Checks if the workload finished rolling out the pod template carrying the given secret version
+func (r *InfisicalSecretReconciler) IsWorkloadRolloutComplete(ctx context.Context, workload Workload, annotationKey string, secretVersion string) (bool, error) {
+	switch object := workload.Object.(type) {
+	case *v1.Deployment:
+		return r.IsDeploymentRolloutComplete(ctx, *object, annotationKey, secretVersion)
+	case *v1.StatefulSet:
+		return IsStatefulSetRolloutComplete(*object), nil
+	case *v1.DaemonSet:
+		return IsDaemonSetRolloutComplete(*object), nil
+	default:
+		return false, fmt.Errorf("unable to check rollout of unsupported [workload=%v]", workload.Ref())
+	}
+}
+
+// Checks if the rollout of the given secret version has completed. A deployment can be Available while still running on its old pods,
+// so besides the deployment conditions the ReplicaSet created for the secret version must have all of its replicas available
+func (r *InfisicalSecretReconciler) IsDeploymentRolloutComplete(ctx context.Context, deployment v1.Deployment, annotationKey string, secretVersion string) (bool, error) {
+	if deployment.Status.ObservedGeneration < deployment.Generation {
+		return false, nil
+	}
+
+	if !hasDeploymentCondition(deployment, v1.DeploymentAvailable, corev1.ConditionTrue, "") ||
+		!hasDeploymentCondition(deployment, v1.DeploymentProgressing, corev1.ConditionTrue, NEW_REPLICA_SET_AVAILABLE_REASON) {
+		return false, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return false, fmt.Errorf("unable to parse selector of [deployment=%v] [err=%w]", deployment.Name, err)
+	}
+
+	listOfReplicaSets := &v1.ReplicaSetList{}
+	err = r.Client.List(ctx, listOfReplicaSets, &client.ListOptions{Namespace: deployment.Namespace, LabelSelector: selector})
+	if err != nil {
+		return false, fmt.Errorf("unable to get replica sets of [deployment=%v] [err=%w]", deployment.Name, err)
+	}
+
+	for _, replicaSet := range listOfReplicaSets.Items {
+		if !metav1.IsControlledBy(&replicaSet, &deployment) || replicaSet.Spec.Template.Annotations[annotationKey] != secretVersion {
+			continue
+		}
+
+		desiredReplicas := int32(1)
+		if replicaSet.Spec.Replicas != nil {
+			desiredReplicas = *replicaSet.Spec.Replicas
+		}
+
+		return replicaSet.Status.ObservedGeneration >= replicaSet.Generation && replicaSet.Status.AvailableReplicas >= desiredReplicas, nil
+	}
+
+	// the deployment controller has not created the ReplicaSet for the new version yet
+	return false, nil
+}
+
+func hasDeploymentCondition(deployment v1.Deployment, conditionType v1.DeploymentConditionType, status corev1.ConditionStatus, reason string) bool {
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == conditionType {
+			return condition.Status == status && (reason == "" || condition.Reason == reason)
+		}
+	}
+	return false
+}
+
+// A StatefulSet has rolled out its current template once it observed it and every replica runs the update revision and is available
+func IsStatefulSetRolloutComplete(statefulSet v1.StatefulSet) bool {
+	desiredReplicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		desiredReplicas = *statefulSet.Spec.Replicas
+	}
+
+	return statefulSet.Status.ObservedGeneration >= statefulSet.Generation &&
+		statefulSet.Status.UpdateRevision != "" &&
+		statefulSet.Status.CurrentRevision == statefulSet.Status.UpdateRevision &&
+		statefulSet.Status.UpdatedReplicas >= desiredReplicas &&
+		statefulSet.Status.AvailableReplicas >= desiredReplicas
+}
+
+// A DaemonSet has rolled out its current template once it observed it and runs an updated, available pod on every node it is scheduled to
+func IsDaemonSetRolloutComplete(daemonSet v1.DaemonSet) bool {
+	return daemonSet.Status.ObservedGeneration >= daemonSet.Generation &&
+		daemonSet.Status.UpdatedNumberScheduled >= daemonSet.Status.DesiredNumberScheduled &&
+		daemonSet.Status.NumberAvailable >= daemonSet.Status.DesiredNumberScheduled
+}
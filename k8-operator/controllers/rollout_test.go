@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+func TestIsDeploymentRolloutComplete(t *testing.T) {
+	g := NewWithT(t)
+
+	annotationKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+	labels := map[string]string{"app": "api"}
+
+	deployment := v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default", UID: "deployment-uid", Generation: 2},
+		Spec: v1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+		},
+		Status: v1.DeploymentStatus{
+			ObservedGeneration: 2,
+			Conditions: []v1.DeploymentCondition{
+				{Type: v1.DeploymentAvailable, Status: corev1.ConditionTrue},
+				{Type: v1.DeploymentProgressing, Status: corev1.ConditionTrue, Reason: "ReplicaSetUpdated"},
+			},
+		},
+	}
+
+	replicaSetFor := func(name string, version string, availableReplicas int32) *v1.ReplicaSet {
+		replicaSet := &v1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    labels,
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: "apps/v1", Kind: "Deployment", Name: "api", UID: "deployment-uid", Controller: pointer.Bool(true),
+				}},
+			},
+			Spec:   v1.ReplicaSetSpec{Replicas: pointer.Int32(2)},
+			Status: v1.ReplicaSetStatus{AvailableReplicas: availableReplicas},
+		}
+		replicaSet.Spec.Template.Annotations = map[string]string{annotationKey: version}
+		return replicaSet
+	}
+
+	oldReplicaSet := replicaSetFor("api-old", "v1", 2)
+	newReplicaSet := replicaSetFor("api-new", "v2", 1)
+	r := newTestReconciler(oldReplicaSet, newReplicaSet)
+	ctx := context.Background()
+
+	// available on the old pods while the new ReplicaSet is still progressing
+	complete, err := r.IsDeploymentRolloutComplete(ctx, deployment, annotationKey, "v2")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(complete).To(BeFalse())
+
+	// the deployment reports the new ReplicaSet as available, but it is not fully available yet
+	deployment.Status.Conditions[1].Reason = NEW_REPLICA_SET_AVAILABLE_REASON
+	complete, err = r.IsDeploymentRolloutComplete(ctx, deployment, annotationKey, "v2")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(complete).To(BeFalse())
+
+	newReplicaSet.Status.AvailableReplicas = 2
+	g.Expect(r.Client.Update(ctx, newReplicaSet)).To(Succeed())
+	complete, err = r.IsDeploymentRolloutComplete(ctx, deployment, annotationKey, "v2")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(complete).To(BeTrue())
+
+	// a newer spec has not been observed by the deployment controller yet
+	deployment.Generation = 3
+	complete, err = r.IsDeploymentRolloutComplete(ctx, deployment, annotationKey, "v2")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(complete).To(BeFalse())
+}
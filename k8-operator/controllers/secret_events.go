@@ -0,0 +1,21 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// minimum time between two rotation summary events on the same managed secret
+const MANAGED_SECRET_EVENT_INTERVAL = 5 * time.Minute
+
+// Records a summary of how far a rotation was propagated on the managed secret itself, where it is often looked at while debugging
+func (r *InfisicalSecretReconciler) RecordManagedSecretRotationEvent(secret corev1.Secret, outcome ReconcileOutcome) {
+	if !r.managedSecretEvents.allow(fmt.Sprintf("%s/%s", secret.Namespace, secret.Name), MANAGED_SECRET_EVENT_INTERVAL, time.Now()) {
+		fmt.Printf("skipping rotation summary event on managed secret [name=%v] as one was recorded within the last [interval=%v]\n", secret.Name, MANAGED_SECRET_EVENT_INTERVAL)
+		return
+	}
+
+	r.Recorder.Eventf(&secret, corev1.EventTypeNormal, "RotationPropagated", "Rotation propagated to %v workload(s) at version %v: %v", outcome.Total.Restarted, secret.Annotations[SECRET_VERSION_ANNOTATION], outcome.Breakdown(func(c WorkloadCounts) int { return c.Restarted }))
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestQuickRotationsRecordOneEventOnManagedSecret(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	deployment := &v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "api",
+			Namespace:   "default",
+			Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1"},
+		},
+	}
+	deployment.Spec.Template.Annotations = map[string]string{versionKey: "v1"}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "api",
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+		}},
+	}}
+
+	r := newTestReconciler(managedSecret, deployment)
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{ObjectMeta: metav1.ObjectMeta{Name: "app-secrets", Namespace: "default"}}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+	infisicalSecret.Spec.RecordEventsOnManagedSecret = true
+
+	for _, version := range []string{"v2", "v3"} {
+		managedSecret.Annotations[SECRET_VERSION_ANNOTATION] = version
+		g.Expect(r.Client.Update(ctx, managedSecret)).To(Succeed())
+
+		outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Restarted: 1}))
+	}
+
+	var rotationEvents []string
+	for len(r.Recorder.(*record.FakeRecorder).Events) > 0 {
+		if event := <-r.Recorder.(*record.FakeRecorder).Events; strings.Contains(event, "RotationPropagated") {
+			rotationEvents = append(rotationEvents, event)
+		}
+	}
+	g.Expect(rotationEvents).To(HaveLen(1))
+	g.Expect(rotationEvents[0]).To(ContainSubstring("at version v2"))
+}
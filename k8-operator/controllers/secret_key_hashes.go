@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Hashes every key of the secret together with its value, keyed with the fingerprint key, so changes of single keys can be detected without storing any value
+func (r *InfisicalSecretReconciler) hashSecretKeys(secret corev1.Secret) map[string]string {
+	hashes := map[string]string{}
+	for key, value := range secret.Data {
+		hash := r.newSecretDataHash()
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+		hash.Write(value)
+		hashes[key] = hex.EncodeToString(hash.Sum(nil))
+	}
+	return hashes
+}
+
+// Returns the keys that were added, removed or whose value changed between the two sets of hashes, in sorted order
+func getChangedSecretKeys(previousHashes map[string]string, currentHashes map[string]string) []string {
+	var changedKeys []string
+	for key, hash := range currentHashes {
+		if previousHash, exists := previousHashes[key]; !exists || previousHash != hash {
+			changedKeys = append(changedKeys, key)
+		}
+	}
+
+	for key := range previousHashes {
+		if _, exists := currentHashes[key]; !exists {
+			changedKeys = append(changedKeys, key)
+		}
+	}
+
+	sort.Strings(changedKeys)
+	return changedKeys
+}
+
+// Computes the key hashes of the current version of the managed secret and the keys that changed compared to the version previously recorded in the status.
+// Reconciles of the same version keep the keys that changed in it, as workloads are not necessarily all restarted in the first reconcile of a version
+func (r *InfisicalSecretReconciler) GetSecretKeyHashes(previous *v1alpha1.SecretKeyHashes, secret corev1.Secret) *v1alpha1.SecretKeyHashes {
+	current := &v1alpha1.SecretKeyHashes{
+		SecretVersion: secret.Annotations[SECRET_VERSION_ANNOTATION],
+		Keys:          r.hashSecretKeys(secret),
+	}
+
+	if previous == nil {
+		return current
+	}
+
+	if previous.SecretVersion != current.SecretVersion {
+		current.PreviousSecretVersion = previous.SecretVersion
+		current.ChangedKeys = getChangedSecretKeys(previous.Keys, current.Keys)
+		return current
+	}
+
+	// the data changed without the version changing, such as when the secret was edited by hand
+	current.PreviousSecretVersion = previous.PreviousSecretVersion
+	current.ChangedKeys = mergeSortedKeys(previous.ChangedKeys, getChangedSecretKeys(previous.Keys, current.Keys))
+	return current
+}
+
+func mergeSortedKeys(keys []string, otherKeys []string) []string {
+	seen := map[string]bool{}
+	var merged []string
+	for _, key := range append(append([]string{}, keys...), otherKeys...) {
+		if !seen[key] {
+			seen[key] = true
+			merged = append(merged, key)
+		}
+	}
+
+	sort.Strings(merged)
+	return merged
+}
+
+// Determines from the key hashes in the status if any key consumed by the workload changed. Only possible when the workload was last reconciled
+// with the version the changes were computed against, the second return value is false otherwise
+func (r *InfisicalSecretReconciler) haveConsumedKeysChangedSinceVersion(workload Workload, secret corev1.Secret, infisicalSecret v1alpha1.InfisicalSecret) (changed bool, known bool) {
+	keyHashes := infisicalSecret.Status.SecretKeyHashes
+	if keyHashes == nil || keyHashes.PreviousSecretVersion == "" || keyHashes.SecretVersion != secret.Annotations[SECRET_VERSION_ANNOTATION] {
+		return false, false
+	}
+
+	recordedVersion, isRecorded := r.GetRecordedSecretVersion(workload, secret.Name)
+	if !isRecorded || recordedVersion != keyHashes.PreviousSecretVersion {
+		return false, false
+	}
+
+	consumedKeys := getConsumedKeys(r.DetectManagedSecretReferences(*workload.PodTemplate, infisicalSecret), secret)
+	if consumedKeys == nil {
+		return len(keyHashes.ChangedKeys) > 0, true
+	}
+
+	changedKeys := map[string]bool{}
+	for _, key := range keyHashes.ChangedKeys {
+		changedKeys[key] = true
+	}
+
+	for _, key := range consumedKeys {
+		if changedKeys[key] {
+			fmt.Printf("consumed [key=%v] of [workload=%v] changed in [version=%v]\n", key, workload.Ref(), keyHashes.SecretVersion)
+			return true, true
+		}
+	}
+	return false, true
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestGetSecretKeyHashesAcrossRotations(t *testing.T) {
+	g := NewWithT(t)
+	r := newTestReconciler()
+
+	secretAtVersion := func(version string, data map[string]string) corev1.Secret {
+		secret := corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "managed-secret", Annotations: map[string]string{SECRET_VERSION_ANNOTATION: version}},
+			Data:       map[string][]byte{},
+		}
+		for key, value := range data {
+			secret.Data[key] = []byte(value)
+		}
+		return secret
+	}
+
+	v1Secret := secretAtVersion("v1", map[string]string{"DB_PASS": "db-password", "API_KEY": "api-key", "SMTP_PASS": "smtp-password"})
+	v2Secret := secretAtVersion("v2", map[string]string{"DB_PASS": "rotated-db-password", "API_KEY": "api-key", "REDIS_PASS": "redis-password"})
+	v3Secret := secretAtVersion("v3", map[string]string{"DB_PASS": "rotated-db-password", "API_KEY": "rotated-api-key", "REDIS_PASS": "redis-password"})
+
+	keyHashes := r.GetSecretKeyHashes(nil, v1Secret)
+	g.Expect(keyHashes.SecretVersion).To(Equal("v1"))
+	g.Expect(keyHashes.PreviousSecretVersion).To(BeEmpty())
+	g.Expect(keyHashes.ChangedKeys).To(BeEmpty())
+
+	// the value of one key changed, one key was removed and another added
+	keyHashes = r.GetSecretKeyHashes(keyHashes, v2Secret)
+	g.Expect(keyHashes.PreviousSecretVersion).To(Equal("v1"))
+	g.Expect(keyHashes.ChangedKeys).To(Equal([]string{"DB_PASS", "REDIS_PASS", "SMTP_PASS"}))
+
+	// reconciling the same version again keeps the keys changed in it
+	keyHashes = r.GetSecretKeyHashes(keyHashes, v2Secret)
+	g.Expect(keyHashes.PreviousSecretVersion).To(Equal("v1"))
+	g.Expect(keyHashes.ChangedKeys).To(Equal([]string{"DB_PASS", "REDIS_PASS", "SMTP_PASS"}))
+
+	keyHashes = r.GetSecretKeyHashes(keyHashes, v3Secret)
+	g.Expect(keyHashes.PreviousSecretVersion).To(Equal("v2"))
+	g.Expect(keyHashes.ChangedKeys).To(Equal([]string{"API_KEY"}))
+
+	// only hashes are persisted, never the values of the secret
+	rawStatus, err := json.Marshal(secretsv1alpha1.InfisicalSecretStatus{SecretKeyHashes: keyHashes})
+	g.Expect(err).NotTo(HaveOccurred())
+	for _, secret := range []corev1.Secret{v1Secret, v2Secret, v3Secret} {
+		for _, value := range secret.Data {
+			g.Expect(string(rawStatus)).NotTo(ContainSubstring(string(value)))
+		}
+	}
+}
+
+func TestOnlyWorkloadsConsumingChangedKeysAreRestarted(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+
+	previousSecret := corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "managed-secret", Namespace: "default", Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v1"}},
+		Data:       map[string][]byte{"DB_PASS": []byte("db-password"), "API_KEY": []byte("old-api-key")},
+	}
+
+	rotatedSecret := previousSecret.DeepCopy()
+	rotatedSecret.Annotations = map[string]string{SECRET_VERSION_ANNOTATION: "v2"}
+	rotatedSecret.Data["API_KEY"] = []byte("new-api-key")
+
+	// neither deployment carries a consumed keys hash, so the changed keys can only be known from the status
+	deploymentConsumingKey := func(name string, key string) *v1.Deployment {
+		deployment := &v1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1"},
+			},
+		}
+		deployment.Spec.Template.Annotations = map[string]string{versionKey: "v1"}
+		deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+			Name: "app",
+			Env: []corev1.EnvVar{{Name: "VALUE", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"},
+				Key:                  key,
+			}}}},
+		}}
+		return deployment
+	}
+
+	database := deploymentConsumingKey("database-client", "DB_PASS")
+	api := deploymentConsumingKey("api-client", "API_KEY")
+
+	r := newTestReconciler(rotatedSecret, database, api)
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+	infisicalSecret.Spec.RestartOnlyForConsumedKeys = true
+	infisicalSecret.Status.SecretKeyHashes = r.GetSecretKeyHashes(nil, previousSecret)
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 2, Restarted: 1}))
+	g.Expect(outcome.SecretKeyHashes.ChangedKeys).To(Equal([]string{"API_KEY"}))
+
+	databaseDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(database), databaseDeployment)).To(Succeed())
+	g.Expect(databaseDeployment.Spec.Template.Annotations[versionKey]).To(Equal("v1"))
+
+	apiDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(api), apiDeployment)).To(Succeed())
+	g.Expect(apiDeployment.Spec.Template.Annotations[versionKey]).To(Equal("v2"))
+}
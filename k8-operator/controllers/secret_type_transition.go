@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Keys Kubernetes requires secrets of the builtin types to hold. Mounts and consumers relying on these keys, such as TLS volumes or image pull secrets,
+// can break when the secret changes from or to one of these types, while opaque secrets and custom types hold arbitrary keys
+var WELL_KNOWN_SECRET_TYPE_KEYS = map[corev1.SecretType][]string{
+	corev1.SecretTypeTLS:                 {corev1.TLSCertKey, corev1.TLSPrivateKeyKey},
+	corev1.SecretTypeDockerConfigJson:    {corev1.DockerConfigJsonKey},
+	corev1.SecretTypeDockercfg:           {corev1.DockerConfigKey},
+	corev1.SecretTypeBasicAuth:           {corev1.BasicAuthUsernameKey, corev1.BasicAuthPasswordKey},
+	corev1.SecretTypeSSHAuth:             {corev1.SSHAuthPrivateKey},
+	corev1.SecretTypeServiceAccountToken: {corev1.ServiceAccountTokenKey, corev1.ServiceAccountRootCAKey, corev1.ServiceAccountNamespaceKey},
+}
+
+// Returns a warning when the type of the managed secret changed in a way that changes the keys its consumers mount, or an empty string when it did not
+func GetSecretTypeTransitionWarning(secretName string, previousType corev1.SecretType, currentType corev1.SecretType) string {
+	if previousType == currentType {
+		return ""
+	}
+
+	previousKeys, previousIsWellKnown := WELL_KNOWN_SECRET_TYPE_KEYS[previousType]
+	currentKeys, currentIsWellKnown := WELL_KNOWN_SECRET_TYPE_KEYS[currentType]
+	if !previousIsWellKnown && !currentIsWellKnown {
+		return ""
+	}
+
+	describeKeys := func(secretType corev1.SecretType, keys []string, isWellKnown bool) string {
+		if !isWellKnown {
+			return fmt.Sprintf("%s secrets hold arbitrary keys", secretType)
+		}
+		return fmt.Sprintf("%s secrets hold the keys %s", secretType, strings.Join(keys, ", "))
+	}
+
+	return fmt.Sprintf("Managed secret %s changed its type from %s to %s. %s, while %s. Verify that the volume mounts, key references and image pull secrets of its consumers still resolve",
+		secretName, previousType, currentType, describeKeys(previousType, previousKeys, previousIsWellKnown), describeKeys(currentType, currentKeys, currentIsWellKnown))
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestSecretTypeTransitionsRestartWithWarning(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+	identityKey := DEPLOYMENT_SECRET_IDENTITY_ANNOTATION_PREFIX + ".managed-secret"
+
+	transitions := []struct {
+		previousType corev1.SecretType
+		currentType  corev1.SecretType
+		mentionedKey string
+	}{
+		{corev1.SecretTypeOpaque, corev1.SecretTypeTLS, corev1.TLSCertKey},
+		{corev1.SecretTypeTLS, corev1.SecretTypeOpaque, corev1.TLSPrivateKeyKey},
+		{corev1.SecretTypeOpaque, corev1.SecretTypeDockerConfigJson, corev1.DockerConfigJsonKey},
+		{corev1.SecretTypeDockerConfigJson, corev1.SecretTypeOpaque, corev1.DockerConfigJsonKey},
+	}
+
+	for _, transition := range transitions {
+		// recreating the secret is the only way to change its type
+		managedSecret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "managed-secret",
+				Namespace:   "default",
+				UID:         "uid-2",
+				Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v1"},
+			},
+			Type: transition.currentType,
+		}
+
+		previousIdentity := string(transition.previousType) + "/uid-1"
+		deployment := &v1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "api",
+				Namespace:   "default",
+				Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1", identityKey: previousIdentity},
+			},
+		}
+		deployment.Spec.Template.Annotations = map[string]string{versionKey: "v1", identityKey: previousIdentity}
+		deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+			Name:         "api",
+			VolumeMounts: []corev1.VolumeMount{{Name: "managed-secret", MountPath: "/etc/secret"}},
+		}}
+		deployment.Spec.Template.Spec.Volumes = []corev1.Volume{{
+			Name:         "managed-secret",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "managed-secret"}},
+		}}
+
+		r := newTestReconciler(managedSecret, deployment)
+
+		infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+		infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+		infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+		outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Restarted: 1}), string(transition.currentType))
+
+		restartedDeployment := &v1.Deployment{}
+		g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(deployment), restartedDeployment)).To(Succeed())
+		g.Expect(restartedDeployment.Spec.Template.Annotations[DEPLOYMENT_RELOAD_REASON_ANNOTATION]).To(Equal(RELOAD_REASON_TYPE_CHANGED))
+
+		var events []string
+		for len(r.Recorder.(*record.FakeRecorder).Events) > 0 {
+			events = append(events, <-r.Recorder.(*record.FakeRecorder).Events)
+		}
+		g.Expect(events).To(ContainElement(And(ContainSubstring("SecretTypeTransition"), ContainSubstring(transition.mentionedKey))), string(transition.currentType))
+	}
+}
+
+func TestGetSecretTypeTransitionWarning(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(GetSecretTypeTransitionWarning("managed-secret", corev1.SecretTypeOpaque, corev1.SecretTypeTLS)).To(ContainSubstring("from Opaque to kubernetes.io/tls"))
+
+	// opaque and custom secrets hold arbitrary keys, so consumers are restarted without a warning
+	g.Expect(GetSecretTypeTransitionWarning("managed-secret", corev1.SecretTypeOpaque, "example.com/custom")).To(BeEmpty())
+	g.Expect(GetSecretTypeTransitionWarning("managed-secret", corev1.SecretTypeTLS, corev1.SecretTypeTLS)).To(BeEmpty())
+}
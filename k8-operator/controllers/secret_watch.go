@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// set on managed secrets to the name and namespace of the InfisicalSecret they are synced from, so changes to them can be mapped back to it
+const MANAGED_BY_LABEL = "secrets.infisical.com/managed-by"
+const MANAGED_BY_NAMESPACE_LABEL = "secrets.infisical.com/managed-by-namespace"
+
+// Returns the labels identifying the InfisicalSecret that manages a secret. Names that are not valid label values cannot be
+// recorded, in which case changes to the managed secret are only noticed on the next periodic reconcile
+func GetManagedByLabels(infisicalSecret v1alpha1.InfisicalSecret) map[string]string {
+	if len(validation.IsValidLabelValue(infisicalSecret.Name)) > 0 {
+		fmt.Printf("name of [infisicalSecret=%v/%v] is not a valid label value. Changes to its managed secret will not trigger an immediate reconcile\n", infisicalSecret.Namespace, infisicalSecret.Name)
+		return map[string]string{}
+	}
+
+	return map[string]string{
+		MANAGED_BY_LABEL:           infisicalSecret.Name,
+		MANAGED_BY_NAMESPACE_LABEL: infisicalSecret.Namespace,
+	}
+}
+
+// Adds the managed by labels to a managed secret that was created before they were introduced
+func (r *InfisicalSecretReconciler) EnsureManagedByLabels(ctx context.Context, infisicalSecret v1alpha1.InfisicalSecret, managedKubeSecret *corev1.Secret) error {
+	managedByLabels := GetManagedByLabels(infisicalSecret)
+	if isMetadataSubset(managedByLabels, managedKubeSecret.Labels) {
+		return nil
+	}
+
+	if managedKubeSecret.Labels == nil {
+		managedKubeSecret.Labels = map[string]string{}
+	}
+	for key, value := range managedByLabels {
+		managedKubeSecret.Labels[key] = value
+	}
+
+	if err := r.Client.Update(ctx, managedKubeSecret); err != nil {
+		return fmt.Errorf("unable to label the managed Kubernetes secret [err=%w]", err)
+	}
+	return nil
+}
+
+// Removes the managed by labels from secrets the InfisicalSecret labeled before its managed secret reference changed, so that label based lookups
+// only find the secret it currently manages. Secrets named like the managed secret in its reload namespaces are left alone, as tools replicating
+// the managed secret may have copied its labels
+func (r *InfisicalSecretReconciler) RemoveStaleManagedByLabels(ctx context.Context, infisicalSecret v1alpha1.InfisicalSecret) error {
+	managedByName, isLabeled := GetManagedByLabels(infisicalSecret)[MANAGED_BY_LABEL]
+	if !isLabeled {
+		return nil
+	}
+
+	labeledSecrets := &corev1.SecretList{}
+	if err := r.Client.List(ctx, labeledSecrets, client.MatchingLabels{MANAGED_BY_LABEL: managedByName}); err != nil {
+		return fmt.Errorf("unable to list the secrets labeled as managed by the InfisicalSecret [err=%w]", err)
+	}
+
+	managedSecretNamespaces := map[string]bool{}
+	for _, namespace := range GetReloadNamespaces(infisicalSecret) {
+		managedSecretNamespaces[namespace] = true
+	}
+	infisicalSecretRequest := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: infisicalSecret.Namespace, Name: infisicalSecret.Name}}
+
+	for i := range labeledSecrets.Items {
+		secret := &labeledSecrets.Items[i]
+		// secrets labeled by an InfisicalSecret of the same name in another namespace
+		if requests := mapManagedSecretToInfisicalSecret(secret); len(requests) != 1 || requests[0] != infisicalSecretRequest {
+			continue
+		}
+
+		if secret.Name == infisicalSecret.Spec.ManagedSecretReference.SecretName && managedSecretNamespaces[secret.Namespace] {
+			continue
+		}
+
+		delete(secret.Labels, MANAGED_BY_LABEL)
+		delete(secret.Labels, MANAGED_BY_NAMESPACE_LABEL)
+		if err := r.Client.Update(ctx, secret); err != nil {
+			return fmt.Errorf("unable to remove the managed by labels from [secret=%v/%v] [err=%w]", secret.Namespace, secret.Name, err)
+		}
+		fmt.Printf("removed the managed by labels from [secret=%v/%v] which is no longer managed by [infisicalSecret=%v/%v]\n", secret.Namespace, secret.Name, infisicalSecret.Namespace, infisicalSecret.Name)
+	}
+
+	return nil
+}
+
+// Only secrets labeled as managed by an InfisicalSecret are watched
+var managedSecretPredicate = predicate.NewPredicateFuncs(func(object client.Object) bool {
+	_, isManaged := object.GetLabels()[MANAGED_BY_LABEL]
+	return isManaged
+})
+
+// Maps a changed managed secret to the InfisicalSecret it is synced from, so that its consuming workloads are reconciled right away
+func mapManagedSecretToInfisicalSecret(object client.Object) []reconcile.Request {
+	name := object.GetLabels()[MANAGED_BY_LABEL]
+	if name == "" {
+		return nil
+	}
+
+	namespace := object.GetLabels()[MANAGED_BY_NAMESPACE_LABEL]
+	if namespace == "" {
+		namespace = object.GetNamespace()
+	}
+
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}}}
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestManagedSecretChangeEnqueuesReconcile(t *testing.T) {
+	g := NewWithT(t)
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{ObjectMeta: metav1.ObjectMeta{Name: "app-secrets", Namespace: "infisical"}}
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Labels:      GetManagedByLabels(infisicalSecret),
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v1"},
+		},
+		Data: map[string][]byte{"DB_PASSWORD": []byte("old-password")},
+	}
+
+	rotatedSecret := managedSecret.DeepCopy()
+	rotatedSecret.Annotations[SECRET_VERSION_ANNOTATION] = "v2"
+	rotatedSecret.Data["DB_PASSWORD"] = []byte("new-password")
+
+	updateEvent := event.UpdateEvent{ObjectOld: managedSecret, ObjectNew: rotatedSecret}
+	g.Expect(managedSecretPredicate.Update(updateEvent)).To(BeTrue())
+
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer queue.ShutDown()
+
+	handler.EnqueueRequestsFromMapFunc(mapManagedSecretToInfisicalSecret).Update(updateEvent, queue)
+	g.Expect(queue.Len()).To(Equal(1))
+
+	request, _ := queue.Get()
+	g.Expect(request).To(Equal(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "infisical", Name: "app-secrets"}}))
+
+	// secrets which are not managed by an InfisicalSecret are not watched
+	unmanagedSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}}
+	g.Expect(managedSecretPredicate.Update(event.UpdateEvent{ObjectOld: unmanagedSecret, ObjectNew: unmanagedSecret})).To(BeFalse())
+}
+
+func TestStaleManagedByLabelsAreRemovedWhenManagedSecretChanges(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{ObjectMeta: metav1.ObjectMeta{Name: "app-secrets", Namespace: "default"}}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "old-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	oldSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "old-secret", Namespace: "default", Labels: GetManagedByLabels(infisicalSecret)}}
+	newSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "new-secret", Namespace: "default"}}
+
+	// managed by an InfisicalSecret of the same name in another namespace
+	otherInfisicalSecret := secretsv1alpha1.InfisicalSecret{ObjectMeta: metav1.ObjectMeta{Name: "app-secrets", Namespace: "team-b"}}
+	otherSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "old-secret", Namespace: "team-b", Labels: GetManagedByLabels(otherInfisicalSecret)}}
+
+	r := newTestReconciler(oldSecret, newSecret, otherSecret)
+
+	g.Expect(r.RemoveStaleManagedByLabels(ctx, infisicalSecret)).To(Succeed())
+	unchangedSecret := &corev1.Secret{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(oldSecret), unchangedSecret)).To(Succeed())
+	g.Expect(unchangedSecret.Labels).To(Equal(GetManagedByLabels(infisicalSecret)))
+
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "new-secret"
+
+	currentSecret := &corev1.Secret{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(newSecret), currentSecret)).To(Succeed())
+	g.Expect(r.EnsureManagedByLabels(ctx, infisicalSecret, currentSecret)).To(Succeed())
+	g.Expect(r.RemoveStaleManagedByLabels(ctx, infisicalSecret)).To(Succeed())
+
+	previousSecret := &corev1.Secret{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(oldSecret), previousSecret)).To(Succeed())
+	g.Expect(previousSecret.Labels).NotTo(HaveKey(MANAGED_BY_LABEL))
+	g.Expect(previousSecret.Labels).NotTo(HaveKey(MANAGED_BY_NAMESPACE_LABEL))
+
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(newSecret), currentSecret)).To(Succeed())
+	g.Expect(currentSecret.Labels).To(Equal(GetManagedByLabels(infisicalSecret)))
+
+	untouchedSecret := &corev1.Secret{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(otherSecret), untouchedSecret)).To(Succeed())
+	g.Expect(untouchedSecret.Labels).To(Equal(GetManagedByLabels(otherInfisicalSecret)))
+}
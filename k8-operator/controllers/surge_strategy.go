@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Strategy of the Deployment before it was temporarily switched to a surge rollout, as JSON. Removed once the original strategy is restored
+const DEPLOYMENT_ORIGINAL_STRATEGY_ANNOTATION = "secrets.infisical.com/original-strategy"
+
+// reason set by the deployment controller on the Progressing condition once a rollout did not progress within its progress deadline
+const PROGRESS_DEADLINE_EXCEEDED_REASON = "ProgressDeadlineExceeded"
+
+// the values the API server defaults missing rolling update parameters to
+var defaultMaxSurge = intstr.FromString("25%")
+var defaultMaxUnavailable = intstr.FromString("25%")
+
+// Returns the rolling update parameters of the Deployment, resolved against its replicas the same way the deployment controller does
+func getRollingUpdateParameters(deployment v1.Deployment) (maxSurge int, maxUnavailable int) {
+	replicas := 1
+	if deployment.Spec.Replicas != nil {
+		replicas = int(*deployment.Spec.Replicas)
+	}
+
+	surge, unavailable := defaultMaxSurge, defaultMaxUnavailable
+	if rollingUpdate := deployment.Spec.Strategy.RollingUpdate; rollingUpdate != nil {
+		if rollingUpdate.MaxSurge != nil {
+			surge = *rollingUpdate.MaxSurge
+		}
+		if rollingUpdate.MaxUnavailable != nil {
+			unavailable = *rollingUpdate.MaxUnavailable
+		}
+	}
+
+	maxSurge, _ = intstr.GetScaledValueFromIntOrPercent(&surge, replicas, true)
+	maxUnavailable, _ = intstr.GetScaledValueFromIntOrPercent(&unavailable, replicas, false)
+	return maxSurge, maxUnavailable
+}
+
+// Switches the Deployment to a rolling update that brings up new pods before old ones terminate, remembering its original strategy so it can be restored.
+// The change is sent together with the restart, so a failed restart leaves the Deployment untouched. Returns true when the strategy was changed
+func (r *InfisicalSecretReconciler) applySurgeStrategy(workload Workload, infisicalSecret v1alpha1.InfisicalSecret) bool {
+	deployment, isDeployment := workload.Object.(*v1.Deployment)
+	if !isDeployment || !infisicalSecret.Spec.SurgeRestarts {
+		return false
+	}
+
+	if deployment.Spec.Strategy.Type == v1.RecreateDeploymentStrategyType {
+		fmt.Printf("[workload=%v] uses the Recreate strategy, which is not switched to a surge rollout\n", workload.Ref())
+		return false
+	}
+
+	maxSurge, maxUnavailable := getRollingUpdateParameters(*deployment)
+	if maxSurge >= 1 && maxUnavailable == 0 {
+		return false
+	}
+
+	// a previous surge rollout that has not been restored yet already recorded the original strategy
+	if _, isRecorded := workload.Metadata.Annotations[DEPLOYMENT_ORIGINAL_STRATEGY_ANNOTATION]; !isRecorded {
+		originalStrategy, err := json.Marshal(deployment.Spec.Strategy)
+		if err != nil {
+			fmt.Printf("unable to record the strategy of [workload=%v]. Restarting it with its own strategy [err=%v]\n", workload.Ref(), err)
+			return false
+		}
+		workload.Metadata.Annotations[DEPLOYMENT_ORIGINAL_STRATEGY_ANNOTATION] = string(originalStrategy)
+	}
+
+	surge := intstr.FromInt(maxSurge)
+	if maxSurge < 1 {
+		surge = intstr.FromInt(1)
+	}
+	unavailable := intstr.FromInt(0)
+
+	deployment.Spec.Strategy = v1.DeploymentStrategy{
+		Type:          v1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &v1.RollingUpdateDeployment{MaxSurge: &surge, MaxUnavailable: &unavailable},
+	}
+	return true
+}
+
+// Restores the original strategy of a Deployment that was switched to a surge rollout, once the rollout completed or exceeded its progress deadline.
+// A Deployment whose rollout is still in progress keeps the surge strategy until a later reconcile
+func (r *InfisicalSecretReconciler) RestoreSurgeStrategy(ctx context.Context, workload Workload, annotationKey string, infisicalSecret v1alpha1.InfisicalSecret) error {
+	deployment, isDeployment := workload.Object.(*v1.Deployment)
+	if !isDeployment {
+		return nil
+	}
+
+	rawStrategy, isRecorded := workload.Metadata.Annotations[DEPLOYMENT_ORIGINAL_STRATEGY_ANNOTATION]
+	if !isRecorded {
+		return nil
+	}
+
+	rolloutFailed := hasDeploymentCondition(*deployment, v1.DeploymentProgressing, corev1.ConditionFalse, PROGRESS_DEADLINE_EXCEEDED_REASON)
+	if !rolloutFailed {
+		rolloutAnnotationKey, rolloutAnnotationValue := getRolloutAnnotation(workload, annotationKey, infisicalSecret)
+		rolloutComplete, err := r.IsDeploymentRolloutComplete(ctx, *deployment, rolloutAnnotationKey, rolloutAnnotationValue)
+		if err != nil {
+			return err
+		}
+
+		if !rolloutComplete {
+			return nil
+		}
+	}
+
+	originalStrategy := v1.DeploymentStrategy{}
+	if err := json.Unmarshal([]byte(rawStrategy), &originalStrategy); err != nil {
+		// the strategy cannot be restored, but keeping the annotation would retry forever
+		fmt.Printf("dropping invalid [annotation=%v] of [workload=%v], keeping its current strategy [err=%v]\n", DEPLOYMENT_ORIGINAL_STRATEGY_ANNOTATION, workload.Ref(), err)
+		originalStrategy = deployment.Spec.Strategy
+	}
+
+	deployment.Spec.Strategy = originalStrategy
+	delete(workload.Metadata.Annotations, DEPLOYMENT_ORIGINAL_STRATEGY_ANNOTATION)
+
+	if err := r.Client.Update(ctx, deployment); err != nil {
+		return fmt.Errorf("unable to restore the original strategy of [workload=%v] [err=%w]", workload.Ref(), err)
+	}
+
+	if rolloutFailed {
+		r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeWarning, "SurgeStrategyRestored", "Rollout of %v exceeded its progress deadline. Restored its original strategy", workload.Ref())
+	} else {
+		r.Recorder.Eventf(&infisicalSecret, corev1.EventTypeNormal, "SurgeStrategyRestored", "Rollout of %v completed. Restored its original strategy", workload.Ref())
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestSurgeStrategyIsRestoredAfterRollout(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	maxSurge, maxUnavailable := intstr.FromInt(0), intstr.FromInt(1)
+	deploymentWithStrategy := func(name string, strategy v1.DeploymentStrategy) *v1.Deployment {
+		deployment := &v1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1"},
+			},
+			Spec: v1.DeploymentSpec{Replicas: pointer.Int32(2), Strategy: strategy},
+		}
+		deployment.Spec.Template.Annotations = map[string]string{versionKey: "v1"}
+		deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+			Name: "app",
+			EnvFrom: []corev1.EnvFromSource{{
+				SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+			}},
+		}}
+		return deployment
+	}
+
+	originalStrategy := v1.DeploymentStrategy{
+		Type:          v1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &v1.RollingUpdateDeployment{MaxSurge: &maxSurge, MaxUnavailable: &maxUnavailable},
+	}
+	api := deploymentWithStrategy("api", originalStrategy)
+	database := deploymentWithStrategy("database", v1.DeploymentStrategy{Type: v1.RecreateDeploymentStrategyType})
+
+	r := newTestReconciler(managedSecret, api, database)
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+	infisicalSecret.Spec.SurgeRestarts = true
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 2, Restarted: 2}))
+
+	restartedAPI := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(api), restartedAPI)).To(Succeed())
+	g.Expect(restartedAPI.Spec.Strategy.RollingUpdate.MaxSurge.IntValue()).To(Equal(1))
+	g.Expect(restartedAPI.Spec.Strategy.RollingUpdate.MaxUnavailable.IntValue()).To(Equal(0))
+	g.Expect(restartedAPI.Annotations).To(HaveKey(DEPLOYMENT_ORIGINAL_STRATEGY_ANNOTATION))
+
+	// the Recreate strategy may be needed for volumes that cannot be shared between pods
+	restartedDatabase := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(database), restartedDatabase)).To(Succeed())
+	g.Expect(restartedDatabase.Spec.Strategy.Type).To(Equal(v1.RecreateDeploymentStrategyType))
+	g.Expect(restartedDatabase.Annotations).NotTo(HaveKey(DEPLOYMENT_ORIGINAL_STRATEGY_ANNOTATION))
+
+	// the surge strategy is kept while the rollout is in progress
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(api), restartedAPI)).To(Succeed())
+	g.Expect(restartedAPI.Annotations).To(HaveKey(DEPLOYMENT_ORIGINAL_STRATEGY_ANNOTATION))
+
+	restartedAPI.Status.Conditions = []v1.DeploymentCondition{
+		{Type: v1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: PROGRESS_DEADLINE_EXCEEDED_REASON},
+	}
+	g.Expect(r.Client.Update(ctx, restartedAPI)).To(Succeed())
+
+	// a failed rollout restores the original strategy as well
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 2}))
+
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(api), restartedAPI)).To(Succeed())
+	g.Expect(restartedAPI.Spec.Strategy).To(Equal(originalStrategy))
+	g.Expect(restartedAPI.Annotations).NotTo(HaveKey(DEPLOYMENT_ORIGINAL_STRATEGY_ANNOTATION))
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"sync"
+	"time"
+)
+
+// Lets an action happen once per interval for each key, such as recording an event on an object. The zero value is ready to use.
+// Keys which were not allowed within the interval are pruned, so keys of deleted objects do not accumulate
+type intervalThrottle struct {
+	mutex       sync.Mutex
+	lastAllowed map[string]time.Time
+}
+
+// Returns true, and remembers the time, when the key was not allowed within the interval
+func (t *intervalThrottle) allow(key string, interval time.Duration, now time.Time) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.lastAllowed == nil {
+		t.lastAllowed = map[string]time.Time{}
+	}
+
+	for existingKey, lastAllowed := range t.lastAllowed {
+		if now.Sub(lastAllowed) >= interval {
+			delete(t.lastAllowed, existingKey)
+		}
+	}
+
+	if _, allowedRecently := t.lastAllowed[key]; allowedRecently {
+		return false
+	}
+
+	t.lastAllowed[key] = now
+	return true
+}
+
+// Doubles the delay for each consecutive failure of a key, up to the maximum delay. The zero value is ready to use.
+// Keys are forgotten once they succeed, so keys of deleted objects only remain while their last attempt failed
+type exponentialBackoff struct {
+	mutex    sync.Mutex
+	failures map[string]int
+}
+
+// Records a failure of the key and returns how long to wait before the next attempt
+func (b *exponentialBackoff) next(key string, baseDelay time.Duration, maxDelay time.Duration) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.failures == nil {
+		b.failures = map[string]int{}
+	}
+
+	delay := baseDelay
+	for i := 0; i < b.failures[key] && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	b.failures[key]++
+
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
+
+func (b *exponentialBackoff) reset(key string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.failures, key)
+}
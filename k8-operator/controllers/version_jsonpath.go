@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// Prefix of the version extracted from a JSON value of the managed secret, so it never equals a version set through the version annotation
+const JSONPATH_VERSION_PREFIX = "jsonpath:"
+
+// Upper bound for the extracted value in bytes. Larger values are usually a path matching a whole object rather than a version
+const MAX_JSONPATH_VERSION_LENGTH = 1024
+
+// Parses the JSONPath of the version. Both `.version` and `{.version}` are accepted, like kubectl does
+func ParseVersionJSONPath(path string) (*jsonpath.JSONPath, error) {
+	if !strings.HasPrefix(path, "{") {
+		path = "{" + path + "}"
+	}
+
+	parser := jsonpath.New("version")
+	if err := parser.Parse(path); err != nil {
+		return nil, fmt.Errorf("versionJSONPath [path=%v] is not a valid JSONPath: %w", path, err)
+	}
+	return parser, nil
+}
+
+// Extracts the version from the JSON value of a key of the secret. Fails when the key is missing, holds no JSON, the path matches nothing or too much.
+// The extracted value is part of the secret and may be sensitive, so only its keyed hash is used as the version and recorded on workloads
+func (r *InfisicalSecretReconciler) GetJSONPathVersion(secret corev1.Secret, versionJSONPath v1alpha1.VersionJSONPath) (string, error) {
+	parser, err := ParseVersionJSONPath(versionJSONPath.Path)
+	if err != nil {
+		return "", err
+	}
+
+	value, hasKey := secret.Data[versionJSONPath.Key]
+	if !hasKey {
+		return "", fmt.Errorf("managed secret [name=%v] has no [key=%v] to extract the version from", secret.Name, versionJSONPath.Key)
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(value, &document); err != nil {
+		return "", fmt.Errorf("[key=%v] of managed secret [name=%v] does not hold valid JSON: %w", versionJSONPath.Key, secret.Name, err)
+	}
+
+	var version bytes.Buffer
+	if err := parser.Execute(&version, document); err != nil {
+		return "", fmt.Errorf("unable to extract the version from [key=%v] of managed secret [name=%v] with [path=%v]: %w", versionJSONPath.Key, secret.Name, versionJSONPath.Path, err)
+	}
+
+	if version.Len() == 0 {
+		return "", fmt.Errorf("[path=%v] matches an empty version in [key=%v] of managed secret [name=%v]", versionJSONPath.Path, versionJSONPath.Key, secret.Name)
+	}
+
+	if version.Len() > MAX_JSONPATH_VERSION_LENGTH {
+		return "", fmt.Errorf("[path=%v] matches %v bytes in [key=%v] of managed secret [name=%v], more than the %v bytes a version may have", versionJSONPath.Path, version.Len(), versionJSONPath.Key, secret.Name, MAX_JSONPATH_VERSION_LENGTH)
+	}
+
+	hash := r.newSecretDataHash()
+	hash.Write(version.Bytes())
+	return JSONPATH_VERSION_PREFIX + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Replaces the version of the fetched copy of the secret with the one extracted through the JSONPath, so consumers only restart when it changes.
+// Like the content checksum, the version is never written to the secret
+func (r *InfisicalSecretReconciler) useJSONPathAsVersion(secret *corev1.Secret, infisicalSecret v1alpha1.InfisicalSecret) error {
+	if infisicalSecret.Spec.VersionJSONPath == nil {
+		return nil
+	}
+
+	version, err := r.GetJSONPathVersion(*secret, *infisicalSecret.Spec.VersionJSONPath)
+	if err != nil {
+		return err
+	}
+
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[SECRET_VERSION_ANNOTATION] = version
+	return nil
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestGetJSONPathVersion(t *testing.T) {
+	g := NewWithT(t)
+	r := newTestReconciler()
+
+	secret := corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-config"},
+		Data: map[string][]byte{
+			"config.json": []byte(`{"version": "2024-05", "database": {"host": "db"}}`),
+			"plain":       []byte("not json"),
+			"large.json":  []byte(`{"version": "` + strings.Repeat("1", MAX_JSONPATH_VERSION_LENGTH+1) + `"}`),
+		},
+	}
+
+	version, err := r.GetJSONPathVersion(secret, secretsv1alpha1.VersionJSONPath{Key: "config.json", Path: ".version"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(version).To(HavePrefix(JSONPATH_VERSION_PREFIX))
+	// the extracted value is hashed, as it is part of the secret
+	g.Expect(version).NotTo(ContainSubstring("2024-05"))
+
+	bracedVersion, err := r.GetJSONPathVersion(secret, secretsv1alpha1.VersionJSONPath{Key: "config.json", Path: "{.version}"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(bracedVersion).To(Equal(version))
+
+	_, err = r.GetJSONPathVersion(secret, secretsv1alpha1.VersionJSONPath{Key: "config.json", Path: ".version["})
+	g.Expect(err).To(MatchError(ContainSubstring("not a valid JSONPath")))
+
+	_, err = r.GetJSONPathVersion(secret, secretsv1alpha1.VersionJSONPath{Key: "missing.json", Path: ".version"})
+	g.Expect(err).To(MatchError(ContainSubstring("has no [key=missing.json]")))
+
+	_, err = r.GetJSONPathVersion(secret, secretsv1alpha1.VersionJSONPath{Key: "plain", Path: ".version"})
+	g.Expect(err).To(MatchError(ContainSubstring("does not hold valid JSON")))
+
+	_, err = r.GetJSONPathVersion(secret, secretsv1alpha1.VersionJSONPath{Key: "config.json", Path: ".revision"})
+	g.Expect(err).To(MatchError(ContainSubstring("unable to extract the version")))
+
+	_, err = r.GetJSONPathVersion(secret, secretsv1alpha1.VersionJSONPath{Key: "large.json", Path: ".version"})
+	g.Expect(err).To(MatchError(ContainSubstring("more than the 1024 bytes a version may have")))
+}
+
+func TestWorkloadsRestartOnlyWhenExtractedVersionChanges(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".app-config"
+
+	r := newTestReconciler()
+	jsonPathVersion := func(version string) string {
+		secret := corev1.Secret{Data: map[string][]byte{"config.json": []byte(`{"version": "` + version + `"}`)}}
+		extractedVersion, err := r.GetJSONPathVersion(secret, secretsv1alpha1.VersionJSONPath{Key: "config.json", Path: ".version"})
+		g.Expect(err).NotTo(HaveOccurred())
+		return extractedVersion
+	}
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "app-config",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "etag-1"},
+		},
+		Data: map[string][]byte{"config.json": []byte(`{"version": "1", "timeout": 30}`)},
+	}
+
+	deployment := &v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "api",
+			Namespace:   "default",
+			Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: jsonPathVersion("1")},
+		},
+	}
+	deployment.Spec.Template.Annotations = map[string]string{versionKey: jsonPathVersion("1")}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "api",
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "app-config"}},
+		}},
+	}}
+
+	r = newTestReconciler(managedSecret, deployment)
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "app-config"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+	infisicalSecret.Spec.VersionJSONPath = &secretsv1alpha1.VersionJSONPath{Key: "config.json", Path: ".version"}
+
+	updateSecret := func(version string, config string) {
+		secret := &corev1.Secret{}
+		g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(managedSecret), secret)).To(Succeed())
+		secret.Annotations[SECRET_VERSION_ANNOTATION] = version
+		secret.Data["config.json"] = []byte(config)
+		g.Expect(r.Client.Update(ctx, secret)).To(Succeed())
+	}
+
+	// a change of the secret that keeps the embedded version does not restart its consumers
+	updateSecret("etag-2", `{"version": "1", "timeout": 60}`)
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1}))
+
+	updateSecret("etag-3", `{"version": "2", "timeout": 60}`)
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Restarted: 1}))
+
+	restartedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(deployment), restartedDeployment)).To(Succeed())
+	g.Expect(restartedDeployment.Spec.Template.Annotations[versionKey]).To(Equal(jsonPathVersion("2")))
+
+	// a version that cannot be extracted fails the reconcile instead of restarting on every change
+	updateSecret("etag-4", `{"timeout": 60}`)
+	_, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).To(MatchError(ContainSubstring("unable to extract the version")))
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// set on a workload next to the recorded version of the managed secret. Binds the version to the workload and to the data of the secret,
+// so a version annotation edited by hand to claim the workload is up to date can be told apart from one recorded by the operator
+const DEPLOYMENT_SECRET_VERSION_SEAL_ANNOTATION_PREFIX = "secrets.infisical.com/managed-secret-seal"
+
+// Computing the seal requires the values of the secret, which are never stored, and the fingerprint key, which workloads cannot read.
+// Only the hash of the seal is recorded
+func (r *InfisicalSecretReconciler) getVersionSeal(workload Workload, secret corev1.Secret, version string) string {
+	hash := r.newSecretDataHash()
+	hash.Write([]byte(workload.Metadata.UID))
+	hash.Write([]byte{0})
+	hash.Write([]byte(secret.Name))
+	hash.Write([]byte{0})
+	hash.Write([]byte(version))
+	// the data of the secret changes without a new version when the version is extracted from its data, which is not tampering
+	if !strings.HasPrefix(version, JSONPATH_VERSION_PREFIX) {
+		hash.Write([]byte{0})
+		hash.Write([]byte(r.getConsumedKeysHash(nil, secret)))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (r *InfisicalSecretReconciler) recordVersionSeal(workload Workload, secret corev1.Secret) {
+	sealAnnotationKey := fmt.Sprintf("%s.%s", DEPLOYMENT_SECRET_VERSION_SEAL_ANNOTATION_PREFIX, secret.Name)
+	workload.Metadata.Annotations[sealAnnotationKey] = r.getVersionSeal(workload, secret, secret.Annotations[SECRET_VERSION_ANNOTATION])
+}
+
+func getRecordedVersionSeal(workload Workload, secretName string) (string, bool) {
+	seal, isSealed := workload.Metadata.Annotations[fmt.Sprintf("%s.%s", DEPLOYMENT_SECRET_VERSION_SEAL_ANNOTATION_PREFIX, secretName)]
+	return seal, isSealed
+}
+
+// Checks whether the workload claims to use the current version of the secret without the seal the operator records with it.
+// A workload the status lists as sealed must still carry its seal, as removing it would otherwise pass for a workload that was never sealed.
+// Workloads reconciled by operator versions without seals have none yet and are sealed the next time they are restarted or adopted
+func (r *InfisicalSecretReconciler) isRecordedVersionTampered(workload Workload, secret corev1.Secret, infisicalSecret v1alpha1.InfisicalSecret) bool {
+	recordedSeal, isSealed := getRecordedVersionSeal(workload, secret.Name)
+	if !isSealed {
+		return isWorkloadSealed(infisicalSecret.Status.SealedWorkloads, workload)
+	}
+
+	recordedVersion, _ := r.GetRecordedSecretVersion(workload, secret.Name)
+	return recordedSeal != r.getVersionSeal(workload, secret, recordedVersion)
+}
+
+func isWorkloadSealed(sealedWorkloads []string, workload Workload) bool {
+	for _, sealedWorkload := range sealedWorkloads {
+		if sealedWorkload == workload.Ref() {
+			return true
+		}
+	}
+	return false
+}
+
+// Workloads known to be sealed, according to the status or because they carry a seal. Workloads that no longer consume the managed secret are dropped
+func GetSealedWorkloads(previous []string, matchedWorkloads []Workload, secretName string) map[string]bool {
+	sealedWorkloads := map[string]bool{}
+	for _, workload := range matchedWorkloads {
+		if _, isSealed := getRecordedVersionSeal(workload, secretName); isSealed || isWorkloadSealed(previous, workload) {
+			sealedWorkloads[workload.Ref()] = true
+		}
+	}
+	return sealedWorkloads
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestTamperedRecordedVersionRestartsWorkload(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+	sealKey := DEPLOYMENT_SECRET_VERSION_SEAL_ANNOTATION_PREFIX + ".managed-secret"
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v1"},
+		},
+		Data: map[string][]byte{"DB_PASS": []byte("old-password")},
+	}
+
+	deployment := &v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "api",
+			Namespace:   "default",
+			Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true"},
+		},
+	}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "api",
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+		}},
+	}}
+
+	r := newTestReconciler(managedSecret, deployment)
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Restarted: 1}))
+
+	sealedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(deployment), sealedDeployment)).To(Succeed())
+	g.Expect(sealedDeployment.Annotations).To(HaveKey(sealKey))
+
+	// the secret is rotated while the workload is edited by hand to claim it already uses the new version
+	secret := &corev1.Secret{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(managedSecret), secret)).To(Succeed())
+	secret.Annotations[SECRET_VERSION_ANNOTATION] = "v2"
+	secret.Data["DB_PASS"] = []byte("new-password")
+	g.Expect(r.Client.Update(ctx, secret)).To(Succeed())
+
+	sealedDeployment.Annotations[versionKey] = "v2"
+	sealedDeployment.Spec.Template.Annotations[versionKey] = "v2"
+	g.Expect(r.Client.Update(ctx, sealedDeployment)).To(Succeed())
+
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Restarted: 1}))
+
+	var events []string
+	for len(r.Recorder.(*record.FakeRecorder).Events) > 0 {
+		events = append(events, <-r.Recorder.(*record.FakeRecorder).Events)
+	}
+	g.Expect(events).To(ContainElement(ContainSubstring("RecordedVersionMismatch")))
+
+	// the restart seals the new version, so the workload is up to date again
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1}))
+	g.Expect(outcome.SealedWorkloads).To(Equal(map[string]bool{"Deployment/default/api": true}))
+
+	// workloads reconciled before seals were recorded are not mistaken for tampered ones
+	removeSeal := func() {
+		unsealedDeployment := &v1.Deployment{}
+		g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(deployment), unsealedDeployment)).To(Succeed())
+		delete(unsealedDeployment.Annotations, sealKey)
+		g.Expect(r.Client.Update(ctx, unsealedDeployment)).To(Succeed())
+	}
+	removeSeal()
+
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1}))
+
+	// once the status lists the workload as sealed, removing the seal no longer passes for a workload that was never sealed
+	infisicalSecret.Status.SealedWorkloads = []string{"Deployment/default/api"}
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 1, Restarted: 1}))
+
+	resealedDeployment := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(deployment), resealedDeployment)).To(Succeed())
+	g.Expect(resealedDeployment.Annotations).To(HaveKey(sealKey))
+	g.Expect(resealedDeployment.Spec.Template.Annotations[DEPLOYMENT_RELOAD_REASON_ANNOTATION]).To(Equal(RELOAD_REASON_RECORDED_VERSION_MISMATCH))
+}
+
+func TestSealedWorkloadsAreRecordedInStatus(t *testing.T) {
+	g := NewWithT(t)
+
+	outcome := ReconcileOutcome{SealedWorkloads: map[string]bool{"Deployment/default/worker": true, "Deployment/default/api": true}}
+
+	infisicalSecret := &secretsv1alpha1.InfisicalSecret{ObjectMeta: metav1.ObjectMeta{Name: "api-secrets", Namespace: "default"}}
+	infisicalSecret.Status.SealedWorkloads = []string{"Deployment/default/removed"}
+	r := newTestReconciler(infisicalSecret)
+
+	r.SetInfisicalAutoRedeploymentReady(context.Background(), infisicalSecret, outcome, nil)
+	g.Expect(infisicalSecret.Status.SealedWorkloads).To(Equal([]string{"Deployment/default/api", "Deployment/default/worker"}))
+}
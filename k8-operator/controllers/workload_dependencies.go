@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+// Comma separated names of workloads in the same namespace that have to finish rolling out the new secret version before this workload is restarted
+const DEPENDS_ON_ANNOTATION = "secrets.infisical.com/depends-on"
+
+// Returns the workloads the workload depends on. Dependencies that are not part of the given workloads do not consume the managed secret and are ignored
+func getWorkloadDependencies(workload Workload, workloads []Workload) []Workload {
+	dependsOn, exists := workload.Metadata.Annotations[DEPENDS_ON_ANNOTATION]
+	if !exists {
+		return nil
+	}
+
+	var dependencies []Workload
+	for _, name := range strings.Split(dependsOn, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		for _, candidate := range workloads {
+			if candidate.Metadata.Namespace == workload.Metadata.Namespace && candidate.Metadata.Name == name && candidate.Ref() != workload.Ref() {
+				dependencies = append(dependencies, candidate)
+			}
+		}
+	}
+	return dependencies
+}
+
+// Sorts the workloads topologically by their dependencies and groups them into waves. A workload only depends on workloads of earlier waves,
+// so independent chains progress side by side. Returns an error naming the workloads involved when the dependencies form a cycle
+func OrderWorkloadsByDependencies(workloads []Workload) ([][]Workload, error) {
+	dependencies := map[string][]Workload{}
+	for _, workload := range workloads {
+		dependencies[workload.Ref()] = getWorkloadDependencies(workload, workloads)
+	}
+
+	var waves [][]Workload
+	ordered := map[string]bool{}
+	for len(ordered) < len(workloads) {
+		var wave []Workload
+		for _, workload := range workloads {
+			if ordered[workload.Ref()] || !areDependenciesOrdered(dependencies[workload.Ref()], ordered) {
+				continue
+			}
+			wave = append(wave, workload)
+		}
+
+		if len(wave) == 0 {
+			return nil, fmt.Errorf("unable to order workloads by the %v annotation because of the dependency cycle [cycle=%v]", DEPENDS_ON_ANNOTATION, findDependencyCycle(workloads, dependencies, ordered))
+		}
+
+		for _, workload := range wave {
+			ordered[workload.Ref()] = true
+		}
+		waves = append(waves, wave)
+	}
+
+	return waves, nil
+}
+
+func areDependenciesOrdered(dependencies []Workload, ordered map[string]bool) bool {
+	for _, dependency := range dependencies {
+		if !ordered[dependency.Ref()] {
+			return false
+		}
+	}
+	return true
+}
+
+// Every workload that could not be ordered has a dependency that could not be ordered either, so following them from any such workload leads into a cycle
+func findDependencyCycle(workloads []Workload, dependencies map[string][]Workload, ordered map[string]bool) string {
+	var path []string
+	visited := map[string]int{}
+
+	var current string
+	for _, workload := range workloads {
+		if !ordered[workload.Ref()] {
+			current = workload.Ref()
+			break
+		}
+	}
+
+	for {
+		if index, seen := visited[current]; seen {
+			return strings.Join(append(path[index:], current), " -> ")
+		}
+
+		visited[current] = len(path)
+		path = append(path, current)
+
+		for _, dependency := range dependencies[current] {
+			if !ordered[dependency.Ref()] {
+				current = dependency.Ref()
+				break
+			}
+		}
+	}
+}
+
+// Returns the dependencies of the workload that have not settled on the current version of the managed secret yet
+func getUnsettledDependencies(dependencies []Workload, settledWorkloads map[string]bool) []string {
+	var unsettled []string
+	for _, dependency := range dependencies {
+		if !settledWorkloads[dependency.Ref()] {
+			unsettled = append(unsettled, dependency.Ref())
+		}
+	}
+	return unsettled
+}
+
+// The secret version the workload was last restarted with. Workloads restarted through restartedAt only have their version recorded in the status
+func getRestartedVersion(workload Workload, infisicalSecret v1alpha1.InfisicalSecret, annotationKey string) string {
+	if infisicalSecret.Spec.RestartedAtOnly {
+		return infisicalSecret.Status.ReloadedWorkloads[workload.Ref()]
+	}
+	return workload.PodTemplate.Annotations[annotationKey]
+}
+
+// A workload that does not need a restart has settled once the rollout it was last restarted with has completed, so its dependents can follow
+func (r *InfisicalSecretReconciler) isWorkloadSettled(ctx context.Context, workload Workload, infisicalSecret v1alpha1.InfisicalSecret, annotationKey string, secretVersion string) (bool, error) {
+	if getRestartedVersion(workload, infisicalSecret, annotationKey) != secretVersion {
+		return true, nil
+	}
+
+	rolloutAnnotationKey, rolloutAnnotationValue := getRolloutAnnotation(workload, annotationKey, infisicalSecret)
+	return r.IsWorkloadRolloutComplete(ctx, workload, rolloutAnnotationKey, rolloutAnnotationValue)
+}
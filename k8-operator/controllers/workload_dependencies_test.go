@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+)
+
+func TestOrderWorkloadsByDependencies(t *testing.T) {
+	g := NewWithT(t)
+
+	deploymentDependingOn := func(name string, dependsOn string) Workload {
+		deployment := &v1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		if dependsOn != "" {
+			deployment.Annotations = map[string]string{DEPENDS_ON_ANNOTATION: dependsOn}
+		}
+		return NewDeploymentWorkload(deployment)
+	}
+
+	refs := func(waves [][]Workload) [][]string {
+		var refs [][]string
+		for _, wave := range waves {
+			var waveRefs []string
+			for _, workload := range wave {
+				waveRefs = append(waveRefs, workload.Metadata.Name)
+			}
+			refs = append(refs, waveRefs)
+		}
+		return refs
+	}
+
+	// two independent chains, one of them depending on a workload that does not consume the managed secret
+	waves, err := OrderWorkloadsByDependencies([]Workload{
+		deploymentDependingOn("frontend", "api, cache"),
+		deploymentDependingOn("api", "db"),
+		deploymentDependingOn("db", ""),
+		deploymentDependingOn("worker", "queue"),
+		deploymentDependingOn("queue", "unrelated"),
+		deploymentDependingOn("cache", ""),
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(refs(waves)).To(Equal([][]string{{"db", "queue", "cache"}, {"api", "worker"}, {"frontend"}}))
+
+	_, err = OrderWorkloadsByDependencies([]Workload{
+		deploymentDependingOn("frontend", "api"),
+		deploymentDependingOn("api", "db"),
+		deploymentDependingOn("db", "frontend"),
+		deploymentDependingOn("worker", ""),
+	})
+	g.Expect(err).To(MatchError(ContainSubstring("Deployment/default/frontend -> Deployment/default/api -> Deployment/default/db -> Deployment/default/frontend")))
+}
+
+func TestDependentIsRestartedOnceDependencyRolledOut(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	consumingTemplate := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{versionKey: "v1"}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: "app",
+			EnvFrom: []corev1.EnvFromSource{{
+				SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+			}},
+		}}},
+	}
+
+	database := &v1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "db",
+			Namespace:   "default",
+			Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1"},
+		},
+		Spec: v1.StatefulSetSpec{Template: *consumingTemplate.DeepCopy()},
+	}
+
+	api := &v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "api",
+			Namespace:   "default",
+			Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: "v1", DEPENDS_ON_ANNOTATION: "db"},
+		},
+		Spec: v1.DeploymentSpec{Template: *consumingTemplate.DeepCopy()},
+	}
+
+	r := newTestReconciler(managedSecret, database, api)
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 2, Restarted: 1, Deferred: 1}))
+
+	// the rollout of the database is still in progress
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 2, Deferred: 1}))
+
+	restartedDatabase := &v1.StatefulSet{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(database), restartedDatabase)).To(Succeed())
+	restartedDatabase.Status = v1.StatefulSetStatus{
+		ObservedGeneration: restartedDatabase.Generation,
+		CurrentRevision:    "db-2",
+		UpdateRevision:     "db-2",
+		UpdatedReplicas:    1,
+		AvailableReplicas:  1,
+	}
+	g.Expect(r.Client.Update(ctx, restartedDatabase)).To(Succeed())
+
+	outcome, err = r.ReconcileWorkloadsWithManagedSecrets(ctx, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 2, Restarted: 1}))
+
+	restartedAPI := &v1.Deployment{}
+	g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(api), restartedAPI)).To(Succeed())
+	g.Expect(restartedAPI.Spec.Template.Annotations[versionKey]).To(Equal("v2"))
+}
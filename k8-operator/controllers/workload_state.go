@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// JSON object mapping the name of each managed secret a workload consumes to the version it was last reconciled with, such as {"managed-secret":"v2"}.
+// Used instead of one annotation per managed secret on the workload when annotations are consolidated
+const WORKLOAD_STATE_ANNOTATION = "secrets.infisical.com/state"
+
+// Returns the versions recorded in the state annotation of the workload. An unreadable state is treated as empty, so the versions are recorded again
+func getWorkloadState(workload Workload) map[string]string {
+	state := map[string]string{}
+
+	rawState, exists := workload.Metadata.Annotations[WORKLOAD_STATE_ANNOTATION]
+	if !exists {
+		return state
+	}
+
+	if err := json.Unmarshal([]byte(rawState), &state); err != nil {
+		fmt.Printf("ignoring invalid [annotation=%v] of [workload=%v] [err=%v]\n", WORKLOAD_STATE_ANNOTATION, workload.Ref(), err)
+		return map[string]string{}
+	}
+	return state
+}
+
+func setWorkloadState(workload Workload, state map[string]string) {
+	if len(state) == 0 {
+		delete(workload.Metadata.Annotations, WORKLOAD_STATE_ANNOTATION)
+		return
+	}
+
+	// map keys are marshalled in sorted order, so the annotation only changes when a version does
+	rawState, _ := json.Marshal(state)
+	workload.Metadata.Annotations[WORKLOAD_STATE_ANNOTATION] = string(rawState)
+}
+
+// Returns the version of the managed secret the workload was last reconciled with. Both the per secret annotation and the state annotation are read,
+// preferring the one in use, so toggling the consolidation does not lose track of versions recorded before
+func (r *InfisicalSecretReconciler) GetRecordedSecretVersion(workload Workload, secretName string) (string, bool) {
+	annotationKey := fmt.Sprintf("%s.%s", DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX, secretName)
+	annotationVersion, hasAnnotation := workload.Metadata.Annotations[annotationKey]
+	stateVersion, hasState := getWorkloadState(workload)[secretName]
+
+	if (r.ConsolidateWorkloadAnnotations && hasState) || !hasAnnotation {
+		return stateVersion, hasState
+	}
+	return annotationVersion, hasAnnotation
+}
+
+// Records the version of the managed secret on the workload in the annotation in use, removing it from the other one
+func (r *InfisicalSecretReconciler) recordSecretVersion(workload Workload, secretName string, version string) {
+	annotationKey := fmt.Sprintf("%s.%s", DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX, secretName)
+	state := getWorkloadState(workload)
+
+	if r.ConsolidateWorkloadAnnotations {
+		state[secretName] = version
+		delete(workload.Metadata.Annotations, annotationKey)
+	} else {
+		delete(state, secretName)
+		workload.Metadata.Annotations[annotationKey] = version
+	}
+
+	setWorkloadState(workload, state)
+}
+
+// Checks if the version of the managed secret is recorded in an annotation other than the one in use
+func (r *InfisicalSecretReconciler) isSecretVersionMisplaced(workload Workload, secretName string) bool {
+	annotationKey := fmt.Sprintf("%s.%s", DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX, secretName)
+	if r.ConsolidateWorkloadAnnotations {
+		_, hasAnnotation := workload.Metadata.Annotations[annotationKey]
+		return hasAnnotation
+	}
+
+	_, hasState := getWorkloadState(workload)[secretName]
+	return hasState
+}
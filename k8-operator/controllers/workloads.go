@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	"github.com/Infisical/infisical/k8-operator/packages/audit"
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const WORKLOAD_KIND_DEPLOYMENT = "Deployment"
+const WORKLOAD_KIND_STATEFUL_SET = "StatefulSet"
+const WORKLOAD_KIND_DAEMON_SET = "DaemonSet"
+
+// Gives uniform access to the workload kinds that roll out new pods when their pod template changes.
+// Metadata, PodTemplate and Selector point into Object, so changes made through them are sent when Object is updated
+type Workload struct {
+	Kind   string
+	Object client.Object
+	// Metadata of the workload itself. Changes to it never roll out new pods
+	Metadata *metav1.ObjectMeta
+	// The pod template whose changes the controller of the kind rolls out. Restart annotations are only ever set here, so kinds with more than
+	// one template, or with patches applied on top of a template, must point it at the effective template its controller watches.
+	// Otherwise the restart is recorded on the workload but no rollout happens
+	PodTemplate *corev1.PodTemplateSpec
+	Selector    *metav1.LabelSelector
+
+	// shared by the workloads reconciled for the same InfisicalSecret. nil outside of ReconcileWorkloadsWithManagedSecrets
+	fingerprints *podSpecFingerprints
+}
+
+func NewDeploymentWorkload(deployment *v1.Deployment) Workload {
+	return Workload{
+		Kind:        WORKLOAD_KIND_DEPLOYMENT,
+		Object:      deployment,
+		Metadata:    &deployment.ObjectMeta,
+		PodTemplate: &deployment.Spec.Template,
+		Selector:    deployment.Spec.Selector,
+	}
+}
+
+func NewStatefulSetWorkload(statefulSet *v1.StatefulSet) Workload {
+	return Workload{
+		Kind:        WORKLOAD_KIND_STATEFUL_SET,
+		Object:      statefulSet,
+		Metadata:    &statefulSet.ObjectMeta,
+		PodTemplate: &statefulSet.Spec.Template,
+		Selector:    statefulSet.Spec.Selector,
+	}
+}
+
+func NewDaemonSetWorkload(daemonSet *v1.DaemonSet) Workload {
+	return Workload{
+		Kind:        WORKLOAD_KIND_DAEMON_SET,
+		Object:      daemonSet,
+		Metadata:    &daemonSet.ObjectMeta,
+		PodTemplate: &daemonSet.Spec.Template,
+		Selector:    daemonSet.Spec.Selector,
+	}
+}
+
+// Kind, namespace and name of the workload, such as Deployment/default/api
+func (w Workload) Ref() string {
+	return fmt.Sprintf("%s/%s/%s", w.Kind, w.Metadata.Namespace, w.Metadata.Name)
+}
+
+// Lists the Deployments, StatefulSets and DaemonSets in the namespace
+func (r *InfisicalSecretReconciler) ListWorkloads(ctx context.Context, namespace string) ([]Workload, error) {
+	// an empty namespace lists the workloads of the whole cluster
+	if namespace == "" {
+		return nil, fmt.Errorf("refusing to list workloads without a namespace")
+	}
+
+	var workloads []Workload
+
+	listOfDeployments := &v1.DeploymentList{}
+	err := r.Client.List(ctx, listOfDeployments, &client.ListOptions{Namespace: namespace})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get deployments in the [namespace=%v] [err=%w]", namespace, err)
+	}
+	for i := range listOfDeployments.Items {
+		workloads = append(workloads, NewDeploymentWorkload(&listOfDeployments.Items[i]))
+	}
+
+	listOfStatefulSets := &v1.StatefulSetList{}
+	err = r.Client.List(ctx, listOfStatefulSets, &client.ListOptions{Namespace: namespace})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get stateful sets in the [namespace=%v] [err=%w]", namespace, err)
+	}
+	for i := range listOfStatefulSets.Items {
+		workloads = append(workloads, NewStatefulSetWorkload(&listOfStatefulSets.Items[i]))
+	}
+
+	listOfDaemonSets := &v1.DaemonSetList{}
+	err = r.Client.List(ctx, listOfDaemonSets, &client.ListOptions{Namespace: namespace})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get daemon sets in the [namespace=%v] [err=%w]", namespace, err)
+	}
+	for i := range listOfDaemonSets.Items {
+		workloads = append(workloads, NewDaemonSetWorkload(&listOfDaemonSets.Items[i]))
+	}
+
+	return workloads, nil
+}
+
+// Orders the workloads so the most recently changed ones come first, as workloads being actively deployed are the ones most likely waiting for the
+// new secret. Workloads changed at the same time keep their order. Resource versions are opaque to clients, so the times of the workload are compared instead
+func SortWorkloadsByLastModified(workloads []Workload) {
+	sort.SliceStable(workloads, func(i, j int) bool {
+		return getWorkloadLastModified(workloads[j]).Before(getWorkloadLastModified(workloads[i]))
+	})
+}
+
+// The latest write recorded in the managed fields of the workload, or its creation when it has none
+func getWorkloadLastModified(workload Workload) time.Time {
+	lastModified := workload.Metadata.CreationTimestamp.Time
+	for _, managedFields := range workload.Metadata.ManagedFields {
+		if managedFields.Time != nil && managedFields.Time.After(lastModified) {
+			lastModified = managedFields.Time.Time
+		}
+	}
+	return lastModified
+}
+
+// What happened to the workloads of a single kind during a reconcile
+type WorkloadCounts struct {
+	// Workloads with auto reload enabled which consume the managed secret
+	Matched   int
+	Restarted int
+	Adopted   int
+	Skipped   int
+	Deferred  int
+	Failed    int
+}
+
+func (c *WorkloadCounts) add(other WorkloadCounts) {
+	c.Matched += other.Matched
+	c.Restarted += other.Restarted
+	c.Adopted += other.Adopted
+	c.Skipped += other.Skipped
+	c.Deferred += other.Deferred
+	c.Failed += other.Failed
+}
+
+// Result of reconciling all workloads consuming a managed secret, in total and broken down per workload kind
+type ReconcileOutcome struct {
+	Total  WorkloadCounts
+	ByKind map[string]WorkloadCounts
+	// Error of every workload that failed to reload, keyed by its Ref
+	Failures map[string]string
+	// Time at which a blackout window lets restarts resume. Zero when no window is open
+	RestartsPermittedAt time.Time
+	// Earliest time the restart window of a workload waiting for it opens. Zero when no workload waits for its restart window
+	NextRestartWindow time.Time
+	// Progress of restarting workloads in batches. Nil when batches are disabled
+	ReloadBatches *v1alpha1.ReloadBatchStatus
+	// Hashes of the keys of the managed secret and the keys changed in its current version. Nil unless restarts are limited to consumed keys
+	SecretKeyHashes *v1alpha1.SecretKeyHashes
+	// Progress of the Jobs run before and after the restarts. Nil when the Job is not configured or was not needed in this reconcile
+	PreRestartJob  *v1alpha1.RestartJobStatus
+	PostRestartJob *v1alpha1.RestartJobStatus
+	// Checksum of the data of the managed secret, when it carries no version annotation and its checksum is used as its version
+	ContentChecksum string
+	// Version of the managed secret each matched workload was last reloaded at, keyed by its Ref. Nil unless restarts only use the restartedAt annotation
+	ReloadedWorkloads map[string]string
+	// Workloads carrying a version seal recorded by the operator, keyed by their Ref. Nil when restarts only use the restartedAt annotation
+	SealedWorkloads map[string]bool
+	// Workloads whose restart was held back in this reconcile, keyed by their Ref. Nil when the reconcile stopped before the workloads were reconciled
+	HeldWorkloads map[string]v1alpha1.WorkloadHold
+}
+
+func (o *ReconcileOutcome) recordRestartWindow(opensAt time.Time) {
+	if !opensAt.IsZero() && (o.NextRestartWindow.IsZero() || opensAt.Before(o.NextRestartWindow)) {
+		o.NextRestartWindow = opensAt
+	}
+}
+
+func (o *ReconcileOutcome) record(kind string, counts WorkloadCounts) {
+	if o.ByKind == nil {
+		o.ByKind = map[string]WorkloadCounts{}
+	}
+
+	kindCounts := o.ByKind[kind]
+	kindCounts.add(counts)
+	o.ByKind[kind] = kindCounts
+	o.Total.add(counts)
+}
+
+func (o *ReconcileOutcome) recordFailure(workload Workload, err error) {
+	if o.Failures == nil {
+		o.Failures = map[string]string{}
+	}
+
+	o.Failures[workload.Ref()] = err.Error()
+	o.record(workload.Kind, WorkloadCounts{Failed: 1})
+}
+
+// The decision made for a workload reconciled in the background
+type workloadResult struct {
+	workload Workload
+	secret   corev1.Secret
+	decision string
+	err      error
+}
+
+func (o *ReconcileOutcome) recordWorkloadResult(result workloadResult) {
+	if result.err != nil {
+		fmt.Printf("unable to reconcile [workload=%v]. Will try next requeue [err=%v]\n", result.workload.Ref(), result.err)
+		o.recordFailure(result.workload, result.err)
+		return
+	}
+
+	switch result.decision {
+	case audit.DECISION_RESTARTED:
+		o.record(result.workload.Kind, WorkloadCounts{Restarted: 1})
+	case audit.DECISION_ADOPTED:
+		o.record(result.workload.Kind, WorkloadCounts{Adopted: 1})
+	case audit.DECISION_SKIPPED:
+		o.record(result.workload.Kind, WorkloadCounts{Skipped: 1})
+	}
+
+	if o.ReloadedWorkloads != nil && (result.decision == audit.DECISION_RESTARTED || result.decision == audit.DECISION_ADOPTED) {
+		o.ReloadedWorkloads[result.workload.Ref()] = result.secret.Annotations[SECRET_VERSION_ANNOTATION]
+	}
+
+	if o.SealedWorkloads != nil && (result.decision == audit.DECISION_RESTARTED || result.decision == audit.DECISION_ADOPTED) {
+		o.SealedWorkloads[result.workload.Ref()] = true
+	}
+}
+
+// Describes one of the counts per kind, such as "2 Deployment, 1 StatefulSet"
+func (o ReconcileOutcome) Breakdown(count func(WorkloadCounts) int) string {
+	kinds := make([]string, 0, len(o.ByKind))
+	for kind := range o.ByKind {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	var parts []string
+	for _, kind := range kinds {
+		if value := count(o.ByKind[kind]); value > 0 {
+			parts = append(parts, fmt.Sprintf("%v %s", value, kind))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
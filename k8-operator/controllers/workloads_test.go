@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
+	"github.com/Infisical/infisical/k8-operator/packages/audit"
+)
+
+func TestReconcileOutcomeAcrossWorkloadKinds(t *testing.T) {
+	g := NewWithT(t)
+
+	versionKey := DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX + ".managed-secret"
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	consumingTemplate := func(version string) corev1.PodTemplateSpec {
+		return corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{versionKey: version}},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name: "app",
+				EnvFrom: []corev1.EnvFromSource{{
+					SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+				}},
+			}}},
+		}
+	}
+
+	workloadMetadata := func(name string, version string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "default",
+			Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", versionKey: version},
+		}
+	}
+
+	r := newTestReconciler(
+		managedSecret,
+		&v1.Deployment{ObjectMeta: workloadMetadata("api", "v1"), Spec: v1.DeploymentSpec{Template: consumingTemplate("v1")}},
+		&v1.Deployment{ObjectMeta: workloadMetadata("worker", "v2"), Spec: v1.DeploymentSpec{Template: consumingTemplate("v2")}},
+		&v1.StatefulSet{ObjectMeta: workloadMetadata("db", "v1"), Spec: v1.StatefulSetSpec{Template: consumingTemplate("v1")}},
+		&v1.DaemonSet{ObjectMeta: workloadMetadata("agent", "v1"), Spec: v1.DaemonSetSpec{Template: consumingTemplate("v1")}},
+	)
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	outcome, err := r.ReconcileWorkloadsWithManagedSecrets(context.Background(), infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(outcome.Total).To(Equal(WorkloadCounts{Matched: 4, Restarted: 3}))
+	g.Expect(outcome.ByKind).To(Equal(map[string]WorkloadCounts{
+		WORKLOAD_KIND_DEPLOYMENT:   {Matched: 2, Restarted: 1},
+		WORKLOAD_KIND_STATEFUL_SET: {Matched: 1, Restarted: 1},
+		WORKLOAD_KIND_DAEMON_SET:   {Matched: 1, Restarted: 1},
+	}))
+	g.Expect(outcome.Breakdown(func(c WorkloadCounts) int { return c.Matched })).To(Equal("1 DaemonSet, 2 Deployment, 1 StatefulSet"))
+
+	statefulSet := &v1.StatefulSet{}
+	g.Expect(r.Client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "db"}, statefulSet)).To(Succeed())
+	g.Expect(statefulSet.Spec.Template.Annotations[versionKey]).To(Equal("v2"))
+}
+
+// Pod template consuming the managed secret and metadata of a workload whose restart is forced, so every restart annotation is written
+func newForcedRestartWorkload(name string) (metav1.ObjectMeta, corev1.PodTemplateSpec) {
+	metadata := metav1.ObjectMeta{
+		Name:        name,
+		Namespace:   "default",
+		Annotations: map[string]string{AUTO_RELOAD_DEPLOYMENT_ANNOTATION: "true", FORCE_RELOAD_DEPLOYMENT_ANNOTATION: "true"},
+	}
+	template := corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: "app",
+			EnvFrom: []corev1.EnvFromSource{{
+				SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-secret"}},
+			}},
+		}}},
+	}
+	return metadata, template
+}
+
+// Restarts the workload and returns the annotations of the pod template its controller watches, read from the stored object
+func restartAndGetRolloutTemplateAnnotations(g *WithT, workload Workload, stored client.Object, rolloutTemplate func() *corev1.PodTemplateSpec) map[string]string {
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+	r := newTestReconciler(managedSecret, workload.Object)
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	decision, err := r.ReconcileWorkload(context.Background(), workload, *managedSecret, infisicalSecret)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(decision).To(Equal(audit.DECISION_RESTARTED))
+
+	g.Expect(r.Client.Get(context.Background(), client.ObjectKeyFromObject(workload.Object), stored)).To(Succeed())
+	g.Expect(stored.GetAnnotations()).NotTo(HaveKey(RESTARTED_AT_ANNOTATION))
+	return rolloutTemplate().Annotations
+}
+
+func TestDeploymentRestartAnnotationsLandOnRolloutTemplate(t *testing.T) {
+	g := NewWithT(t)
+
+	metadata, template := newForcedRestartWorkload("api")
+	deployment := &v1.Deployment{ObjectMeta: metadata, Spec: v1.DeploymentSpec{Template: template}}
+
+	// the Deployment controller creates a new ReplicaSet when .spec.template changes
+	stored := &v1.Deployment{}
+	annotations := restartAndGetRolloutTemplateAnnotations(g, NewDeploymentWorkload(deployment), stored, func() *corev1.PodTemplateSpec { return &stored.Spec.Template })
+	g.Expect(annotations).To(HaveKeyWithValue(DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX+".managed-secret", "v2"))
+	g.Expect(annotations).To(HaveKey(RESTARTED_AT_ANNOTATION))
+}
+
+func TestStatefulSetRestartAnnotationsLandOnRolloutTemplate(t *testing.T) {
+	g := NewWithT(t)
+
+	metadata, template := newForcedRestartWorkload("db")
+	statefulSet := &v1.StatefulSet{ObjectMeta: metadata, Spec: v1.StatefulSetSpec{Template: template}}
+
+	// the StatefulSet controller creates a new controller revision when .spec.template changes
+	stored := &v1.StatefulSet{}
+	annotations := restartAndGetRolloutTemplateAnnotations(g, NewStatefulSetWorkload(statefulSet), stored, func() *corev1.PodTemplateSpec { return &stored.Spec.Template })
+	g.Expect(annotations).To(HaveKeyWithValue(DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX+".managed-secret", "v2"))
+	g.Expect(annotations).To(HaveKey(RESTARTED_AT_ANNOTATION))
+}
+
+func TestDaemonSetRestartAnnotationsLandOnRolloutTemplate(t *testing.T) {
+	g := NewWithT(t)
+
+	metadata, template := newForcedRestartWorkload("agent")
+	daemonSet := &v1.DaemonSet{ObjectMeta: metadata, Spec: v1.DaemonSetSpec{Template: template}}
+
+	// the DaemonSet controller creates a new controller revision when .spec.template changes
+	stored := &v1.DaemonSet{}
+	annotations := restartAndGetRolloutTemplateAnnotations(g, NewDaemonSetWorkload(daemonSet), stored, func() *corev1.PodTemplateSpec { return &stored.Spec.Template })
+	g.Expect(annotations).To(HaveKeyWithValue(DEPLOYMENT_SECRET_NAME_ANNOTATION_PREFIX+".managed-secret", "v2"))
+	g.Expect(annotations).To(HaveKey(RESTARTED_AT_ANNOTATION))
+}
+
+func TestSortWorkloadsByLastModified(t *testing.T) {
+	g := NewWithT(t)
+
+	now := time.Now()
+	deploymentChangedAt := func(name string, created time.Time, updated ...time.Time) Workload {
+		deployment := &v1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", CreationTimestamp: metav1.NewTime(created)}}
+		for _, updatedAt := range updated {
+			updateTime := metav1.NewTime(updatedAt)
+			deployment.ManagedFields = append(deployment.ManagedFields, metav1.ManagedFieldsEntry{Manager: "kubectl", Operation: metav1.ManagedFieldsOperationUpdate, Time: &updateTime})
+		}
+		return NewDeploymentWorkload(deployment)
+	}
+
+	workloads := []Workload{
+		deploymentChangedAt("stable", now.Add(-72*time.Hour)),
+		deploymentChangedAt("being-deployed", now.Add(-72*time.Hour), now.Add(-48*time.Hour), now.Add(-time.Minute)),
+		deploymentChangedAt("new", now.Add(-time.Hour)),
+		deploymentChangedAt("also-stable", now.Add(-72*time.Hour)),
+	}
+
+	SortWorkloadsByLastModified(workloads)
+
+	var refs []string
+	for _, workload := range workloads {
+		refs = append(refs, workload.Ref())
+	}
+	g.Expect(refs).To(Equal([]string{"Deployment/default/being-deployed", "Deployment/default/new", "Deployment/default/stable", "Deployment/default/also-stable"}))
+}
+
+// Lists like an API server that does not respond to listing workloads before the request times out
+type hangingListClient struct {
+	client.Client
+}
+
+func (c *hangingListClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if _, isWorkloadList := list.(*v1.DeploymentList); isWorkloadList {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+func TestReconcileTimeoutWhileListingWorkloads(t *testing.T) {
+	g := NewWithT(t)
+
+	managedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "managed-secret",
+			Namespace:   "default",
+			Annotations: map[string]string{SECRET_VERSION_ANNOTATION: "v2"},
+		},
+	}
+
+	r := newTestReconciler(managedSecret)
+	r.Client = &hangingListClient{Client: r.Client}
+	r.DefaultReconcileTimeout = 50 * time.Millisecond
+
+	infisicalSecret := secretsv1alpha1.InfisicalSecret{}
+	infisicalSecret.Spec.ManagedSecretReference.SecretName = "managed-secret"
+	infisicalSecret.Spec.ManagedSecretReference.SecretNamespace = "default"
+
+	// the timeout is recognized through the wrapped listing error, so Reconcile requeues to continue with the remaining workloads
+	_, err := r.ReconcileWorkloadsWithManagedSecrets(context.Background(), infisicalSecret)
+	g.Expect(err).To(MatchError(context.DeadlineExceeded))
+	g.Expect(err).To(MatchError(ContainSubstring("unable to get deployments in the [namespace=default]")))
+}
+
+func TestConsecutiveReconcileTimeoutsBackOff(t *testing.T) {
+	g := NewWithT(t)
+
+	r := newTestReconciler()
+	nextRequeueTime := func(key string) time.Duration {
+		return r.redeploymentTimeouts.next(key, REDEPLOYMENT_TIMEOUT_REQUEUE_TIME, REDEPLOYMENT_TIMEOUT_MAX_REQUEUE_TIME)
+	}
+
+	g.Expect(nextRequeueTime("default/app-secrets")).To(Equal(time.Second))
+	g.Expect(nextRequeueTime("default/app-secrets")).To(Equal(2 * time.Second))
+	g.Expect(nextRequeueTime("default/app-secrets")).To(Equal(4 * time.Second))
+	// other InfisicalSecrets back off on their own
+	g.Expect(nextRequeueTime("default/other-secrets")).To(Equal(time.Second))
+
+	for i := 0; i < 20; i++ {
+		nextRequeueTime("default/app-secrets")
+	}
+	g.Expect(nextRequeueTime("default/app-secrets")).To(Equal(REDEPLOYMENT_TIMEOUT_MAX_REQUEUE_TIME))
+
+	// a reconcile finishing within its timeout starts over
+	r.redeploymentTimeouts.reset("default/app-secrets")
+	g.Expect(nextRequeueTime("default/app-secrets")).To(Equal(time.Second))
+}
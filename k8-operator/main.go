@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -12,11 +14,13 @@ import (
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	secretsv1alpha1 "github.com/Infisical/infisical/k8-operator/api/v1alpha1"
 	"github.com/Infisical/infisical/k8-operator/controllers"
+	"github.com/Infisical/infisical/k8-operator/packages/audit"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -36,11 +40,71 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var deferRestartsDuringDrain bool
+	var drainUnschedulableNodeThreshold int
+	var drainUnschedulableNodePercentage int
+	var enablePodDeletion bool
+	var preflightWorkloadPermissions bool
+	var allowCrossNamespaceReferences bool
+	var reconcileTimeout time.Duration
+	var adoptWorkloadsOnFirstObservation bool
+	var consolidateWorkloadAnnotations bool
+	var followExternalSecrets bool
+	var defaultEmptySecretNamespace bool
+	var maxConcurrentReconciles int
+	var maxConcurrentReconcilesPerNamespace int
+	var auditSinkType string
+	var auditFilePath string
+	var auditWebhookURL string
+	var auditChainHeadPath string
+	var enableRestartJobs bool
+	var fingerprintKeyNamespace string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&deferRestartsDuringDrain, "defer-restarts-during-drain", false,
+		"Defer workload restarts triggered by secret rotation while the cluster is draining nodes.")
+	flag.IntVar(&drainUnschedulableNodeThreshold, "drain-unschedulable-node-threshold", 1,
+		"Number of unschedulable nodes at which the cluster is considered to be under maintenance. Set to 0 to disable.")
+	flag.IntVar(&drainUnschedulableNodePercentage, "drain-unschedulable-node-percentage", 0,
+		"Percentage of unschedulable nodes at which the cluster is considered to be under maintenance. Set to 0 to disable.")
+	flag.BoolVar(&enablePodDeletion, "enable-pod-deletion", false,
+		"Delete outdated pods consuming a managed secret which are not part of a Deployment, StatefulSet or DaemonSet. Pods without a controller must opt in with the secrets.infisical.com/delete-on-reload annotation.")
+	flag.BoolVar(&preflightWorkloadPermissions, "preflight-workload-permissions", true,
+		"Check once per namespace whether the operator may update workloads before restarting outdated ones, and skip forbidden namespaces with a single warning event.")
+	flag.BoolVar(&allowCrossNamespaceReferences, "allow-cross-namespace-references", false,
+		"Allow InfisicalSecrets to restart workloads in namespaces other than their own. InfisicalSecrets with such references still sync their secrets, but redeploy no workloads without it.")
+	flag.DurationVar(&reconcileTimeout, "reconcile-timeout", 0,
+		"Default upper bound for reconciling the workloads of a single InfisicalSecret, e.g. 30s. Set to 0 to disable.")
+	flag.BoolVar(&adoptWorkloadsOnFirstObservation, "adopt-workloads-on-first-observation", false,
+		"Record the current secret version on workloads that were never reconciled before instead of restarting them. Prevents a restart storm when the operator is first installed.")
+	flag.BoolVar(&consolidateWorkloadAnnotations, "consolidate-workload-annotations", false,
+		"Record the versions of all managed secrets a workload consumes in the single secrets.infisical.com/state annotation instead of one version annotation per secret. The other annotations per secret, such as the seal and the identity, and the annotations of the pod template are still recorded separately.")
+	flag.BoolVar(&defaultEmptySecretNamespace, "default-empty-secret-namespace", true,
+		"Default an empty managedSecretReference.secretNamespace to the namespace of the InfisicalSecret. When disabled, such InfisicalSecrets are refused.")
+	flag.BoolVar(&followExternalSecrets, "follow-external-secrets", false,
+		"Also reconcile workloads consuming a secret that an ExternalSecret of the External Secrets Operator syncs under the name of a managed secret into another namespace. Requires --allow-cross-namespace-references and the External Secrets Operator CRDs.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"Number of InfisicalSecrets reconciled in parallel.")
+	flag.IntVar(&maxConcurrentReconcilesPerNamespace, "max-concurrent-reconciles-per-namespace", 0,
+		"Number of InfisicalSecrets of the same namespace reconciled in parallel, so a namespace with slow reconciles leaves workers for the others. Should be lower than --max-concurrent-reconciles. Set to 0 to disable.")
+	flag.StringVar(&auditSinkType, "audit-sink", "none",
+		"Where to record an audit trail of workload restart decisions. One of none, stdout, file or webhook.")
+	flag.StringVar(&auditFilePath, "audit-file-path", "", "The file audit records are appended to when using the file audit sink.")
+	flag.StringVar(&auditWebhookURL, "audit-webhook-url", "", "The URL audit records are posted to when using the webhook audit sink.")
+	flag.StringVar(&fingerprintKeyNamespace, "fingerprint-key-namespace", "",
+		"Namespace of the secret holding the key the hashes of secret data are computed with. Defaults to the namespace of the operator pod, read from the POD_NAMESPACE environment variable.")
+	flag.StringVar(&auditChainHeadPath, "audit-chain-head-path", "",
+		"The file the hash of the last audit record is persisted to when using the stdout or webhook audit sink, so the hash chain continues across restarts.")
+	flag.BoolVar(&enableRestartJobs, "enable-restart-jobs", false,
+		"Run the pre and post restart Jobs of InfisicalSecrets. Anyone allowed to create InfisicalSecrets can then run pods with any service account of their namespace.")
+	referenceDetectors := controllers.NewReferenceDetectorRegistry()
+	for _, detectorName := range referenceDetectors.Names() {
+		flag.BoolVar(referenceDetectors.EnabledFlag(detectorName), "enable-reference-detector-"+detectorName, *referenceDetectors.EnabledFlag(detectorName),
+			referenceDetectors.Description(detectorName))
+	}
 	opts := zap.Options{
 		Development: true,
 	}
@@ -49,6 +113,11 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if followExternalSecrets && !allowCrossNamespaceReferences {
+		// ExternalSecrets are only followed into namespaces other than the managed secret's, which the default policy never reloads
+		setupLog.Info("--follow-external-secrets has no effect without --allow-cross-namespace-references")
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -73,9 +142,52 @@ func main() {
 		os.Exit(1)
 	}
 
+	auditSink, err := audit.NewSink(auditSinkType, auditFilePath, auditWebhookURL, auditChainHeadPath)
+	if err != nil {
+		setupLog.Error(err, "unable to set up audit sink")
+		os.Exit(1)
+	}
+
+	// the cache of the manager is not started yet, so the key is loaded with a client reading from the API server directly
+	setupClient, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme()})
+	if err != nil {
+		setupLog.Error(err, "unable to create setup client")
+		os.Exit(1)
+	}
+
+	fingerprintKeyNamespace = controllers.ResolveOperatorNamespace(fingerprintKeyNamespace)
+	fingerprintKey, err := controllers.LoadOrCreateFingerprintKey(context.Background(), setupClient, fingerprintKeyNamespace)
+	if err != nil {
+		setupLog.Error(err, "unable to load fingerprint key")
+		os.Exit(1)
+	}
+
+	var namespaceConcurrency *controllers.NamespaceConcurrencyLimiter
+	if maxConcurrentReconcilesPerNamespace > 0 {
+		namespaceConcurrency = controllers.NewNamespaceConcurrencyLimiter(maxConcurrentReconcilesPerNamespace)
+	}
+
 	if err = (&controllers.InfisicalSecretReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                           mgr.GetClient(),
+		Scheme:                           mgr.GetScheme(),
+		Recorder:                         mgr.GetEventRecorderFor("infisicalsecret-controller"),
+		DeferRestartsDuringDrain:         deferRestartsDuringDrain,
+		DrainUnschedulableNodeThreshold:  drainUnschedulableNodeThreshold,
+		DrainUnschedulableNodePercentage: drainUnschedulableNodePercentage,
+		ReferenceDetectors:               referenceDetectors,
+		EnablePodDeletion:                enablePodDeletion,
+		PreflightWorkloadPermissions:     preflightWorkloadPermissions,
+		AllowCrossNamespaceReferences:    allowCrossNamespaceReferences,
+		DefaultReconcileTimeout:          reconcileTimeout,
+		AdoptWorkloadsOnFirstObservation: adoptWorkloadsOnFirstObservation,
+		ConsolidateWorkloadAnnotations:   consolidateWorkloadAnnotations,
+		FollowExternalSecrets:            followExternalSecrets,
+		DefaultEmptySecretNamespace:      defaultEmptySecretNamespace,
+		MaxConcurrentReconciles:          maxConcurrentReconciles,
+		NamespaceConcurrency:             namespaceConcurrency,
+		AuditSink:                        auditSink,
+		EnableRestartJobs:                enableRestartJobs,
+		FingerprintKey:                   fingerprintKey,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "InfisicalSecret")
 		os.Exit(1)
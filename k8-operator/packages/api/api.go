@@ -8,8 +8,10 @@ import (
 
 const USER_AGENT_NAME = "k8-operator"
 
+// Endpoints are relative to the base URL of the given http client, see util.NewHTTPClient
+
 func CallGetEncryptedWorkspaceKey(httpClient *resty.Client, request GetEncryptedWorkspaceKeyRequest) (GetEncryptedWorkspaceKeyResponse, error) {
-	endpoint := fmt.Sprintf("%v/v2/workspace/%v/encrypted-key", API_HOST_URL, request.WorkspaceId)
+	endpoint := fmt.Sprintf("/v2/workspace/%v/encrypted-key", request.WorkspaceId)
 	var result GetEncryptedWorkspaceKeyResponse
 	response, err := httpClient.
 		R().
@@ -34,7 +36,7 @@ func CallGetServiceTokenDetailsV2(httpClient *resty.Client) (GetServiceTokenDeta
 		R().
 		SetResult(&tokenDetailsResponse).
 		SetHeader("User-Agent", USER_AGENT_NAME).
-		Get(fmt.Sprintf("%v/v2/service-token", API_HOST_URL))
+		Get("/v2/service-token")
 
 	if err != nil {
 		return GetServiceTokenDetailsResponse{}, fmt.Errorf("CallGetServiceTokenDetails: Unable to complete api request [err=%s]", err)
@@ -66,7 +68,7 @@ func CallGetSecretsV3(httpClient *resty.Client, request GetEncryptedSecretsV3Req
 		httpRequest.SetQueryParam("secretPath", request.SecretPath)
 	}
 
-	response, err := httpRequest.Get(fmt.Sprintf("%v/v3/secrets", API_HOST_URL))
+	response, err := httpRequest.Get("/v3/secrets")
 
 	if err != nil {
 		return GetEncryptedSecretsV3Response{}, fmt.Errorf("CallGetSecretsV3: Unable to complete api request [err=%s]", err)
@@ -90,7 +92,7 @@ func CallGetServiceTokenAccountDetailsV2(httpClient *resty.Client) (ServiceAccou
 		R().
 		SetResult(&serviceAccountDetailsResponse).
 		SetHeader("User-Agent", USER_AGENT_NAME).
-		Get(fmt.Sprintf("%v/v2/service-accounts/me", API_HOST_URL))
+		Get("/v2/service-accounts/me")
 
 	if err != nil {
 		return ServiceAccountDetailsResponse{}, fmt.Errorf("CallGetServiceTokenAccountDetailsV2: Unable to complete api request [err=%s]", err)
@@ -103,15 +105,15 @@ func CallGetServiceTokenAccountDetailsV2(httpClient *resty.Client) (ServiceAccou
 	return serviceAccountDetailsResponse, nil
 }
 
-func CallUniversalMachineIdentityLogin(request MachineIdentityUniversalAuthLoginRequest) (MachineIdentityDetailsResponse, error) {
+func CallUniversalMachineIdentityLogin(httpClient *resty.Client, request MachineIdentityUniversalAuthLoginRequest) (MachineIdentityDetailsResponse, error) {
 	var machineIdentityDetailsResponse MachineIdentityDetailsResponse
 
-	response, err := resty.New().
+	response, err := httpClient.
 		R().
 		SetResult(&machineIdentityDetailsResponse).
 		SetBody(request).
 		SetHeader("User-Agent", USER_AGENT_NAME).
-		Post(fmt.Sprintf("%v/v1/auth/universal-auth/login", API_HOST_URL))
+		Post("/v1/auth/universal-auth/login")
 
 	if err != nil {
 		return MachineIdentityDetailsResponse{}, fmt.Errorf("CallUniversalMachineIdentityLogin: Unable to complete api request [err=%s]", err)
@@ -124,15 +126,15 @@ func CallUniversalMachineIdentityLogin(request MachineIdentityUniversalAuthLogin
 	return machineIdentityDetailsResponse, nil
 }
 
-func CallUniversalMachineIdentityRefreshAccessToken(request MachineIdentityUniversalAuthRefreshRequest) (MachineIdentityDetailsResponse, error) {
+func CallUniversalMachineIdentityRefreshAccessToken(httpClient *resty.Client, request MachineIdentityUniversalAuthRefreshRequest) (MachineIdentityDetailsResponse, error) {
 	var universalAuthRefreshResponse MachineIdentityDetailsResponse
 
-	response, err := resty.New().
+	response, err := httpClient.
 		R().
 		SetResult(&universalAuthRefreshResponse).
 		SetHeader("User-Agent", USER_AGENT_NAME).
 		SetBody(request).
-		Post(fmt.Sprintf("%v/v1/auth/token/renew", API_HOST_URL))
+		Post("/v1/auth/token/renew")
 
 	if err != nil {
 		return MachineIdentityDetailsResponse{}, fmt.Errorf("CallUniversalAuthRefreshAccessToken: Unable to complete api request [err=%s]", err)
@@ -155,7 +157,7 @@ func CallGetDecryptedSecretsV3(httpClient *resty.Client, request GetDecryptedSec
 		SetQueryParam("secretPath", request.SecretPath).
 		SetQueryParam("workspaceSlug", request.ProjectSlug).
 		SetQueryParam("environment", request.Environment).
-		Get(fmt.Sprintf("%v/v3/secrets/raw", API_HOST_URL))
+		Get("/v3/secrets/raw")
 
 	if err != nil {
 		return GetDecryptedSecretsV3Response{}, fmt.Errorf("CallGetDecryptedSecretsV3: Unable to complete api request [err=%s]", err)
@@ -179,7 +181,7 @@ func CallGetServiceAccountWorkspacePermissionsV2(httpClient *resty.Client) (Serv
 		R().
 		SetResult(&serviceAccountWorkspacePermissionsResponse).
 		SetHeader("User-Agent", USER_AGENT_NAME).
-		Get(fmt.Sprintf("%v/v2/service-accounts/<service-account-id>/permissions/workspace", API_HOST_URL))
+		Get("/v2/service-accounts/<service-account-id>/permissions/workspace")
 
 	if err != nil {
 		return ServiceAccountWorkspacePermissions{}, fmt.Errorf("CallGetServiceAccountWorkspacePermissionsV2: Unable to complete api request [err=%s]", err)
@@ -198,7 +200,7 @@ func CallGetServiceAccountKeysV2(httpClient *resty.Client, request GetServiceAcc
 		R().
 		SetResult(&serviceAccountKeysResponse).
 		SetHeader("User-Agent", USER_AGENT_NAME).
-		Get(fmt.Sprintf("%v/v2/service-accounts/%v/keys", API_HOST_URL, request.ServiceAccountId))
+		Get(fmt.Sprintf("/v2/service-accounts/%v/keys", request.ServiceAccountId))
 
 	if err != nil {
 		return GetServiceAccountKeysResponse{}, fmt.Errorf("CallGetServiceAccountKeysV2: Unable to complete api request [err=%s]", err)
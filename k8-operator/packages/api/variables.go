@@ -1,3 +0,0 @@
-package api
-
-var API_HOST_URL string = "https://app.infisical.com/api"
@@ -0,0 +1,303 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Infisical/infisical/k8-operator/packages/api"
+	"github.com/go-resty/resty/v2"
+)
+
+const SINK_TYPE_NONE = "none"
+const SINK_TYPE_STDOUT = "stdout"
+const SINK_TYPE_FILE = "file"
+const SINK_TYPE_WEBHOOK = "webhook"
+
+const DECISION_RESTARTED = "restarted"
+const DECISION_SKIPPED = "skipped"
+const DECISION_DEFERRED = "deferred"
+const DECISION_ADOPTED = "adopted"
+
+const OUTCOME_SUCCESS = "success"
+const OUTCOME_FAILURE = "failure"
+
+// Upper bound for a single delivery to the audit webhook, so an unresponsive webhook cannot hold up later records
+const WEBHOOK_TIMEOUT = 10 * time.Second
+
+// Records waiting to be delivered to the audit webhook. Records are refused once it is full, instead of blocking reconciles
+const WEBHOOK_QUEUE_SIZE = 1000
+
+// A single restart decision made by the operator for a workload consuming a managed secret
+type Record struct {
+	Timestamp       time.Time `json:"timestamp"`
+	InfisicalSecret string    `json:"infisicalSecret"`
+	Workload        string    `json:"workload"`
+	PreviousVersion string    `json:"previousVersion"`
+	NewVersion      string    `json:"newVersion"`
+	Decision        string    `json:"decision"`
+	Outcome         string    `json:"outcome"`
+	Reason          string    `json:"reason,omitempty"`
+	Message         string    `json:"message,omitempty"`
+
+	// Each record carries the hash of the record before it, so that removed or modified records break the chain
+	PreviousHash string `json:"previousHash"`
+	Hash         string `json:"hash"`
+}
+
+type Sink interface {
+	Write(record Record) error
+}
+
+// Creates the audit sink for the given type. Returns nil when auditing is turned off.
+// The file sink continues the hash chain of the records already in its file. The other sinks cannot read back what they wrote, so the hash of
+// their last record is persisted to chainHeadPath instead, when set. Without it, their chain starts over every time the operator starts
+func NewSink(sinkType string, filePath string, webhookURL string, chainHeadPath string) (Sink, error) {
+	switch sinkType {
+	case "", SINK_TYPE_NONE:
+		return nil, nil
+	case SINK_TYPE_STDOUT:
+		return newChainedSinkOrError(&streamWriter{stream: os.Stdout}, chainHeadPath)
+	case SINK_TYPE_FILE:
+		if filePath == "" {
+			return nil, fmt.Errorf("an audit file path must be provided when using the [%s] audit sink", SINK_TYPE_FILE)
+		}
+
+		lastHash, endsInPartialLine, err := readLastRecordHash(filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open audit file [path=%s] [err=%s]", filePath, err)
+		}
+
+		// the next record would otherwise be appended to the torn one
+		if endsInPartialLine {
+			if _, err := file.Write([]byte("\n")); err != nil {
+				file.Close()
+				return nil, fmt.Errorf("unable to terminate the torn record of audit file [path=%s] [err=%s]", filePath, err)
+			}
+		}
+
+		return &chainedSink{writer: &streamWriter{stream: file}, lastHash: lastHash}, nil
+	case SINK_TYPE_WEBHOOK:
+		if webhookURL == "" {
+			return nil, fmt.Errorf("an audit webhook URL must be provided when using the [%s] audit sink", SINK_TYPE_WEBHOOK)
+		}
+
+		return newChainedSinkOrError(newWebhookWriter(webhookURL, WEBHOOK_TIMEOUT), chainHeadPath)
+	default:
+		return nil, fmt.Errorf("unknown audit sink type [type=%s]. Must be one of [%s, %s, %s, %s]", sinkType, SINK_TYPE_NONE, SINK_TYPE_STDOUT, SINK_TYPE_FILE, SINK_TYPE_WEBHOOK)
+	}
+}
+
+type recordWriter interface {
+	write(encodedRecord []byte) error
+}
+
+// Serializes writes and links every record to the previous one through a SHA-256 hash chain
+type chainedSink struct {
+	mutex    sync.Mutex
+	lastHash string
+	writer   recordWriter
+	// optional file the hash of the last record is persisted to, so the chain continues after a restart
+	headPath string
+}
+
+func newChainedSink(writer recordWriter, headPath string) (*chainedSink, error) {
+	sink := &chainedSink{writer: writer, headPath: headPath}
+	if headPath == "" {
+		return sink, nil
+	}
+
+	head, err := os.ReadFile(headPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to read audit chain head [path=%s] [err=%s]", headPath, err)
+	}
+	sink.lastHash = strings.TrimSpace(string(head))
+	return sink, nil
+}
+
+func (s *chainedSink) Write(record Record) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now().UTC()
+	}
+
+	record.PreviousHash = s.lastHash
+	record.Hash = ""
+
+	unhashedRecord, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("unable to encode audit record [err=%s]", err)
+	}
+
+	hash := sha256.Sum256(append([]byte(s.lastHash), unhashedRecord...))
+	record.Hash = hex.EncodeToString(hash[:])
+
+	encodedRecord, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("unable to encode audit record [err=%s]", err)
+	}
+
+	if err := s.writer.write(encodedRecord); err != nil {
+		return err
+	}
+
+	s.lastHash = record.Hash
+
+	if s.headPath != "" {
+		// the record is written either way, so a head that cannot be persisted only breaks the chain on the next restart
+		if err := persistChainHead(s.headPath, s.lastHash); err != nil {
+			fmt.Printf("unable to persist audit chain head [path=%s] [err=%s]\n", s.headPath, err)
+		}
+	}
+	return nil
+}
+
+// Avoids returning a nil *chainedSink as a non-nil Sink when the chain head cannot be read
+func newChainedSinkOrError(writer recordWriter, headPath string) (Sink, error) {
+	sink, err := newChainedSink(writer, headPath)
+	if err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+// Replaces the head atomically, so a crash while persisting it never leaves a partial hash behind
+func persistChainHead(headPath string, hash string) error {
+	temporaryPath := headPath + ".tmp"
+	if err := os.WriteFile(temporaryPath, []byte(hash), 0600); err != nil {
+		return err
+	}
+	return os.Rename(temporaryPath, headPath)
+}
+
+// Returns the hash of the last record in an audit file, or an empty hash when the file does not exist or holds no records yet.
+// A crash while writing can leave a torn record at the end of the file. Such records are skipped with a warning and the chain continues
+// from the last complete record, so a torn record never keeps the operator from starting. Also reports whether the file ends in a partial
+// line, which has to be terminated before the next record is appended
+func readLastRecordHash(filePath string) (string, bool, error) {
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("unable to open audit file [path=%s] [err=%s]", filePath, err)
+	}
+	defer file.Close()
+
+	var lines [][]byte
+	endsInPartialLine := false
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			endsInPartialLine = line[len(line)-1] != '\n'
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			lines = append(lines, line)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", false, fmt.Errorf("unable to read audit file [path=%s] [err=%s]", filePath, err)
+		}
+	}
+
+	for i := len(lines) - 1; i >= 0; i-- {
+		var record Record
+		if err := json.Unmarshal(lines[i], &record); err != nil || record.Hash == "" {
+			continue
+		}
+
+		if tornRecords := len(lines) - 1 - i; tornRecords > 0 {
+			fmt.Printf("skipping [count=%d] torn records at the end of audit file [path=%s]. Continuing the chain from [hash=%s]\n", tornRecords, filePath, record.Hash)
+		}
+		return record.Hash, endsInPartialLine, nil
+	}
+
+	if len(lines) > 0 {
+		fmt.Printf("audit file [path=%s] holds no complete record. Starting a new chain\n", filePath)
+	}
+	return "", endsInPartialLine, nil
+}
+
+type streamWriter struct {
+	stream io.Writer
+}
+
+func (w *streamWriter) write(encodedRecord []byte) error {
+	if _, err := w.stream.Write(append(encodedRecord, '\n')); err != nil {
+		return fmt.Errorf("unable to write audit record [err=%s]", err)
+	}
+	return nil
+}
+
+// Delivers records to the webhook one at a time and in order, in the background
+type webhookWriter struct {
+	url        string
+	httpClient *resty.Client
+	queue      chan []byte
+}
+
+func newWebhookWriter(url string, timeout time.Duration) *webhookWriter {
+	writer := &webhookWriter{
+		url:        url,
+		httpClient: resty.New().SetTimeout(timeout),
+		queue:      make(chan []byte, WEBHOOK_QUEUE_SIZE),
+	}
+	go writer.deliver()
+	return writer
+}
+
+// Only queues the record, so a slow webhook never blocks the reconciles writing records.
+// A record refused because the queue is full does not advance the chain, while one that fails to be delivered shows up as a gap in it
+func (w *webhookWriter) write(encodedRecord []byte) error {
+	select {
+	case w.queue <- encodedRecord:
+		return nil
+	default:
+		return fmt.Errorf("unable to queue audit record, [size=%d] records are already waiting for the webhook", WEBHOOK_QUEUE_SIZE)
+	}
+}
+
+func (w *webhookWriter) deliver() {
+	for encodedRecord := range w.queue {
+		if err := w.send(encodedRecord); err != nil {
+			fmt.Printf("%s\n", err)
+		}
+	}
+}
+
+func (w *webhookWriter) send(encodedRecord []byte) error {
+	response, err := w.httpClient.
+		R().
+		SetHeader("User-Agent", api.USER_AGENT_NAME).
+		SetHeader("Content-Type", "application/json").
+		SetBody(encodedRecord).
+		Post(w.url)
+
+	if err != nil {
+		return fmt.Errorf("unable to send audit record to webhook [err=%s]", err)
+	}
+
+	if response.IsError() {
+		return fmt.Errorf("unsuccessful response from audit webhook [response=%s]", response)
+	}
+
+	return nil
+}
@@ -0,0 +1,233 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+// Decodes records written one per line and checks that every record is linked to the one before it and that none was modified
+func verifyChain(g *WithT, encodedRecords []string) []Record {
+	var records []Record
+	previousHash := ""
+	for _, encodedRecord := range encodedRecords {
+		var record Record
+		g.Expect(json.Unmarshal([]byte(encodedRecord), &record)).To(Succeed())
+		g.Expect(record.PreviousHash).To(Equal(previousHash))
+
+		hash := record.Hash
+		record.Hash = ""
+		unhashedRecord, err := json.Marshal(record)
+		g.Expect(err).NotTo(HaveOccurred())
+		expectedHash := sha256.Sum256(append([]byte(record.PreviousHash), unhashedRecord...))
+		g.Expect(hash).To(Equal(hex.EncodeToString(expectedHash[:])))
+
+		record.Hash = hash
+		previousHash = hash
+		records = append(records, record)
+	}
+	return records
+}
+
+func readLines(g *WithT, filePath string) []string {
+	content, err := os.ReadFile(filePath)
+	g.Expect(err).NotTo(HaveOccurred())
+	return strings.Split(strings.TrimSpace(string(content)), "\n")
+}
+
+func TestChainedSinkLinksRecords(t *testing.T) {
+	g := NewWithT(t)
+
+	output := &bytes.Buffer{}
+	sink := &chainedSink{writer: &streamWriter{stream: output}}
+
+	for _, workload := range []string{"Deployment/default/api", "Deployment/default/worker", "StatefulSet/default/db"} {
+		g.Expect(sink.Write(Record{Workload: workload, Decision: DECISION_RESTARTED, Outcome: OUTCOME_SUCCESS})).To(Succeed())
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	records := verifyChain(g, lines)
+	g.Expect(records).To(HaveLen(3))
+	g.Expect(records[0].PreviousHash).To(BeEmpty())
+	g.Expect(records[2].Workload).To(Equal("StatefulSet/default/db"))
+	g.Expect(records[2].Timestamp.IsZero()).To(BeFalse())
+
+	// a modified record no longer matches its hash
+	tampered := strings.Replace(lines[1], DECISION_RESTARTED, DECISION_SKIPPED, 1)
+	var tamperedRecord Record
+	g.Expect(json.Unmarshal([]byte(tampered), &tamperedRecord)).To(Succeed())
+	hash := tamperedRecord.Hash
+	tamperedRecord.Hash = ""
+	unhashedRecord, err := json.Marshal(tamperedRecord)
+	g.Expect(err).NotTo(HaveOccurred())
+	recomputedHash := sha256.Sum256(append([]byte(tamperedRecord.PreviousHash), unhashedRecord...))
+	g.Expect(hex.EncodeToString(recomputedHash[:])).NotTo(Equal(hash))
+}
+
+func TestFileSinkContinuesChainAcrossRestarts(t *testing.T) {
+	g := NewWithT(t)
+
+	filePath := filepath.Join(t.TempDir(), "audit.log")
+
+	sink, err := NewSink(SINK_TYPE_FILE, filePath, "", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(sink.Write(Record{Workload: "Deployment/default/api"})).To(Succeed())
+	g.Expect(sink.Write(Record{Workload: "Deployment/default/worker"})).To(Succeed())
+
+	// the operator restarts and opens the same file again
+	restartedSink, err := NewSink(SINK_TYPE_FILE, filePath, "", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(restartedSink.Write(Record{Workload: "Deployment/default/api"})).To(Succeed())
+
+	g.Expect(verifyChain(g, readLines(g, filePath))).To(HaveLen(3))
+}
+
+func TestFileSinkSkipsTornLastRecord(t *testing.T) {
+	g := NewWithT(t)
+
+	filePath := filepath.Join(t.TempDir(), "audit.log")
+
+	sink, err := NewSink(SINK_TYPE_FILE, filePath, "", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(sink.Write(Record{Workload: "Deployment/default/api"})).To(Succeed())
+
+	// the operator crashed while writing the next record
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0600)
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = file.Write([]byte(`{"workload":"Deployment/default/wor`))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(file.Close()).To(Succeed())
+
+	restartedSink, err := NewSink(SINK_TYPE_FILE, filePath, "", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(restartedSink.Write(Record{Workload: "Deployment/default/worker"})).To(Succeed())
+
+	// the torn record stays on a line of its own and the chain continues from the last complete record
+	lines := readLines(g, filePath)
+	g.Expect(lines).To(HaveLen(3))
+	g.Expect(lines[1]).To(Equal(`{"workload":"Deployment/default/wor`))
+	records := verifyChain(g, []string{lines[0], lines[2]})
+	g.Expect(records[1].Workload).To(Equal("Deployment/default/worker"))
+}
+
+func TestChainHeadIsPersisted(t *testing.T) {
+	g := NewWithT(t)
+
+	headPath := filepath.Join(t.TempDir(), "audit-chain-head")
+	output := &bytes.Buffer{}
+
+	sink, err := newChainedSink(&streamWriter{stream: output}, headPath)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(sink.Write(Record{Workload: "Deployment/default/api"})).To(Succeed())
+
+	head, err := os.ReadFile(headPath)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(head)).To(Equal(sink.lastHash))
+
+	restartedSink, err := newChainedSink(&streamWriter{stream: output}, headPath)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(restartedSink.Write(Record{Workload: "Deployment/default/worker"})).To(Succeed())
+
+	g.Expect(verifyChain(g, strings.Split(strings.TrimSpace(output.String()), "\n"))).To(HaveLen(2))
+}
+
+func TestWebhookSinkDeliversInBackground(t *testing.T) {
+	g := NewWithT(t)
+
+	release := make(chan struct{})
+	delivered := make(chan string, 10)
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			// the first delivery hangs until it times out
+			<-release
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		delivered <- string(body)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	sink, err := newChainedSink(newWebhookWriter(server.URL, 100*time.Millisecond), "")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// writes return right away, even though the webhook does not respond
+	start := time.Now()
+	for _, workload := range []string{"Deployment/default/hanging", "Deployment/default/api", "Deployment/default/worker"} {
+		g.Expect(sink.Write(Record{Workload: workload})).To(Succeed())
+	}
+	g.Expect(time.Since(start)).To(BeNumerically("<", 100*time.Millisecond))
+
+	var bodies []string
+	for len(bodies) < 2 {
+		select {
+		case body := <-delivered:
+			bodies = append(bodies, body)
+		case <-time.After(5 * time.Second):
+			t.Fatal("audit records were not delivered after the hanging delivery timed out")
+		}
+	}
+
+	var records []Record
+	for _, body := range bodies {
+		var record Record
+		g.Expect(json.Unmarshal([]byte(body), &record)).To(Succeed())
+		records = append(records, record)
+	}
+	g.Expect(records[0].Workload).To(Equal("Deployment/default/api"))
+	g.Expect(records[1].Workload).To(Equal("Deployment/default/worker"))
+	g.Expect(records[1].PreviousHash).To(Equal(records[0].Hash))
+}
+
+func TestWebhookSinkRefusesRecordsWhenQueueIsFull(t *testing.T) {
+	g := NewWithT(t)
+
+	// a writer without a delivery loop, so queued records are never picked up
+	writer := &webhookWriter{queue: make(chan []byte, 1)}
+	sink, err := newChainedSink(writer, "")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(sink.Write(Record{Workload: "Deployment/default/api"})).To(Succeed())
+	head := sink.lastHash
+
+	g.Expect(sink.Write(Record{Workload: "Deployment/default/worker"})).To(MatchError(ContainSubstring("unable to queue audit record")))
+	g.Expect(sink.lastHash).To(Equal(head))
+}
+
+func TestNewSink(t *testing.T) {
+	g := NewWithT(t)
+
+	sink, err := NewSink(SINK_TYPE_NONE, "", "", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(sink).To(BeNil())
+
+	_, err = NewSink(SINK_TYPE_FILE, "", "", "")
+	g.Expect(err).To(MatchError(ContainSubstring("an audit file path must be provided")))
+
+	_, err = NewSink(SINK_TYPE_WEBHOOK, "", "", "")
+	g.Expect(err).To(MatchError(ContainSubstring("an audit webhook URL must be provided")))
+
+	_, err = NewSink("syslog", "", "", "")
+	g.Expect(err).To(MatchError(ContainSubstring("unknown audit sink type")))
+
+	// a file without a complete record does not keep the operator from starting, its chain starts over
+	corruptFilePath := filepath.Join(t.TempDir(), "audit.log")
+	g.Expect(os.WriteFile(corruptFilePath, []byte("not a record\n"), 0600)).To(Succeed())
+	sink, err = NewSink(SINK_TYPE_FILE, corruptFilePath, "", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(sink.Write(Record{Workload: "Deployment/default/api"})).To(Succeed())
+	g.Expect(verifyChain(g, readLines(g, corruptFilePath)[1:])).To(HaveLen(1))
+}
@@ -0,0 +1,175 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// how far ahead to look for the next activation before a schedule is considered to never fire (e.g. 0 0 30 2 *)
+const MAX_SEARCH_DAYS = 366 * 5
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// A parsed cron expression evaluated in a fixed time zone
+type Schedule struct {
+	minutes     map[int]bool
+	hours       map[int]bool
+	daysOfMonth map[int]bool
+	months      map[int]bool
+	daysOfWeek  map[int]bool
+
+	// cron fires when either the day of month or the day of week matches if both of them are restricted
+	daysOfMonthRestricted bool
+	daysOfWeekRestricted  bool
+
+	location *time.Location
+}
+
+// Parses a standard five field cron expression (minute hour day-of-month month day-of-week) or one of the @ macros.
+// An empty time zone evaluates the schedule in UTC
+func Parse(expression string, timeZone string) (*Schedule, error) {
+	location := time.UTC
+	if timeZone != "" {
+		var err error
+		location, err = time.LoadLocation(timeZone)
+		if err != nil {
+			return nil, fmt.Errorf("unknown time zone [timeZone=%s] [err=%s]", timeZone, err)
+		}
+	}
+
+	expression = strings.TrimSpace(expression)
+	if macro, exists := macros[expression]; exists {
+		expression = macro
+	}
+
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression [expression=%s] must have 5 fields, found %v", expression, len(fields))
+	}
+
+	schedule := &Schedule{location: location}
+
+	var err error
+	if schedule.minutes, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("invalid minute field: %w", err)
+	}
+	if schedule.hours, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("invalid hour field: %w", err)
+	}
+	if schedule.daysOfMonth, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("invalid day of month field: %w", err)
+	}
+	if schedule.months, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("invalid month field: %w", err)
+	}
+	if schedule.daysOfWeek, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("invalid day of week field: %w", err)
+	}
+
+	// both 0 and 7 mean sunday
+	if schedule.daysOfWeek[7] {
+		schedule.daysOfWeek[0] = true
+	}
+
+	schedule.daysOfMonthRestricted = !strings.HasPrefix(fields[2], "*")
+	schedule.daysOfWeekRestricted = !strings.HasPrefix(fields[4], "*")
+
+	return schedule, nil
+}
+
+// Returns the first activation of the schedule strictly after the given time, or the zero time if the schedule never fires
+func (s *Schedule) Next(after time.Time) time.Time {
+	t := after.In(s.location).Truncate(time.Minute).Add(time.Minute)
+	searchEnd := t.AddDate(0, 0, MAX_SEARCH_DAYS)
+
+	for t.Before(searchEnd) {
+		if !s.months[int(t.Month())] || !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+			continue
+		}
+
+		if !s.hours[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location)
+			continue
+		}
+
+		if !s.minutes[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (s *Schedule) matchesDay(t time.Time) bool {
+	dayOfMonthMatches := s.daysOfMonth[t.Day()]
+	dayOfWeekMatches := s.daysOfWeek[int(t.Weekday())]
+
+	if s.daysOfMonthRestricted && s.daysOfWeekRestricted {
+		return dayOfMonthMatches || dayOfWeekMatches
+	}
+	return dayOfMonthMatches && dayOfWeekMatches
+}
+
+// Parses a comma separated list of values, ranges (1-5) and steps (*/15, 1-30/5) into the set of matching values
+func parseField(field string, min int, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step [step=%s]", stepPart)
+			}
+		}
+
+		start, end := min, max
+		if rangePart != "*" {
+			startPart, endPart, isRange := strings.Cut(rangePart, "-")
+
+			var err error
+			start, err = strconv.Atoi(startPart)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value [value=%s]", startPart)
+			}
+
+			end = start
+			if isRange {
+				end, err = strconv.Atoi(endPart)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value [value=%s]", endPart)
+				}
+			} else if hasStep {
+				// 5/15 means every 15 starting at 5
+				end = max
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return nil, fmt.Errorf("[%s] is outside of the allowed range %v-%v", part, min, max)
+		}
+
+		for value := start; value <= end; value += step {
+			values[value] = true
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,52 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestScheduleNext(t *testing.T) {
+	g := NewWithT(t)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	testCases := map[string]struct {
+		expression string
+		timeZone   string
+		after      time.Time
+		next       time.Time
+	}{
+		"daily in utc":           {"0 2 * * *", "", time.Date(2024, 3, 10, 14, 0, 0, 0, time.UTC), time.Date(2024, 3, 11, 2, 0, 0, 0, time.UTC)},
+		"daily in time zone":     {"0 2 * * *", "Europe/Berlin", time.Date(2024, 3, 10, 14, 0, 0, 0, time.UTC), time.Date(2024, 3, 11, 2, 0, 0, 0, berlin)},
+		"strictly after":         {"0 2 * * *", "", time.Date(2024, 3, 11, 2, 0, 0, 0, time.UTC), time.Date(2024, 3, 12, 2, 0, 0, 0, time.UTC)},
+		"steps":                  {"*/15 * * * *", "", time.Date(2024, 3, 10, 14, 7, 30, 0, time.UTC), time.Date(2024, 3, 10, 14, 15, 0, 0, time.UTC)},
+		"weekdays":               {"30 3 * * 1-5", "", time.Date(2024, 3, 8, 4, 0, 0, 0, time.UTC), time.Date(2024, 3, 11, 3, 30, 0, 0, time.UTC)},
+		"sunday as 7":            {"0 0 * * 7", "", time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)},
+		"day of month or week":   {"0 0 1 * 1", "", time.Date(2024, 3, 26, 0, 0, 0, 0, time.UTC), time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		"macro":                  {"@monthly", "", time.Date(2024, 3, 26, 0, 0, 0, 0, time.UTC), time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		"skipped by dst":         {"30 2 * * *", "Europe/Berlin", time.Date(2024, 3, 30, 12, 0, 0, 0, time.UTC), time.Date(2024, 4, 1, 2, 30, 0, 0, berlin)},
+		"never fires":            {"0 0 30 2 *", "", time.Date(2024, 3, 26, 0, 0, 0, 0, time.UTC), time.Time{}},
+		"list of hours in range": {"0 9,17 * * *", "", time.Date(2024, 3, 26, 10, 0, 0, 0, time.UTC), time.Date(2024, 3, 26, 17, 0, 0, 0, time.UTC)},
+	}
+
+	for name, testCase := range testCases {
+		schedule, err := Parse(testCase.expression, testCase.timeZone)
+		g.Expect(err).NotTo(HaveOccurred(), name)
+		g.Expect(schedule.Next(testCase.after).Equal(testCase.next)).To(BeTrue(), "%s: got %v", name, schedule.Next(testCase.after))
+	}
+}
+
+func TestParseInvalidSchedules(t *testing.T) {
+	g := NewWithT(t)
+
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := Parse(expression, "")
+		g.Expect(err).To(HaveOccurred(), expression)
+	}
+
+	_, err := Parse("0 2 * * *", "Mars/Olympus_Mons")
+	g.Expect(err).To(HaveOccurred())
+}
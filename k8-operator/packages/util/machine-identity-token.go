@@ -7,7 +7,6 @@ import (
 	"time"
 
 	"github.com/Infisical/infisical/k8-operator/packages/api"
-	"github.com/go-resty/resty/v2"
 )
 
 type MachineIdentityToken struct {
@@ -21,13 +20,15 @@ type MachineIdentityToken struct {
 	accessToken  string
 	clientSecret string
 	clientId     string
+	hostAPI      string
 }
 
-func NewMachineIdentityToken(clientId string, clientSecret string) *MachineIdentityToken {
+func NewMachineIdentityToken(hostAPI string, clientId string, clientSecret string) *MachineIdentityToken {
 
 	token := MachineIdentityToken{
 		clientSecret: clientSecret,
 		clientId:     clientId,
+		hostAPI:      hostAPI,
 	}
 
 	go token.HandleTokenLifecycle()
@@ -99,7 +100,7 @@ func (t *MachineIdentityToken) HandleTokenLifecycle() error {
 }
 
 func (t *MachineIdentityToken) RefreshAccessToken() error {
-	httpClient := resty.New()
+	httpClient := NewHTTPClient(t.hostAPI)
 	httpClient.SetRetryCount(10000).
 		SetRetryMaxWaitTime(20 * time.Second).
 		SetRetryWaitTime(5 * time.Second)
@@ -110,7 +111,7 @@ func (t *MachineIdentityToken) RefreshAccessToken() error {
 		return err
 	}
 
-	response, err := api.CallUniversalMachineIdentityRefreshAccessToken(api.MachineIdentityUniversalAuthRefreshRequest{AccessToken: accessToken})
+	response, err := api.CallUniversalMachineIdentityRefreshAccessToken(httpClient, api.MachineIdentityUniversalAuthRefreshRequest{AccessToken: accessToken})
 	if err != nil {
 		return err
 	}
@@ -127,7 +128,7 @@ func (t *MachineIdentityToken) RefreshAccessToken() error {
 // Fetches a new access token using client credentials
 func (t *MachineIdentityToken) FetchNewAccessToken() error {
 
-	loginResponse, err := api.CallUniversalMachineIdentityLogin(api.MachineIdentityUniversalAuthLoginRequest{
+	loginResponse, err := api.CallUniversalMachineIdentityLogin(NewHTTPClient(t.hostAPI), api.MachineIdentityUniversalAuthLoginRequest{
 		ClientId:     t.clientId,
 		ClientSecret: t.clientSecret,
 	})
@@ -21,6 +21,11 @@ type DecodedSymmetricEncryptionDetails = struct {
 	Key    []byte
 }
 
+// Returns a client for the Infisical API at the given host, such as https://app.infisical.com/api
+func NewHTTPClient(hostAPI string) *resty.Client {
+	return resty.New().SetBaseURL(hostAPI)
+}
+
 func VerifyServiceToken(serviceToken string) (string, error) {
 	serviceTokenParts := strings.SplitN(serviceToken, ".", 4)
 	if len(serviceTokenParts) < 4 {
@@ -31,7 +36,7 @@ func VerifyServiceToken(serviceToken string) (string, error) {
 	return serviceToken, nil
 }
 
-func GetServiceTokenDetails(infisicalToken string) (api.GetServiceTokenDetailsResponse, error) {
+func GetServiceTokenDetails(hostAPI string, infisicalToken string) (api.GetServiceTokenDetailsResponse, error) {
 	serviceTokenParts := strings.SplitN(infisicalToken, ".", 4)
 	if len(serviceTokenParts) < 4 {
 		return api.GetServiceTokenDetailsResponse{}, fmt.Errorf("invalid service token entered. Please double check your service token and try again")
@@ -39,7 +44,7 @@ func GetServiceTokenDetails(infisicalToken string) (api.GetServiceTokenDetailsRe
 
 	serviceToken := fmt.Sprintf("%v.%v.%v", serviceTokenParts[0], serviceTokenParts[1], serviceTokenParts[2])
 
-	httpClient := resty.New()
+	httpClient := NewHTTPClient(hostAPI)
 	httpClient.SetAuthToken(serviceToken).
 		SetHeader("Accept", "application/json")
 
@@ -51,9 +56,9 @@ func GetServiceTokenDetails(infisicalToken string) (api.GetServiceTokenDetailsRe
 	return serviceTokenDetails, nil
 }
 
-func GetPlainTextSecretsViaUniversalAuth(accessToken string, etag string, secretScope v1alpha1.MachineIdentityScopeInWorkspace) ([]model.SingleEnvironmentVariable, model.RequestUpdateUpdateDetails, error) {
+func GetPlainTextSecretsViaUniversalAuth(hostAPI string, accessToken string, etag string, secretScope v1alpha1.MachineIdentityScopeInWorkspace) ([]model.SingleEnvironmentVariable, model.RequestUpdateUpdateDetails, error) {
 
-	httpClient := resty.New()
+	httpClient := NewHTTPClient(hostAPI)
 	httpClient.SetAuthScheme("Bearer")
 	httpClient.SetAuthToken(accessToken)
 
@@ -85,7 +90,7 @@ func GetPlainTextSecretsViaUniversalAuth(accessToken string, etag string, secret
 	}, nil
 }
 
-func GetPlainTextSecretsViaServiceToken(fullServiceToken string, etag string, envSlug string, secretPath string) ([]model.SingleEnvironmentVariable, model.RequestUpdateUpdateDetails, error) {
+func GetPlainTextSecretsViaServiceToken(hostAPI string, fullServiceToken string, etag string, envSlug string, secretPath string) ([]model.SingleEnvironmentVariable, model.RequestUpdateUpdateDetails, error) {
 	serviceTokenParts := strings.SplitN(fullServiceToken, ".", 4)
 	if len(serviceTokenParts) < 4 {
 		return nil, model.RequestUpdateUpdateDetails{}, fmt.Errorf("invalid service token entered. Please double check your service token and try again")
@@ -93,7 +98,7 @@ func GetPlainTextSecretsViaServiceToken(fullServiceToken string, etag string, en
 
 	serviceToken := fmt.Sprintf("%v.%v.%v", serviceTokenParts[0], serviceTokenParts[1], serviceTokenParts[2])
 
-	httpClient := resty.New()
+	httpClient := NewHTTPClient(hostAPI)
 
 	httpClient.SetAuthToken(serviceToken).
 		SetHeader("Accept", "application/json")
@@ -135,7 +140,7 @@ func GetPlainTextSecretsViaServiceToken(fullServiceToken string, etag string, en
 	}
 
 	// expand secrets that are referenced
-	expandedSecrets := ExpandSecrets(plainTextSecretsMergedWithImports, fullServiceToken)
+	expandedSecrets := ExpandSecrets(hostAPI, plainTextSecretsMergedWithImports, fullServiceToken)
 
 	return expandedSecrets, model.RequestUpdateUpdateDetails{
 		Modified: encryptedSecretsResponse.Modified,
@@ -146,8 +151,8 @@ func GetPlainTextSecretsViaServiceToken(fullServiceToken string, etag string, en
 // Fetches plaintext secrets from an API endpoint using a service account.
 // The function fetches the service account details and keys, decrypts the workspace key, fetches the encrypted secrets for the specified project and environment, and decrypts the secrets using the decrypted workspace key.
 // Returns the plaintext secrets, encrypted secrets response, and any errors that occurred during the process.
-func GetPlainTextSecretsViaServiceAccount(serviceAccountCreds model.ServiceAccountDetails, projectId string, environmentName string, etag string) ([]model.SingleEnvironmentVariable, model.RequestUpdateUpdateDetails, error) {
-	httpClient := resty.New()
+func GetPlainTextSecretsViaServiceAccount(hostAPI string, serviceAccountCreds model.ServiceAccountDetails, projectId string, environmentName string, etag string) ([]model.SingleEnvironmentVariable, model.RequestUpdateUpdateDetails, error) {
+	httpClient := NewHTTPClient(hostAPI)
 	httpClient.SetAuthToken(serviceAccountCreds.AccessKey).
 		SetHeader("Accept", "application/json")
 
@@ -343,7 +348,7 @@ func recursivelyExpandSecret(expandedSecs map[string]string, interpolatedSecs ma
 	return interpolatedVal
 }
 
-func ExpandSecrets(secrets []model.SingleEnvironmentVariable, infisicalToken string) []model.SingleEnvironmentVariable {
+func ExpandSecrets(hostAPI string, secrets []model.SingleEnvironmentVariable, infisicalToken string) []model.SingleEnvironmentVariable {
 	expandedSecs := make(map[string]string)
 	interpolatedSecs := make(map[string]string)
 	// map[env.secret-path][keyname]Secret
@@ -376,7 +381,7 @@ func ExpandSecrets(secrets []model.SingleEnvironmentVariable, infisicalToken str
 
 			if crossRefSec, ok := crossEnvRefSecs[uniqKey]; !ok {
 				// if not in cross reference cache, fetch it from server
-				refSecs, _, err := GetPlainTextSecretsViaServiceToken(infisicalToken, "", env, secPath)
+				refSecs, _, err := GetPlainTextSecretsViaServiceToken(hostAPI, infisicalToken, "", env, secPath)
 				if err != nil {
 					fmt.Printf("Could not fetch secrets in environment: %s secret-path: %s", env, secPath)
 					// HandleError(err, fmt.Sprintf("Could not fetch secrets in environment: %s secret-path: %s", env, secPath), "If you are using a service token to fetch secrets, please ensure it is valid")